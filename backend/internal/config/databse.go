@@ -34,7 +34,7 @@ func InitDB() *sql.DB {
 	if err != nil {
 		log.Fatal("❌ Failed to open database:", err)
 	}
-	if err := applyMigrations(); err != nil {
+	if err := ApplyMigrations(db, "migrations"); err != nil {
 		log.Fatal("❌ Failed to apply migrations:", err)
 	}
 
@@ -47,8 +47,8 @@ func CloseDB() {
 	}
 }
 
-func applyMigrations() error {
-	migrationDir := "migrations"
+// ApplyMigrations runs the .up.sql files of migrationDir that were not applied to conn yet.
+func ApplyMigrations(conn *sql.DB, migrationDir string) error {
 	absPath, err := filepath.Abs(migrationDir)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute migration path: %v", err)
@@ -59,18 +59,51 @@ func applyMigrations() error {
 		return fmt.Errorf("failed to read migrations directory: %v", err)
 	}
 
+	// Migrations that move data or alter tables must only run once, so every
+	// applied file is recorded and skipped on the next start.
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		name TEXT PRIMARY KEY,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
 	for _, file := range files {
 		if strings.HasSuffix(file.Name(), ".up.sql") {
+			var applied bool
+			err := conn.QueryRow("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE name = ?)", file.Name()).Scan(&applied)
+			if err != nil {
+				return fmt.Errorf("failed to check migration %s: %v", file.Name(), err)
+			}
+			if applied {
+				continue
+			}
+
 			migrationPath := filepath.Join(absPath, file.Name())
 			migrationSQL, err := os.ReadFile(migrationPath)
 			if err != nil {
 				return fmt.Errorf("failed to read migration %s: %v", file.Name(), err)
 			}
 
-			_, err = db.Exec(string(migrationSQL))
+			// run each file in a transaction so a failing ALTER doesn't leave it half applied
+			tx, err := conn.Begin()
+			if err != nil {
+				return fmt.Errorf("failed to start migration %s: %v", file.Name(), err)
+			}
+			_, err = tx.Exec(string(migrationSQL))
 			if err != nil {
+				tx.Rollback()
 				return fmt.Errorf("failed to execute migration %s: %v", file.Name(), err)
 			}
+			_, err = tx.Exec("INSERT INTO schema_migrations (name) VALUES (?)", file.Name())
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to record migration %s: %v", file.Name(), err)
+			}
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("failed to commit migration %s: %v", file.Name(), err)
+			}
 			fmt.Println("🔹 Applied migration:", file.Name())
 		}
 	}
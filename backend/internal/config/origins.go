@@ -0,0 +1,5 @@
+package config
+
+// AllowedOrigin is the frontend allowed to call the API from another origin
+// and to open its sockets.
+const AllowedOrigin = "http://localhost:5173"
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"social-network/internal/models"
+)
+
+// defaultReactions is used when REACTIONS is not set. "like" and "dislike"
+// stay first so the old like/dislike counters keep their meaning.
+var defaultReactions = []models.ReactionType{
+	{Key: "like", Emoji: "👍"},
+	{Key: "dislike", Emoji: "👎"},
+	{Key: "love", Emoji: "❤️"},
+	{Key: "haha", Emoji: "😂"},
+	{Key: "wow", Emoji: "😮"},
+	{Key: "sad", Emoji: "😢"},
+	{Key: "angry", Emoji: "😡"},
+}
+
+// Reactions returns the configured reaction set. It can be overridden with
+// the REACTIONS env variable, e.g. REACTIONS="like:👍,love:❤️,fire:🔥".
+func Reactions() []models.ReactionType {
+	env := strings.TrimSpace(os.Getenv("REACTIONS"))
+	if env == "" {
+		return defaultReactions
+	}
+
+	var reactions []models.ReactionType
+	for _, entry := range strings.Split(env, ",") {
+		key, emoji, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if key == "" {
+			continue
+		}
+		reactions = append(reactions, models.ReactionType{Key: key, Emoji: emoji})
+	}
+	if len(reactions) == 0 {
+		return defaultReactions
+	}
+	return reactions
+}
+
+// IsValidReaction reports whether key is part of the configured reaction set.
+func IsValidReaction(key string) bool {
+	for _, reaction := range Reactions() {
+		if reaction.Key == key {
+			return true
+		}
+	}
+	return false
+}
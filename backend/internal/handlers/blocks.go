@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/repositories"
+)
+
+// BlockUserHandler blocks a user, removing follows both ways
+func BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	updateRelation(w, r, "User blocked", (*repositories.BlockRepository).BlockUser)
+}
+
+// UnblockUserHandler lifts a block set by the session user
+func UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	updateRelation(w, r, "User unblocked", (*repositories.BlockRepository).UnblockUser)
+}
+
+// MuteUserHandler hides a user's posts from the session user's feed
+func MuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	updateRelation(w, r, "User muted", (*repositories.BlockRepository).MuteUser)
+}
+
+// UnmuteUserHandler shows a muted user's posts in the feed again
+func UnmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	updateRelation(w, r, "User unmuted", (*repositories.BlockRepository).UnmuteUser)
+}
+
+// GetBlockedUsersHandler lists the users blocked by the session user
+func GetBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	listRelation(w, r, (*repositories.BlockRepository).GetBlockedUsers)
+}
+
+// GetMutedUsersHandler lists the users muted by the session user
+func GetMutedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	listRelation(w, r, (*repositories.BlockRepository).GetMutedUsers)
+}
+
+// updateRelation decodes {"id": ...} and applies update from the session user to that user.
+func updateRelation(w http.ResponseWriter, r *http.Request, message string,
+	update func(*repositories.BlockRepository, int, int) error) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var target models.User
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil || target.ID == 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if target.ID == user.ID {
+		http.Error(w, "You cannot do this to yourself", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	err := db.QueryRow("SELECT id FROM users WHERE id = ?", target.ID).Scan(&target.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Database error:", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := update(repositories.NewBlockRepository(db), user.ID, target.ID); err != nil {
+		log.Println("❌ Error updating block/mute:", err)
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func listRelation(w http.ResponseWriter, r *http.Request,
+	list func(*repositories.BlockRepository, int) ([]models.User, error)) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	users, err := list(repositories.NewBlockRepository(config.GetDB()), user.ID)
+	if err != nil {
+		log.Println("❌ Error fetching users:", err)
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
@@ -1,17 +1,23 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
 	"social-network/internal/models"
+	"social-network/internal/policy"
 	"social-network/internal/repositories"
+	ws "social-network/internal/websocket"
 )
 
+// GetRecentChats lists the session user's conversations with unread counts
+// and a preview of the last message
 func GetRecentChats(w http.ResponseWriter, r *http.Request) {
 	userID := middlewars.GetUserIDFromSession(w, r)
 	if userID == 0 {
@@ -19,43 +25,172 @@ func GetRecentChats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := config.GetDB()
-	query := `
-		SELECT u.id, u.nickname, u.first_name, u.last_name, MAX(m.sent_at) as last_message_time
-		FROM messages m
-		JOIN users u ON (m.sender_id = u.id OR m.receiver_id = u.id) AND u.id != ?
-		WHERE m.sender_id = ? OR m.receiver_id = ?
-		GROUP BY u.id
-		ORDER BY last_message_time DESC`
-
-	rows, err := db.Query(query, userID, userID, userID)
+	chats, err := repositories.NewChatRepository(config.GetDB()).GetRecentChats(userID)
 	if err != nil {
 		log.Println("❌ Error retrieving recent chats:", err)
 		http.Error(w, "Failed to retrieve recent chats", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var users []any
-	for rows.Next() {
-		var user models.User
-		var tm string
-		err := rows.Scan(&user.ID, &user.Nickname, &user.FirstName, &user.LastName, &tm)
-		if err != nil {
-			log.Println("❌ Error scanning recent chat user:", err)
-			continue
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chats)
+}
+
+// MarkChatReadHandler marks the conversation with user_id read up to
+// message_id (the latest message by default) and tells the other user, and
+// the session user's other sessions, over the chat socket.
+func MarkChatReadHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserID    int `json:"user_id"`
+		MessageID int `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 || req.UserID == userID {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	lastReadID, err := repositories.NewChatRepository(config.GetDB()).MarkConversationRead(userID, req.UserID, req.MessageID)
+	if err != nil {
+		log.Println("❌ Error marking conversation read:", err)
+		http.Error(w, "Failed to mark conversation read", http.StatusInternalServerError)
+		return
+	}
+
+	// the reader's other sessions learn it too, so their unread counts stay in sync
+	event := map[string]any{
+		"type":         "read",
+		"reader_id":    userID,
+		"peer_id":      req.UserID,
+		"last_read_id": lastReadID,
+	}
+	hub.SendToUser(req.UserID, event)
+	hub.SendToUser(userID, event)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"last_read_id": lastReadID})
+}
+
+// GetMessageRequestsHandler lists the pending message requests the session
+// user received. Their messages stay out of the recent chats until accepted.
+func GetMessageRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := repositories.NewMessageRequestRepository(config.GetDB()).GetRequests(userID)
+	if err != nil {
+		log.Println("❌ Error retrieving message requests:", err)
+		http.Error(w, "Failed to retrieve message requests", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// RespondMessageRequestHandler accepts or declines the message request
+// user_id sent to the session user. A declined request can still be accepted
+// later; the sender only hears about an accept.
+func RespondMessageRequestHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserID int  `json:"user_id"`
+		Accept bool `json:"accept"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	err := repositories.NewMessageRequestRepository(config.GetDB()).Respond(userID, req.UserID, req.Accept)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Message request not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("❌ Error answering message request:", err)
+		http.Error(w, "Failed to answer message request", http.StatusInternalServerError)
+		return
+	}
+
+	status := "declined"
+	if req.Accept {
+		status = "accepted"
+		hub.SendToUser(req.UserID, map[string]any{"type": "message_request_accepted", "user_id": userID})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// GetChatPresenceHandler returns the presence of the users in user_ids
+// (comma separated). Users who hide it, or whom the session user may not
+// message, look offline.
+func GetChatPresenceHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	db := config.GetDB()
+	presences := []models.Presence{}
+	for _, field := range strings.Split(r.URL.Query().Get("user_ids"), ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || id == 0 {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
 		}
-		u := map[string]any{
-			"id":                user.ID,
-			"nickname":          user.Nickname,
-			"first_name":        user.FirstName,
-			"last_name":         user.LastName,
-			"last_message_time": tm,
+		presence, err := ws.PresenceFor(db, userID, id)
+		if err != nil {
+			log.Println("❌ Error retrieving presence:", err)
+			http.Error(w, "Failed to retrieve presence", http.StatusInternalServerError)
+			return
 		}
-		users = append(users, u)
+		presences = append(presences, presence)
 	}
 
-	json.NewEncoder(w).Encode(users)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presences)
+}
+
+// UpdatePresenceSettingsHandler lets the session user hide or show their
+// online status and last seen
+func UpdatePresenceSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ShowPresence *bool `json:"show_presence"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ShowPresence == nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := config.GetDB().Exec(`UPDATE users SET show_presence = ? WHERE id = ?`, *req.ShowPresence, userID); err != nil {
+		log.Println("❌ Error updating presence settings:", err)
+		http.Error(w, "Failed to update presence settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"show_presence": *req.ShowPresence})
 }
 
 func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
@@ -75,10 +210,16 @@ func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := historyPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	db := config.GetDB()
 	repo := repositories.NewChatRepository(db) // ✅ FIXED function name
 
-	messages, err := repo.GetMessages(userID, receiverID) // ✅ FIXED function name
+	messages, hasMore, err := repo.GetMessages(userID, receiverID, page)
 	if err != nil {
 		log.Println("❌ Error retrieving chat history:", err)
 		http.Error(w, "Failed to retrieve chat history", http.StatusInternalServerError)
@@ -86,6 +227,8 @@ func GetChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("📜 Chat history retrieved between %d and %d", userID, receiverID)
+	w.Header().Set("Content-Type", "application/json")
+	setHasMore(w, hasMore)
 	json.NewEncoder(w).Encode(messages)
 }
 
@@ -97,13 +240,11 @@ func GetAvailableChatUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	messageable, messageableArgs := policy.Messageable("u.id", userID)
 	query := `
 		SELECT DISTINCT u.id, u.nickname, u.first_name, u.last_name
 		FROM users u
-		LEFT JOIN followers f1 ON f1.follower_id = ? AND f1.following_id = u.id AND f1.status = 'accepted'
-		LEFT JOIN followers f2 ON f2.following_id = ? AND f2.follower_id = u.id AND f2.status = 'accepted'
-		WHERE u.id != ? 
-		  AND (u.is_private = 0 OR f1.follower_id IS NOT NULL OR f2.following_id IS NOT NULL)
+		WHERE ` + messageable + `
 		  AND u.id NOT IN (
 			-- Exclude users already in recent chats
 			SELECT DISTINCT CASE 
@@ -115,7 +256,7 @@ func GetAvailableChatUsers(w http.ResponseWriter, r *http.Request) {
 		)
 		ORDER BY u.nickname ASC`
 
-	rows, err := db.Query(query, userID, userID, userID, userID, userID, userID, userID)
+	rows, err := db.Query(query, append(messageableArgs, userID, userID, userID, userID)...)
 	if err != nil {
 		log.Println("❌ Error retrieving available chat users:", err)
 		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders for thumbnails
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/repositories"
+)
+
+const (
+	// chatUploadsDir is not served by the /uploads/ file server, attachments
+	// are only handed out by DownloadChatAttachmentHandler
+	chatUploadsDir = "chat_uploads"
+	// thumbnailSize bounds the longer side of image thumbnails
+	thumbnailSize = 320
+	// maxChatUpload bounds the file of an upload, the request may carry a
+	// little more for the rest of the form
+	maxChatUpload = 10 << 20
+	// maxThumbnailSource is the most pixels an image may have to get a
+	// thumbnail, decoding more could exhaust memory
+	maxThumbnailSource = 50_000_000
+)
+
+// chatAttachmentTypes are the files chats accept, by sniffed content type
+var chatAttachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"application/zip": true,
+}
+
+// UploadChatAttachmentHandler stores a file ("file" form field) for the
+// session user to send in a chat. The returned id goes in the attachment_ids
+// of the next socket message.
+func UploadChatAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxChatUpload+1<<20)
+	if err := r.ParseMultipartForm(maxChatUpload); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// trust the content, not the name or the header the client sent
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	if !chatAttachmentTypes[mimeType] {
+		http.Error(w, "Unsupported file type", http.StatusBadRequest)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	if err := os.MkdirAll(chatUploadsDir, 0o755); err != nil {
+		log.Println("❌ Error creating chat uploads folder:", err)
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+	path := filepath.Join(chatUploadsDir, fmt.Sprintf("%d_%d%s", time.Now().UnixNano(), user.ID, filepath.Ext(header.Filename)))
+	out, err := os.Create(path)
+	if err != nil {
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+	size, err := io.Copy(out, file)
+	out.Close()
+	if err != nil {
+		os.Remove(path)
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+
+	attachment := &models.ChatAttachment{
+		UploaderID: user.ID,
+		FileName:   filepath.Base(header.Filename),
+		MimeType:   mimeType,
+		Size:       size,
+		Path:       path,
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		// webp has no decoder in the standard library, it goes without a thumbnail
+		if thumbnail, width, height, err := makeThumbnail(path); err == nil {
+			attachment.ThumbnailPath, attachment.Width, attachment.Height = thumbnail, width, height
+		} else {
+			log.Println("⚠️ No thumbnail for chat attachment:", err)
+		}
+	}
+
+	saved, err := repositories.NewAttachmentRepository(config.GetDB()).CreateAttachment(attachment)
+	if err != nil {
+		log.Println("❌ Error storing chat attachment:", err)
+		os.Remove(path)
+		os.Remove(attachment.ThumbnailPath)
+		http.Error(w, "Error saving file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(saved)
+}
+
+// DownloadChatAttachmentHandler serves an attachment, or its thumbnail with
+// thumbnail=1, to the people who can read the message it was sent with.
+func DownloadChatAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id == 0 {
+		http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	attachment, err := repositories.NewAttachmentRepository(db).GetAttachment(id)
+	if err == repositories.ErrAttachmentNotFound {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("❌ Error fetching chat attachment:", err)
+		http.Error(w, "Failed to retrieve attachment", http.StatusInternalServerError)
+		return
+	}
+	// 404 rather than 403 so ids of other conversations cannot be probed
+	if allowed, err := policy.CanDownloadAttachment(db, user.ID, attachment); err != nil || !allowed {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+
+	path, mimeType := attachment.Path, attachment.MimeType
+	if r.URL.Query().Get("thumbnail") == "1" {
+		if attachment.ThumbnailPath == "" {
+			http.Error(w, "Attachment has no thumbnail", http.StatusNotFound)
+			return
+		}
+		path, mimeType = attachment.ThumbnailPath, "image/jpeg"
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("❌ Error opening chat attachment:", err)
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(mimeType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private")
+	http.ServeContent(w, r, "", time.Time{}, file)
+}
+
+// makeThumbnail writes a JPEG no larger than thumbnailSize next to the image
+// at path and returns its path and the size of the original image.
+func makeThumbnail(path string) (string, int, int, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer in.Close()
+	header, _, err := image.DecodeConfig(in)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if header.Width*header.Height > maxThumbnailSource {
+		return "", 0, 0, fmt.Errorf("image too large: %dx%d", header.Width, header.Height)
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return "", 0, 0, err
+	}
+	src, _, err := image.Decode(in)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scale := min(1, float64(thumbnailSize)/float64(max(width, height)))
+	thumbWidth, thumbHeight := max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+
+	// nearest neighbour is plenty for a preview
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		for x := 0; x < thumbWidth; x++ {
+			thumb.Set(x, y, src.At(bounds.Min.X+x*width/thumbWidth, bounds.Min.Y+y*height/thumbHeight))
+		}
+	}
+
+	thumbPath := strings.TrimSuffix(path, filepath.Ext(path)) + "_thumb.jpg"
+	out, err := os.Create(thumbPath)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer out.Close()
+	if err := jpeg.Encode(out, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		os.Remove(thumbPath)
+		return "", 0, 0, err
+	}
+	return thumbPath, width, height, nil
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/internal/pubsub"
+	"social-network/internal/pubsub/pubsubtest"
+	ws "social-network/internal/websocket"
+	"social-network/internal/websocket/wstest"
+
+	"github.com/gorilla/websocket"
+)
+
+// startInstance runs a chat hub on its own connection to the pub/sub
+// server, as a second backend container would.
+func startInstance(t *testing.T, server *pubsubtest.RedisServer) *Hub {
+	t.Helper()
+	bus, err := pubsub.DialRedis(server.Addr, "")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	hub, err := NewHub(bus)
+	if err != nil {
+		t.Fatalf("new hub: %v", err)
+	}
+	go hub.Run()
+	return hub
+}
+
+func connect(hub *Hub, userID int) *Client {
+	client := &Client{id: hub.lastConnID.Add(1), userID: userID, hub: hub, send: make(chan outbound, 8)}
+	hub.register <- client
+	return client
+}
+
+func expectOutbound(t *testing.T, client *Client, contains string) outbound {
+	t.Helper()
+	select {
+	case out := <-client.send:
+		if !strings.Contains(string(out.payload), contains) {
+			t.Fatalf("received %s, want %s", out.payload, contains)
+		}
+		return out
+	case <-time.After(2 * time.Second):
+		t.Fatalf("nothing received, want %s", contains)
+	}
+	return outbound{}
+}
+
+func TestDirectMessageAcrossInstances(t *testing.T) {
+	server, err := pubsubtest.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	instanceA, instanceB := startInstance(t, server), startInstance(t, server)
+	receiver := connect(instanceA, 7)
+	senderOnA, senderOnB := connect(instanceA, 8), connect(instanceB, 8)
+
+	// the message sent through B reaches the receiver's socket on A and is
+	// marked delivered once written there
+	instanceB.publish(7, outbound{payload: []byte(`{"content":"hi from B"}`), messageID: 42}, nil)
+	out := expectOutbound(t, receiver, "hi from B")
+	if out.messageID != 42 {
+		t.Fatalf("message id %d, want 42", out.messageID)
+	}
+
+	// the echo to the sender's other sessions skips the sending one only
+	instanceB.publish(8, outbound{payload: []byte(`{"content":"echo"}`)}, senderOnB)
+	expectOutbound(t, senderOnA, "echo")
+	select {
+	case out := <-senderOnB.send:
+		t.Fatalf("the sending session got its own echo: %s", out.payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	instanceA.SendToUser(8, map[string]any{"type": "read", "reader_id": 7})
+	expectOutbound(t, senderOnA, `"read"`)
+	expectOutbound(t, senderOnB, `"read"`)
+}
+
+// startHub runs a hub on an in-memory bus until the test ends.
+func startHub(t *testing.T) *Hub {
+	t.Helper()
+	hub, err := NewHub(pubsub.NewMemory())
+	if err != nil {
+		t.Fatalf("new hub: %v", err)
+	}
+	wstest.Start(t, hub)
+	return hub
+}
+
+// TestHubChurn connects and disconnects clients, some too slow to keep up,
+// while messages and replies go through the hub. Run it with -race.
+func TestHubChurn(t *testing.T) {
+	hub := startHub(t)
+
+	wstest.Churn(25, 50, func(worker, round int) {
+		if worker >= 20 {
+			hub.publish(round%10+1, outbound{payload: []byte(`{"content":"churn"}`)}, nil)
+			return
+		}
+		userID := worker%10 + 1
+		client := &Client{id: hub.lastConnID.Add(1), userID: userID, hub: hub, send: make(chan outbound, 2)}
+		if !hub.join(client) {
+			t.Error("join refused by a running hub")
+			return
+		}
+		if round%2 == 0 {
+			go func() {
+				for range client.send {
+				}
+			}()
+		}
+		client.reply(map[string]any{"type": "ack"})
+		hub.SendToUser(userID%5+1, map[string]any{"type": "typing_start", "sender_id": userID})
+		hub.drop(client)
+	})
+}
+
+// TestHubChurnOverSockets connects users to their direct chats and leaves
+// again, through /ws/chat and through the gateway, while they type, and
+// expects none of them active once all sockets are closed.
+func TestHubChurnOverSockets(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	hub := startHub(t)
+	gateway := ws.NewGateway()
+	gateway.Mount("chat", hub, true)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/chat", func(w http.ResponseWriter, r *http.Request) { ServeWs(hub, w, r) })
+	mux.HandleFunc("/ws", gateway.ServeWs)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	const users = 4
+	headers := make([]http.Header, users)
+	for i := range headers {
+		headers[i] = wstest.Login(t, db, i+1, fmt.Sprintf("user%d", i+1))
+	}
+
+	wstest.Churn(users, 10, func(worker, round int) {
+		userID := worker + 1
+		typing := fmt.Sprintf(`{"type":"typing_start","receiver_id":%d}`, userID%users+1)
+		if round%2 == 0 {
+			conn, err := wstest.Dial(server, "/ws/chat", headers[worker])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, []byte(typing))
+			conn.Close()
+			return
+		}
+
+		conn, err := wstest.Dial(server, "/ws", headers[worker])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(ws.Envelope{Version: ws.ProtocolVersion, Type: "chat", Payload: []byte(typing)})
+		conn.WriteJSON(ws.Envelope{Version: ws.ProtocolVersion, Type: "ping", ID: "p"})
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			var envelope ws.Envelope
+			if err := conn.ReadJSON(&envelope); err != nil {
+				t.Errorf("user %d: %v", userID, err)
+				return
+			}
+			if envelope.Type == "pong" {
+				return
+			}
+		}
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for userID := 1; userID <= users; userID++ {
+		for hub.isUserActive(userID) {
+			if time.Now().After(deadline) {
+				t.Fatalf("user %d is still active after closing every socket", userID)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// TestServeWsRequiresSession refuses a socket without a session, and takes
+// the user from the session rather than from ?user_id.
+func TestServeWsRequiresSession(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	hub := startHub(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ServeWs(hub, w, r) }))
+	defer server.Close()
+	header := wstest.Login(t, db, 11, "mallory")
+	wstest.Login(t, db, 12, "victim")
+
+	if conn, err := wstest.Dial(server, "/?user_id=12", nil); err == nil {
+		conn.Close()
+		t.Fatal("connected without a session")
+	}
+	conn, err := wstest.Dial(server, "/?user_id=12", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for !hub.isUserActive(11) {
+		if time.Now().After(deadline) {
+			t.Fatal("the session user is not connected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if hub.isUserActive(12) {
+		t.Fatal("connected as the user of ?user_id")
+	}
+}
+
+func TestHubStop(t *testing.T) {
+	hub := startHub(t)
+	client := connect(hub, 7)
+
+	hub.Stop()
+	select {
+	case _, ok := <-client.send:
+		for ok {
+			_, ok = <-client.send
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the connection was not closed on stop")
+	}
+
+	// nothing blocks on a stopped hub
+	if hub.join(&Client{id: hub.lastConnID.Add(1), userID: 8, hub: hub, send: make(chan outbound, 1)}) {
+		t.Fatal("a stopped hub accepted a connection")
+	}
+	hub.SendToUser(7, map[string]any{"type": "read"})
+	client.reply(map[string]any{"type": "ack"})
+	hub.drop(client)
+}
+
+// TestReplaySkipsLiveMessages delivers a message live while the undelivered
+// ones are replayed on connect, in both orders, and expects it once.
+func TestReplaySkipsLiveMessages(t *testing.T) {
+	hub := startHub(t)
+	client := &Client{id: hub.lastConnID.Add(1), userID: 7, hub: hub, send: make(chan outbound, 8), live: make(map[int]bool)}
+	hub.register <- client
+	message := func(id int) outbound {
+		return outbound{payload: []byte(fmt.Sprintf(`{"id":%d}`, id)), messageID: id}
+	}
+
+	hub.publish(7, message(1), nil)
+	expectOutbound(t, client, `"id":1`)
+	hub.submit(directMessage{to: client, replay: []outbound{message(1), message(2)}})
+	expectOutbound(t, client, `"id":2`)
+	hub.publish(7, message(2), nil)
+	hub.publish(7, message(3), nil)
+	expectOutbound(t, client, `"id":3`)
+	select {
+	case out := <-client.send:
+		t.Fatalf("received %s twice", out.payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestReplayWrapsMessageRequests replays an undelivered message request as a
+// message_request, like a live one, and other messages as they are.
+func TestReplayWrapsMessageRequests(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	for userID, nickname := range map[int]string{1: "alice", 2: "stranger", 3: "friend"} {
+		wstest.Login(t, db, userID, nickname)
+	}
+	seed := []string{
+		`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES (1, 2, 1, 'hello?'), (2, 3, 1, 'hi')`,
+		`INSERT INTO message_requests (sender_id, receiver_id) VALUES (2, 1)`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hub := startHub(t)
+	client := &Client{id: hub.lastConnID.Add(1), userID: 1, hub: hub, send: make(chan outbound, 8), live: make(map[int]bool)}
+	hub.register <- client
+	client.replayUndelivered()
+	if out := expectOutbound(t, client, `"type":"message_request"`); out.messageID != 1 {
+		t.Fatalf("replayed message %d as a request, want 1", out.messageID)
+	}
+	if out := expectOutbound(t, client, `"content":"hi"`); out.messageID != 2 || strings.Contains(string(out.payload), "message_request") {
+		t.Fatalf("replayed %s, want message 2 as it is", out.payload)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/repositories"
+)
+
+// SearchChatsHandler searches the session user's direct and group chats for
+// the words in q, newest first. Optional filters: user_id (one conversation),
+// group_id (one group chat), channel_id (one channel of a group chat),
+// sender_id, and from/to as dates (to inclusive) or RFC 3339 times. Pages
+// with limit and offset, X-Has-More tells whether more results exist.
+func SearchChatsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	search := repositories.MessageSearch{UserID: userID, Query: query.Get("q")}
+	search.Limit, search.Offset = pageParams(r)
+	for name, dest := range map[string]*int{
+		"user_id": &search.PeerID, "group_id": &search.GroupID, "channel_id": &search.ChannelID, "sender_id": &search.SenderID,
+	} {
+		if value := query.Get(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				http.Error(w, "Invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*dest = id
+		}
+	}
+	if search.PeerID != 0 && (search.GroupID != 0 || search.ChannelID != 0) {
+		http.Error(w, "Use either user_id or group_id and channel_id", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if search.From, err = searchTime(query.Get("from"), false); err != nil {
+		http.Error(w, "Invalid from date", http.StatusBadRequest)
+		return
+	}
+	if search.To, err = searchTime(query.Get("to"), true); err != nil {
+		http.Error(w, "Invalid to date", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if search.GroupID != 0 && !requireGroupMember(w, db, userID, search.GroupID) {
+		return
+	}
+	if search.ChannelID != 0 && !requireChannelReader(w, db, userID, search.ChannelID) {
+		return
+	}
+
+	results, hasMore, err := repositories.NewChatRepository(db).SearchMessages(search)
+	if errors.Is(err, repositories.ErrEmptySearch) {
+		http.Error(w, "Search query is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("❌ Error searching chats:", err)
+		http.Error(w, "Failed to search chats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setHasMore(w, hasMore)
+	json.NewEncoder(w).Encode(results)
+}
+
+// searchTime parses a from/to bound. A bare date as the upper bound covers
+// that whole day.
+func searchTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -7,12 +7,20 @@ import (
 	"log"
 	"net/http"
 	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/pubsub"
 	"social-network/internal/repositories"
 	ws "social-network/internal/websocket"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	uuid "github.com/satori/go.uuid"
 )
 
 const (
@@ -20,55 +28,216 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512
+	// typingInterval rate-limits typing and presence events of one connection
+	typingInterval = time.Second
+	// replayLimit bounds the undelivered messages replayed on connect, older
+	// ones are left to the history endpoint
+	replayLimit = 200
+	// maxClientIDLength bounds the client generated message ids
+	maxClientIDLength = 64
 )
 
 var (
 	newline = []byte{'\n'}
 	space   = []byte{' '}
 )
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // ✅ Allows all frontend origins (e.g., localhost:5173)
-	},
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-}
 
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
+// NewHub creates the direct chat hub of this instance. Messages and
+// presence changes go through bus, so that they reach users connected to
+// other instances too.
+func NewHub(bus pubsub.PubSub) (*Hub, error) {
+	h := &Hub{
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		clients:    make(map[int]*Client), // ✅ Changed from `map[*Client]bool`
+		direct:     make(chan directMessage),
+		presence:   make(chan models.Presence),
+		quit:       make(chan struct{}),
+		clients:    make(map[int]map[*Client]bool), // ✅ Every connection of a user, by userID
+		bus:        bus,
+		instance:   uuid.NewV4().String(),
 	}
+	err := bus.Subscribe(chatTopic, func(data []byte) {
+		var message directMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			log.Println("❌ Invalid chat message from pub/sub:", err)
+			return
+		}
+		h.submit(message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = bus.Subscribe(presenceTopic, func(data []byte) {
+		var presence models.Presence
+		if err := json.Unmarshal(data, &presence); err != nil {
+			log.Println("❌ Invalid presence from pub/sub:", err)
+			return
+		}
+		select {
+		case h.presence <- presence:
+		case <-h.quit:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
 }
 
+// Run owns the connections of the hub: only Run reads or changes clients and
+// sends on or closes their send channels. It returns once Stop is called,
+// after closing every connection.
 func (h *Hub) Run() {
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client.userID] = client // ✅ Store by userID
+			if _, ok := h.clients[client.userID]; !ok {
+				h.clients[client.userID] = make(map[*Client]bool)
+			}
+			h.clients[client.userID][client] = true
 		case client := <-h.unregister:
-			if _, ok := h.clients[client.userID]; ok {
-				delete(h.clients, client.userID)
-				close(client.send)
+			h.removeClient(client)
+		case message := <-h.direct:
+			out := outbound{payload: message.Payload, messageID: message.MessageID}
+			if message.to != nil {
+				if !h.clients[message.to.userID][message.to] {
+					continue
+				}
+				if message.replay != nil {
+					h.replay(message.to, message.replay)
+				} else {
+					h.deliver(message.to, out)
+				}
+				continue
+			}
+			var except uint64
+			if message.Origin == h.instance {
+				except = message.Except
 			}
+			h.sendToClient(message.UserID, out, except)
+		case presence := <-h.presence:
+			viewers := make([]int, 0, len(h.clients))
+			for viewerID := range h.clients {
+				if viewerID != presence.UserID {
+					viewers = append(viewers, viewerID)
+				}
+			}
+			go h.announcePresence(presence, viewers)
+		case <-h.quit:
+			for _, clients := range h.clients {
+				for client := range clients {
+					h.removeClient(client)
+				}
+			}
+			return
 		}
 	}
 }
 
+// Stop shuts the hub down. What is sent to it afterwards is dropped.
+func (h *Hub) Stop() {
+	h.stopOnce.Do(func() { close(h.quit) })
+}
+
+func (h *Hub) stopped() bool {
+	select {
+	case <-h.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// join registers a connection, unless the hub is stopped.
+func (h *Hub) join(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.quit:
+		return false
+	}
+}
+
+func (h *Hub) drop(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.quit:
+	}
+}
+
+// submit hands a message to Run for delivery.
+func (h *Hub) submit(message directMessage) {
+	select {
+	case h.direct <- message:
+	case <-h.quit:
+	}
+}
+
+// SendToUser pushes an event to every chat socket of the user, on any
+// instance. It is safe to call from HTTP handlers.
+func (h *Hub) SendToUser(userID int, event any) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println("❌ Error encoding chat event:", err)
+		return
+	}
+	h.publish(userID, outbound{payload: payload}, nil)
+}
+
+// publish sends a message to every connection of userID on every instance,
+// but except.
+func (h *Hub) publish(userID int, message outbound, except *Client) {
+	data, _ := json.Marshal(directMessage{
+		UserID:    userID,
+		Payload:   message.payload,
+		MessageID: message.messageID,
+		Origin:    h.instance,
+		Except:    except.connID(),
+	})
+	if err := h.bus.Publish(chatTopic, data); err != nil {
+		log.Printf("❌ Failed to publish chat message for User %d: %v", userID, err)
+	}
+}
+
+// publishPresence tells every instance the current presence of userID. The
+// state is read under presenceMu so that the last event published carries
+// the newest state.
+func (h *Hub) publishPresence(userID int) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+	data, _ := json.Marshal(ws.UserPresence.Get(userID))
+	if err := h.bus.Publish(presenceTopic, data); err != nil {
+		log.Printf("❌ Failed to publish presence of User %d: %v", userID, err)
+	}
+}
+
+// announcePresence tells the viewers connected to this instance, if allowed
+// to see it, that a user's presence changed.
+func (h *Hub) announcePresence(presence models.Presence, viewers []int) {
+	db := config.GetDB()
+	payload, _ := json.Marshal(map[string]any{
+		"type":      "presence",
+		"user_id":   presence.UserID,
+		"status":    presence.Status,
+		"last_seen": presence.LastSeen,
+	})
+	for _, viewerID := range viewers {
+		if visible, err := ws.PresenceVisible(db, viewerID, presence.UserID); err != nil || !visible {
+			continue
+		}
+		h.submit(directMessage{UserID: viewerID, Payload: payload})
+	}
+}
+
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.leave()
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
-	db := config.GetDB()                       // Get the database connection
-	repo := repositories.NewChatRepository(db) // Initialize chat repository
-
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
@@ -77,57 +246,302 @@ func (c *Client) readPump() {
 			}
 			break
 		}
-		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
+		c.handle(bytes.TrimSpace(bytes.Replace(message, newline, space, -1)))
+	}
+}
 
-		// ✅ Convert raw message to structured JSON
-		var msg struct {
-			ReceiverID int    `json:"receiver_id"`
-			Content    string `json:"content"`
-		}
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Println("❌ Invalid message format:", err)
-			continue
+// leave unregisters the connection and updates the user's presence.
+func (c *Client) leave() {
+	c.hub.drop(c)
+	if ws.UserPresence.Disconnect(c.userID, true) {
+		c.hub.publishPresence(c.userID)
+	}
+}
+
+// handle runs one frame from the client, whichever socket it came through.
+func (c *Client) handle(message []byte) {
+	db := config.GetDB()                       // Get the database connection
+	repo := repositories.NewChatRepository(db) // Initialize chat repository
+
+	// ✅ Convert raw message to structured JSON
+	var msg struct {
+		Type       string `json:"type"` // empty for a chat message
+		ReceiverID int    `json:"receiver_id"`
+		Content    string `json:"content"`
+		Status     string `json:"status"`      // for "presence"
+		MessageID  int    `json:"message_id"`  // for "edit" and "unsend"
+		ReplyToID  int    `json:"reply_to_id"` // quotes an earlier message of the conversation
+		// uploads from POST /api/chat/attachments to send with the message
+		AttachmentIDs []int `json:"attachment_ids"`
+		// generated by the client, a resend with the same id is stored and delivered once
+		ClientID string `json:"client_id"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Println("❌ Invalid message format:", err)
+		return
+	}
+
+	switch msg.Type {
+	case "typing_start", "typing_stop":
+		c.forwardTyping(msg.Type, msg.ReceiverID)
+		return
+	case "edit", "unsend":
+		c.changeMessage(repo, msg.Type, msg.MessageID, msg.Content)
+		return
+	case "presence":
+		if c.limiter.Allow("presence") && ws.UserPresence.SetAway(c.userID, msg.Status == ws.PresenceAway) {
+			c.hub.publishPresence(c.userID)
 		}
-		log.Printf("📩 Received message: Sender %d -> Receiver %d: %s", c.userID, msg.ReceiverID, msg.Content)
+		return
+	}
+	log.Printf("📩 Received message: Sender %d -> Receiver %d: %s", c.userID, msg.ReceiverID, msg.Content)
 
-		// ✅ Save message to database
-		if err := repo.SaveMessage(c.userID, msg.ReceiverID, msg.Content); err != nil {
-			log.Println("❌ Failed to store message:", err)
-			continue
+	decision, err := policy.CheckMessage(db, c.userID, msg.ReceiverID)
+	if err != nil {
+		log.Println("❌ Failed to check messaging permission:", err)
+		return
+	}
+	if decision != policy.MessageAllowed && decision != policy.MessageRequest {
+		log.Printf("🚫 Message from User %d to User %d refused: %s", c.userID, msg.ReceiverID, decision)
+		c.sendError(decision, msg.ReceiverID)
+		return
+	}
+	isRequest := decision == policy.MessageRequest
+
+	if len(msg.ClientID) > maxClientIDLength {
+		c.sendError("invalid_client_id", msg.ReceiverID)
+		return
+	}
+
+	// ✅ Save message to database
+	saved, created, err := repo.SaveMessage(repositories.MessageDraft{
+		SenderID:      c.userID,
+		ReceiverID:    msg.ReceiverID,
+		Content:       msg.Content,
+		ReplyToID:     msg.ReplyToID,
+		AttachmentIDs: msg.AttachmentIDs,
+		ClientID:      msg.ClientID,
+	})
+	if err == repositories.ErrMessageNotFound {
+		c.sendError("reply_not_found", msg.ReceiverID)
+		return
+	}
+	if err == repositories.ErrAttachmentNotFound {
+		c.sendError("attachment_not_found", msg.ReceiverID)
+		return
+	}
+	if err != nil {
+		log.Println("❌ Failed to store message:", err)
+		return
+	}
+
+	c.reply(map[string]any{
+		"type":      "ack",
+		"client_id": saved.ClientID,
+		"id":        saved.ID,
+		"sent_at":   saved.SentAt,
+		"request":   isRequest,
+	})
+	if !created {
+		return // a resend, the first attempt was already forwarded
+	}
+
+	requests := repositories.NewMessageRequestRepository(db)
+	newRequest := false
+	if isRequest {
+		newRequest, err = requests.RecordRequest(c.userID, msg.ReceiverID)
+	} else {
+		err = requests.AcceptBetween(c.userID, msg.ReceiverID)
+	}
+	if err != nil {
+		log.Println("❌ Failed to update message request:", err)
+	}
+
+	formattedMessage, _ := json.Marshal(saved)
+	log.Printf("🚀 Sending message to User %d", msg.ReceiverID)
+
+	// Send message to the recipient and echo it to the sender's other sessions.
+	c.hub.publish(msg.ReceiverID, outbound{payload: receivedPayload(saved, isRequest), messageID: saved.ID}, nil)
+	c.hub.publish(c.userID, outbound{payload: formattedMessage}, c)
+	userData, err := repositories.NewUserRepository(db).GetUserDataById(c.userID)
+	if err != nil {
+		log.Println("Error retrieving userData:", err)
+		// http.Error(w, "Failed to retrieve userData", http.StatusInternalServerError)
+		return
+	} // ✅ **Send Notification ONLY if the recipient is NOT actively chatting**
+
+	if isRequest {
+		// requests are quiet until answered, only the first one notifies
+		if newRequest {
+			ws.SendNotificationFrom(c.userID, msg.ReceiverID, "message_request", fmt.Sprintf("%s sent you a message request", userData.Nickname))
 		}
+	} else if !c.hub.isUserActive(msg.ReceiverID) {
+		notificationMessage := fmt.Sprintf("New message from %s", userData.Nickname) // Assuming `c.username` stores the sender's name
+		ws.SendNotificationFrom(c.userID, msg.ReceiverID, "message", notificationMessage)
+	}
+}
 
-		formattedMessage, _ := json.Marshal(map[string]any{
-			"sender_id":   c.userID, // Attach sender ID
-			"receiver_id": msg.ReceiverID,
-			"content":     msg.Content,
-			"sent_at":     time.Now().Format(time.RFC3339),
-		})
-		log.Printf("🚀 Sending message to User %d", msg.ReceiverID)
+// forwardTyping passes a typing_start or typing_stop event on to receiverID,
+// at most once per typingInterval, if the sender may message them.
+func (c *Client) forwardTyping(eventType string, receiverID int) {
+	if !c.limiter.Allow(eventType + ":" + strconv.Itoa(receiverID)) {
+		return
+	}
+	if allowed, err := policy.CanMessage(config.GetDB(), c.userID, receiverID); err != nil || !allowed {
+		return
+	}
+	c.hub.SendToUser(receiverID, map[string]any{
+		"type":      eventType,
+		"sender_id": c.userID,
+	})
+}
 
-		// Send message to only the recipient
-		c.hub.sendToClient(msg.ReceiverID, formattedMessage)
-		repo := repositories.NewUserRepository(db)
-		userData, err := repo.GetUserDataById(c.userID)
-		if err != nil {
-			log.Println("Error retrieving userData:", err)
-			// http.Error(w, "Failed to retrieve userData", http.StatusInternalServerError)
+// changeMessage edits or unsends one of the client's messages and sends the
+// changed message to both sides of the conversation as a message_edited or
+// message_unsent event.
+func (c *Client) changeMessage(repo *repositories.ChatRepository, action string, messageID int, content string) {
+	var changed *models.ChatMessage
+	var err error
+	if action == "edit" {
+		if strings.TrimSpace(content) == "" {
+			c.sendMessageError("empty_content", messageID)
 			return
-		} // ✅ **Send Notification ONLY if the recipient is NOT actively chatting**
-
-		if !c.hub.isUserActive(msg.ReceiverID) {
-			notificationMessage := fmt.Sprintf("New message from %s", userData.Nickname) // Assuming `c.username` stores the sender's name
-			ws.SendNotification(msg.ReceiverID, "message", notificationMessage)
 		}
+		// editing is sending again, so it needs the same permission
+		if original, getErr := repo.GetMessage(messageID); getErr == nil && original.SenderID == c.userID {
+			allowed, err := policy.CanMessage(repo.DB, c.userID, *original.ReceiverID)
+			if err != nil {
+				log.Println("❌ Failed to check messaging permission:", err)
+				return
+			}
+			if !allowed {
+				c.sendMessageError("not_allowed", messageID)
+				return
+			}
+		}
+		changed, err = repo.EditMessage(c.userID, messageID, content)
+	} else {
+		changed, err = repo.UnsendMessage(c.userID, messageID)
+	}
+	switch {
+	case err == repositories.ErrMessageNotFound:
+		c.sendMessageError("message_not_found", messageID)
+		return
+	case err == repositories.ErrEditWindowClosed:
+		c.sendMessageError("edit_window_closed", messageID)
+		return
+	case err != nil:
+		log.Printf("❌ Failed to %s message %d: %v", action, messageID, err)
+		return
+	}
+
+	event := map[string]any{"type": "message_edited", "message": changed}
+	if action == "unsend" {
+		event["type"] = "message_unsent"
 	}
+	c.hub.SendToUser(*changed.ReceiverID, event)
+	c.hub.SendToUser(c.userID, event)
 }
 
-func (h *Hub) isUserActive(userID int) bool {
-	for _, client := range h.clients {
-		if client.userID == userID { // ✅ Correct comparison
-			return true
+// sendMessageError tells the client why it could not change messageID.
+func (c *Client) sendMessageError(reason string, messageID int) {
+	c.reply(map[string]any{
+		"type":       "error",
+		"error":      reason,
+		"message_id": messageID,
+	})
+}
+
+// sendError tells the sender why their message to receiverID was not delivered.
+func (c *Client) sendError(reason string, receiverID int) {
+	c.reply(map[string]any{
+		"type":        "error",
+		"error":       reason,
+		"receiver_id": receiverID,
+	})
+}
+
+// reply sends an event to this connection only, through Run as the hub may
+// be closing the connection meanwhile.
+func (c *Client) reply(event any) {
+	payload, _ := json.Marshal(event)
+	c.hub.submit(directMessage{to: c, Payload: payload})
+}
+
+// markDelivered records that a direct message reached its recipient and
+// tells the sender, the first time only.
+func (c *Client) markDelivered(messageID int) {
+	msg, first, err := repositories.NewChatRepository(config.GetDB()).MarkDelivered(messageID)
+	if err != nil {
+		log.Println("❌ Failed to mark message delivered:", err)
+		return
+	}
+	if !first {
+		return
+	}
+	c.hub.SendToUser(msg.SenderID, map[string]any{
+		"type":         "delivered",
+		"message_id":   msg.ID,
+		"receiver_id":  c.userID,
+		"delivered_at": msg.DeliveredAt,
+	})
+}
+
+// replayUndelivered queues the messages that arrived while the user had no
+// connection, through Run so it cannot race with the hub closing the client.
+// The client is registered first so that nothing sent meanwhile is missed,
+// Run skips what it already delivered live.
+func (c *Client) replayUndelivered() {
+	db := config.GetDB()
+	messages, err := repositories.NewChatRepository(db).GetUndelivered(c.userID, replayLimit)
+	if err != nil {
+		log.Println("❌ Failed to load undelivered messages:", err)
+	}
+	requesters, err := repositories.NewMessageRequestRepository(db).PendingSenders(c.userID)
+	if err != nil {
+		log.Println("❌ Failed to load pending message requests:", err)
+		messages = nil // they could land in the chats instead of the requests
+	}
+	replay := make([]outbound, 0, len(messages)) // empty but not nil, Run still ends the replay
+	for _, msg := range messages {
+		replay = append(replay, outbound{payload: receivedPayload(msg, requesters[msg.SenderID]), messageID: msg.ID})
+	}
+	c.hub.submit(directMessage{to: c, replay: replay})
+}
+
+// receivedPayload is a message as its receiver gets it. A request is wrapped
+// so it lands in the receiver's requests, not their chats.
+func receivedPayload(msg any, isRequest bool) []byte {
+	if isRequest {
+		payload, _ := json.Marshal(map[string]any{"type": "message_request", "message": msg})
+		return payload
+	}
+	payload, _ := json.Marshal(msg)
+	return payload
+}
+
+// replay queues the undelivered messages loaded on connect, but those the
+// client already got live, and stops recording the live ones.
+func (h *Hub) replay(client *Client, messages []outbound) {
+	live := client.live
+	client.live = nil
+	client.replayed = make(map[int]bool, len(messages))
+	for _, out := range messages {
+		if live[out.messageID] {
+			continue
+		}
+		h.deliver(client, out)
+		if !h.clients[client.userID][client] {
+			return // dropped for falling behind
 		}
+		client.replayed[out.messageID] = true
 	}
-	return false
+}
+
+// isUserActive tells whether the user has a direct chat socket open, on
+// any instance.
+func (h *Hub) isUserActive(userID int) bool {
+	return ws.UserPresence.Chatting(userID)
 }
 
 func (c *Client) writePump() {
@@ -138,7 +552,7 @@ func (c *Client) writePump() {
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
+		case out, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel.
@@ -149,11 +563,14 @@ func (c *Client) writePump() {
 			if err != nil {
 				return
 			}
-			w.Write(message)
-			log.Printf("📩 Writing message to User %d: %s", c.userID, string(message)) // ✅ Debugging log
+			w.Write(out.payload)
+			log.Printf("📩 Writing message to User %d: %s", c.userID, string(out.payload)) // ✅ Debugging log
 			if err := w.Close(); err != nil {
 				return
 			}
+			if out.messageID != 0 {
+				c.markDelivered(out.messageID)
+			}
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -163,56 +580,188 @@ func (c *Client) writePump() {
 	}
 }
 
+// pub/sub topics of the chat hubs of all instances
+const (
+	chatTopic     = "chat"
+	presenceTopic = "presence"
+)
+
 type Hub struct {
-	clients    map[int]*Client // ✅ Stores clients by userID instead of pointer
-	broadcast  chan []byte
+	clients    map[int]map[*Client]bool // ✅ A user may have several tabs or devices connected, Run only
 	register   chan *Client
 	unregister chan *Client
+	direct     chan directMessage
+	presence   chan models.Presence // presence changes, from any instance
+	quit       chan struct{}        // closed by Stop
+	stopOnce   sync.Once
+
+	bus        pubsub.PubSub
+	instance   string // tells this instance's messages apart on the bus
+	lastConnID atomic.Uint64
+	presenceMu sync.Mutex
 }
+
+// directMessage is what the hub delivers, as it travels on the bus.
+type directMessage struct {
+	UserID    int             `json:"user_id"`
+	Payload   json.RawMessage `json:"payload"`
+	MessageID int             `json:"message_id,omitempty"` // a direct message to mark delivered once written
+	// Except is a connection skipped, e.g. the session that sent the message,
+	// on the instance Origin that published it.
+	Origin string `json:"origin"`
+	Except uint64 `json:"except,omitempty"`
+
+	to     *Client    // only this local connection, instead of every connection of UserID
+	replay []outbound // with to: the undelivered messages loaded on connect
+}
+
+// outbound is what a client's writePump writes.
+type outbound struct {
+	payload   []byte
+	messageID int // a direct message to mark delivered once written
+}
+
 type Client struct {
-	userID int
-	hub    *Hub
-	conn   *websocket.Conn
-	send   chan []byte
+	id      uint64 // unique in this instance
+	userID  int
+	hub     *Hub
+	conn    *websocket.Conn // nil for a gateway subscription
+	send    chan outbound
+	limiter *ws.EventLimiter
+	// unsubscribed is set by Close before leaving, so that the gateway
+	// forwarder can tell an unsubscribe from the hub dropping a slow client
+	unsubscribed atomic.Bool
+	// the direct messages Run queued live before the replay of the
+	// undelivered ones, then those it replayed, so none is written twice
+	live, replayed map[int]bool
 }
 
-func (h *Hub) sendToClient(receiverID int, message []byte) {
-	if client, exists := h.clients[receiverID]; exists {
-		select {
-		case client.send <- message:
-			log.Printf("📩 Successfully sent message to User %d", receiverID)
-		default:
-			log.Printf("❌ Failed to send message to User %d (client closed)", receiverID)
-			close(client.send)
-			delete(h.clients, receiverID)
-		}
-	} else {
+// sendToClient fans a message out to every local connection of receiverID
+// but the one with id except.
+func (h *Hub) sendToClient(receiverID int, message outbound, except uint64) {
+	if len(h.clients[receiverID]) == 0 {
 		log.Printf("⚠️ No active connection found for User %d", receiverID)
+		return
+	}
+	for client := range h.clients[receiverID] {
+		if client.id != except {
+			h.deliver(client, message)
+		}
+	}
+}
+
+// connID returns the id of the connection, 0 for none.
+func (c *Client) connID() uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.id
+}
+
+// deliver queues a message on one connection, dropping the connection if it
+// is not keeping up. A direct message the client already got is skipped.
+func (h *Hub) deliver(client *Client, message outbound) {
+	if message.messageID != 0 {
+		if client.replayed[message.messageID] {
+			return
+		}
+		if client.live != nil {
+			client.live[message.messageID] = true
+		}
+	}
+	select {
+	case client.send <- message:
+		log.Printf("📩 Successfully sent message to User %d", client.userID)
+	default:
+		log.Printf("❌ Failed to send message to User %d (client closed)", client.userID)
+		h.removeClient(client)
+	}
+}
+
+// removeClient forgets one connection and closes its send channel, once.
+func (h *Hub) removeClient(client *Client) {
+	clients, ok := h.clients[client.userID]
+	if !ok || !clients[client] {
+		return
+	}
+	delete(clients, client)
+	close(client.send)
+	if len(clients) == 0 {
+		delete(h.clients, client.userID)
 	}
 }
 
 // serveWs handles websocket requests from the peer.
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request) {
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true } // ✅ Allow frontend
-
-	conn, err := upgrader.Upgrade(w, r, nil)
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	conn, err := ws.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	userIDStr := r.URL.Query().Get("user_id")
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil || userID == 0 {
-		log.Println("❌ Invalid user ID in WebSocket connection")
+
+	client := &Client{id: hub.lastConnID.Add(1), hub: hub, conn: conn, send: make(chan outbound, 256), userID: userID, limiter: ws.NewEventLimiter(typingInterval), live: make(map[int]bool)}
+
+	log.Printf("✅ User %d connected to WebSocket", userID)
+
+	if !hub.join(client) {
 		conn.Close()
 		return
 	}
+	if ws.UserPresence.Connect(userID, true) {
+		hub.publishPresence(userID)
+	}
+	untrack := ws.UserConnections.TrackConn(userID, conn)
+	go client.writePump()
+	go func() {
+		defer untrack()
+		client.readPump()
+	}()
+	go client.replayUndelivered()
+}
 
-	client := &Client{hub: hub, conn: conn, send: make(chan []byte, 256), userID: userID}
+// Subscribe joins a gateway session to the user's direct chats. The client
+// is a Subscription itself.
+func (h *Hub) Subscribe(s *ws.Session, _ int) (ws.Subscription, error) {
+	client := &Client{id: h.lastConnID.Add(1), hub: h, send: make(chan outbound, 256), userID: s.UserID, limiter: ws.NewEventLimiter(typingInterval), live: make(map[int]bool)}
+	if !h.join(client) {
+		return nil, ws.ErrHubStopped
+	}
+	if ws.UserPresence.Connect(s.UserID, true) {
+		h.publishPresence(s.UserID)
+	}
 
-	log.Printf("✅ User %d connected to WebSocket", userID)
+	go func() {
+		for out := range client.send {
+			var written func()
+			if messageID := out.messageID; messageID != 0 {
+				written = func() { client.markDelivered(messageID) }
+			}
+			s.Push("chat", out.payload, written)
+		}
+		switch {
+		case client.unsubscribed.Load():
+		case h.stopped():
+			s.Kick(websocket.CloseGoingAway, "shutting down")
+		default:
+			s.Kick(websocket.CloseTryAgainLater, "falling behind")
+		}
+	}()
+	go client.replayUndelivered()
+	return client, nil
+}
 
-	hub.register <- client
-	go client.writePump()
-	go client.readPump()
+// Handle runs a frame the client sent through the gateway.
+func (c *Client) Handle(payload []byte) {
+	c.handle(payload)
+}
+
+// Close leaves the direct chats.
+func (c *Client) Close() {
+	c.unsubscribed.Store(true)
+	c.leave()
 }
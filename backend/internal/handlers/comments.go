@@ -6,31 +6,47 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
 	"social-network/internal/models"
+	"social-network/internal/policy"
 	"social-network/internal/repositories"
 	"social-network/internal/websocket"
 )
 
+// GetCommentsForPostHandler returns a page of the post's comment threads
 func GetCommentsForPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	postID, err := strconv.Atoi(r.URL.Query().Get("post_id"))
 	if err != nil || postID == 0 {
 		http.Error(w, "Invalid post ID", http.StatusBadRequest)
 		return
 	}
+	limit, offset := pageParams(r)
 
 	db := config.GetDB()
+	if visible, err := policy.CanViewPost(db, user.ID, postID); err != nil || !visible {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	repo := repositories.NewCommentRepository(db)
 
-	comments, err := repo.GetCommentsForPost(postID)
+	comments, total, err := repo.GetCommentsForPost(postID, user.ID, limit, offset)
 	if err != nil {
 		log.Println("Error retrieving comments:", err)
 		http.Error(w, "Failed to retrieve comments", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	setTotalCount(w, total)
 	json.NewEncoder(w).Encode(comments)
 }
 
@@ -50,8 +66,27 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 	comment.Nickname = user.Nickname
 
 	db := config.GetDB()
+	if allowed, err := policy.CanComment(db, user.ID, comment.PostID); err != nil || !allowed {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
 	commentRepo := repositories.NewCommentRepository(db)
 
+	// a reply must answer a comment of the same post
+	var parent *models.Comment
+	if comment.ParentID != nil {
+		var err error
+		parent, err = commentRepo.GetComment(*comment.ParentID)
+		if err != nil || parent.PostID != comment.PostID {
+			http.Error(w, "Parent comment not found", http.StatusBadRequest)
+			return
+		}
+		if err := checkTargetAccess(db, user.ID, models.TargetComment, parent.ID); err != nil {
+			writeReactionError(w, err)
+			return
+		}
+	}
+
 	err := commentRepo.AddComment(&comment)
 	if err != nil {
 		log.Println("Error adding comment:", err)
@@ -59,7 +94,7 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newComment, err := commentRepo.GetLastInsertedComment(comment.UserID, comment.PostID)
+	newComment, err := commentRepo.GetComment(comment.ID)
 	if err != nil {
 		log.Println("Error retrieving new comment:", err)
 		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
@@ -72,9 +107,109 @@ func CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "cannot retreive post creator id", http.StatusInternalServerError)
 		return
 	}
-	notificationMsg := user.Nickname + " commented on your post."
 
-	websocket.SendNotification(postCreatorID, "comment", notificationMsg)
+	if parent != nil && parent.UserID != user.ID {
+		websocket.SendNotificationFrom(user.ID, parent.UserID, "reply", user.Nickname+" replied to your comment.")
+	}
+	if postCreatorID != user.ID && (parent == nil || parent.UserID != postCreatorID) {
+		notificationMsg := user.Nickname + " commented on your post."
+		websocket.SendNotificationFrom(user.ID, postCreatorID, "comment", notificationMsg)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(newComment)
 }
+
+// UpdateCommentHandler lets the author edit their comment
+func UpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" {
+		http.Error(w, "Comment cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	repo := repositories.NewCommentRepository(config.GetDB())
+	comment, err := repo.GetComment(req.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving comment:", err)
+		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
+		return
+	}
+	if comment.UserID != user.ID {
+		http.Error(w, "Only the author can edit this comment", http.StatusForbidden)
+		return
+	}
+
+	if err := repo.UpdateComment(req.ID, req.Content); err != nil {
+		log.Println("❌ Error updating comment:", err)
+		http.Error(w, "Failed to update comment", http.StatusInternalServerError)
+		return
+	}
+
+	comment, err = repo.GetComment(req.ID)
+	if err != nil {
+		log.Println("❌ Error retrieving comment:", err)
+		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteCommentHandler deletes a comment and its replies. The comment's author
+// and the author of the post it belongs to may delete it.
+func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || commentID == 0 {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	repo := repositories.NewCommentRepository(db)
+	comment, err := repo.GetComment(commentID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving comment:", err)
+		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
+		return
+	}
+
+	var postCreatorID int
+	db.QueryRow("SELECT user_id FROM posts WHERE id = ?", comment.PostID).Scan(&postCreatorID)
+	if comment.UserID != user.ID && postCreatorID != user.ID {
+		http.Error(w, "You cannot delete this comment", http.StatusForbidden)
+		return
+	}
+
+	if err := repo.DeleteComment(commentID); err != nil {
+		log.Println("❌ Error deleting comment:", err)
+		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted"})
+}
@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
 	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/repositories"
 	"social-network/internal/websocket"
 )
 
@@ -53,6 +57,17 @@ func FollowUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blocked, err := policy.IsBlocked(db, user.ID, UsertoFollow.ID)
+	if err != nil {
+		log.Println("❌ Error checking blocks:", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "You cannot follow this user", http.StatusForbidden)
+		return
+	}
+
 	// Determine follow status based on privacy setting
 	status := "pending"
 	if !UsertoFollow.IsPrivate {
@@ -61,7 +76,10 @@ func FollowUser(w http.ResponseWriter, r *http.Request) {
 
 	// Insert follow request
 	_, err = db.Exec("INSERT INTO followers (follower_id, following_id, status) VALUES (?, ?, ?)", user.ID, UsertoFollow.ID, status)
-	if err != nil {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		http.Error(w, "You already follow or requested to follow this user", http.StatusConflict)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to follow user", http.StatusInternalServerError)
 		return
 	}
@@ -74,7 +92,7 @@ func FollowUser(w http.ResponseWriter, r *http.Request) {
 
 	// InsertoNotif(w, UsertoFollow.ID, "follow", notificationMsg)
 
-	websocket.SendNotification(UsertoFollow.ID, "follow", notificationMsg)
+	websocket.SendNotificationFrom(user.ID, UsertoFollow.ID, "follow", notificationMsg)
 
 	// Send response
 	response := map[string]string{"status": status, "message": "Follow request sent successfully"}
@@ -143,12 +161,13 @@ func UnfollowUser(w http.ResponseWriter, r *http.Request) {
 	// Insert notification for the unfollowed user
 	// InsertoNotif(w, requestData.ID, "unfollow", notificationMsg)
 
-	websocket.SendNotification(requestData.ID, "unfollow", notificationMsg)
+	websocket.SendNotificationFrom(user.ID, requestData.ID, "unfollow", notificationMsg)
 
 	response := map[string]string{"status": "unfollowed", "message": "Follow request removed"}
 	json.NewEncoder(w).Encode(response)
 }
 
+// GetFollowers lists the followers of ?user_id (the session user by default)
 func GetFollowers(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
@@ -157,34 +176,31 @@ func GetFollowers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	ownerID, ok := networkOwner(w, r, db, user.ID)
+	if !ok {
+		return
+	}
+	limit, offset := pageParams(r)
 
-	rows, err := db.Query(`
-        SELECT u.id, u.nickname, u.first_name, u.last_name 
-        FROM followers f 
-        JOIN users u ON f.follower_id = u.id 
-        WHERE f.following_id = ? AND f.status = 'accepted'
-    `, user.ID)
+	followers, total, err := repositories.NewFollowRepository(db).GetFollowers(ownerID, user.ID, limit, offset)
 	if err != nil {
+		log.Println("❌ Error fetching followers:", err)
 		http.Error(w, "Failed to retrieve followers", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var followers []models.User
-	for rows.Next() {
-		var follower models.User
-		err := rows.Scan(&follower.ID, &follower.Nickname, &follower.FirstName, &follower.LastName)
-		if err != nil {
-			log.Println("Error scanning follower:", err)
-			continue
-		}
-		followers = append(followers, follower)
+	if err := visibleNetwork(db, user.ID, followers); err != nil {
+		log.Println("❌ Error applying profile privacy:", err)
+		http.Error(w, "Failed to retrieve followers", http.StatusInternalServerError)
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	setTotalCount(w, total)
 	json.NewEncoder(w).Encode(followers)
 }
 
-// GetFollowing - Retrieve users the logged-in user follows
+// GetFollowing lists the users ?user_id (the session user by default)
+// follows. The owner also sees their pending requests.
 func GetFollowing(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
@@ -193,39 +209,31 @@ func GetFollowing(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	ownerID, ok := networkOwner(w, r, db, user.ID)
+	if !ok {
+		return
+	}
+	limit, offset := pageParams(r)
 
-	rows, err := db.Query(`
-        SELECT u.id, u.nickname, u.first_name, u.last_name, f.status 
-        FROM followers f 
-        JOIN users u ON f.following_id = u.id 
-        WHERE f.follower_id = ?
-    `, user.ID)
+	following, total, err := repositories.NewFollowRepository(db).GetFollowing(ownerID, user.ID, ownerID == user.ID, limit, offset)
 	if err != nil {
+		log.Println("❌ Error fetching following:", err)
 		http.Error(w, "Failed to retrieve following list", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var following []struct {
-		models.User
-		Status string `json:"status"`
-	}
-	for rows.Next() {
-		var follow struct {
-			models.User
-			Status string `json:"status"`
-		}
-		err := rows.Scan(&follow.ID, &follow.Nickname, &follow.FirstName, &follow.LastName, &follow.Status)
-		if err != nil {
-			log.Println("Error scanning following:", err)
-			continue
-		}
-		following = append(following, follow)
+	if err := visibleNetwork(db, user.ID, following); err != nil {
+		log.Println("❌ Error applying profile privacy:", err)
+		http.Error(w, "Failed to retrieve following list", http.StatusInternalServerError)
+		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	setTotalCount(w, total)
 	json.NewEncoder(w).Encode(following)
 }
 
+// GetFollowCounts returns the follower and following counts of ?user_id
+// (the session user by default)
 func GetFollowCounts(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
@@ -234,21 +242,16 @@ func GetFollowCounts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
-
-	var followerCount, followingCount int
-
-	// Get number of followers
-	err := db.QueryRow("SELECT COUNT(*) FROM followers WHERE following_id = ? AND status = 'accepted'", user.ID).Scan(&followerCount)
-	if err != nil {
-		log.Println("Error fetching followers count:", err)
-		followerCount = 0
+	ownerID, ok := networkOwner(w, r, db, user.ID)
+	if !ok {
+		return
 	}
 
-	// Get number of people the user is following
-	err = db.QueryRow("SELECT COUNT(*) FROM followers WHERE follower_id = ?", user.ID).Scan(&followingCount)
+	followerCount, followingCount, err := repositories.NewFollowRepository(db).GetFollowCounts(ownerID)
 	if err != nil {
-		log.Println("Error fetching following count:", err)
-		followingCount = 0
+		log.Println("❌ Error fetching follow counts:", err)
+		http.Error(w, "Failed to retrieve follow counts", http.StatusInternalServerError)
+		return
 	}
 
 	response := map[string]int{
@@ -260,6 +263,90 @@ func GetFollowCounts(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// RemoveFollower makes a user stop following the session user. Used to review
+// followers after going private, or at any time.
+func RemoveFollower(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var follower models.User
+	if err := json.NewDecoder(r.Body).Decode(&follower); err != nil || follower.ID == 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	err := repositories.NewFollowRepository(config.GetDB()).RemoveFollower(user.ID, follower.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "This user does not follow you", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error removing follower:", err)
+		http.Error(w, "Failed to remove follower", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Follower removed"})
+}
+
+// networkOwner reads whose network is requested from ?user_id, defaulting to
+// the viewer. A private network is only shown to its owner and followers.
+func networkOwner(w http.ResponseWriter, r *http.Request, db *sql.DB, viewerID int) (int, bool) {
+	param := r.URL.Query().Get("user_id")
+	if param == "" {
+		return viewerID, true
+	}
+	ownerID, err := strconv.Atoi(param)
+	if err != nil || ownerID == 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if ownerID == viewerID {
+		return ownerID, true
+	}
+
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, ownerID).Scan(&exists); err != nil {
+		log.Println("❌ Database error:", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	blocked, err := policy.IsBlocked(db, viewerID, ownerID)
+	if err != nil {
+		log.Println("❌ Error checking blocks:", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !exists || blocked {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, false
+	}
+	allowed, err := policy.CanViewProfile(db, viewerID, ownerID)
+	if err != nil {
+		log.Println("❌ Database error:", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !allowed {
+		http.Error(w, "This account is private", http.StatusForbidden)
+		return 0, false
+	}
+	return ownerID, true
+}
+
+// visibleNetwork replaces every listed user with what viewerID may see of them
+func visibleNetwork(db *sql.DB, viewerID int, users []models.NetworkUser) error {
+	for i := range users {
+		visible, err := policy.ProfileFor(db, viewerID, &users[i].User)
+		if err != nil {
+			return err
+		}
+		users[i].User = *visible
+	}
+	return nil
+}
+
 func GetFollowStatus(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
@@ -294,6 +381,7 @@ func GetFollowStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// UpdateFollowRequest accepts or rejects one follow request sent to the session user
 func UpdateFollowRequest(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
@@ -302,48 +390,96 @@ func UpdateFollowRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var requestData struct {
-		RequestID  int    `json:"requestId"`
-		Status     string `json:"status"`
-		FollowerID int    `json:"followerId"`
+		RequestID int    `json:"requestId"`
+		Status    string `json:"status"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.RequestID == 0 {
 		log.Println("❌ Invalid input:", err)
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	db := config.GetDB()
+	resolved, ok := resolveFollowRequests(w, user, []int{requestData.RequestID}, requestData.Status)
+	if !ok {
+		return
+	}
+	if len(resolved) == 0 {
+		http.Error(w, "Follow request not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("📢 Follow request %d marked as %s", requestData.RequestID, requestData.Status)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Follow request updated successfully"})
+}
+
+// BulkUpdateFollowRequests accepts or rejects many follow requests sent to the
+// session user at once, either the listed request_ids or all pending ones.
+func BulkUpdateFollowRequests(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var requestData struct {
+		RequestIDs []int  `json:"request_ids"`
+		All        bool   `json:"all"`
+		Status     string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
 
-	if requestData.Status == "accepted" {
-		// ✅ Update status to 'accepted'
-		_, err := db.Exec(`UPDATE followers SET status = 'accepted' WHERE id = ?`, requestData.RequestID)
+	if requestData.All {
+		ids, err := repositories.NewFollowRepository(config.GetDB()).PendingRequestIDs(user.ID)
 		if err != nil {
-			log.Println("❌ Failed to update follow request:", err)
-			http.Error(w, "Failed to update request", http.StatusInternalServerError)
+			log.Println("❌ Error fetching follow requests:", err)
+			http.Error(w, "Failed to fetch follow requests", http.StatusInternalServerError)
 			return
 		}
-	} else if requestData.Status == "rejected" {
-		// ✅ Delete request if rejected
-		_, err := db.Exec(`DELETE FROM followers WHERE id = ?`, requestData.RequestID)
-		if err != nil {
-			log.Println("❌ Failed to delete follow request:", err)
-			http.Error(w, "Failed to delete request", http.StatusInternalServerError)
-			return
+		requestData.RequestIDs = ids
+	}
+
+	resolved, ok := resolveFollowRequests(w, user, requestData.RequestIDs, requestData.Status)
+	if !ok {
+		return
+	}
+	notFound := []int{}
+	for _, id := range requestData.RequestIDs {
+		if _, done := resolved[id]; !done {
+			notFound = append(notFound, id)
 		}
 	}
 
-	// ✅ Send notification to the follower
-	var notificationMessage string
-	if requestData.Status == "accepted" {
-		notificationMessage = fmt.Sprintf("%s accepted your follow request!", user.Nickname)
-	} else {
-		notificationMessage = fmt.Sprintf("%s rejected your follow request.", user.Nickname)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"updated": len(resolved), "not_found": notFound})
+}
+
+// resolveFollowRequests applies status ("accepted" or "rejected") to the
+// session user's pending requests among requestIDs and notifies the senders.
+func resolveFollowRequests(w http.ResponseWriter, user models.User, requestIDs []int, status string) (map[int]int, bool) {
+	if status != "accepted" && status != "rejected" {
+		http.Error(w, "Status must be accepted or rejected", http.StatusBadRequest)
+		return nil, false
 	}
-	websocket.SendNotification(requestData.FollowerID, "follow", notificationMessage)
 
-	log.Printf("📢 Follow request %d marked as %s", requestData.RequestID, requestData.Status)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Follow request updated successfully"})
+	resolved, err := repositories.NewFollowRepository(config.GetDB()).ResolveRequests(user.ID, requestIDs, status == "accepted")
+	if err != nil {
+		log.Println("❌ Failed to update follow requests:", err)
+		http.Error(w, "Failed to update request", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	notificationMessage := fmt.Sprintf("%s accepted your follow request!", user.Nickname)
+	if status == "rejected" {
+		notificationMessage = fmt.Sprintf("%s rejected your follow request.", user.Nickname)
+	}
+	for _, followerID := range resolved {
+		websocket.SendNotificationFrom(user.ID, followerID, "follow", notificationMessage)
+	}
+	return resolved, true
 }
 
 func GetFollowRequests(w http.ResponseWriter, r *http.Request) {
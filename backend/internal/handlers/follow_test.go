@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"social-network/internal/models"
+	"social-network/internal/websocket/wstest"
+)
+
+// TestNetworkPrivacy shows the followers and following of a private user to
+// their followers only, and pending requests to the owner only.
+func TestNetworkPrivacy(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	alice := wstest.Login(t, db, 1, "alice")
+	bob := wstest.Login(t, db, 2, "bob")
+	carol := wstest.Login(t, db, 3, "carol")
+	wstest.Login(t, db, 4, "dave")
+	seed := []string{
+		`UPDATE users SET is_private = 1 WHERE id IN (2, 4)`,
+		`INSERT INTO followers (follower_id, following_id, status) VALUES
+			(3, 2, 'accepted'), (4, 2, 'pending'), (2, 1, 'accepted'), (2, 4, 'pending'), (3, 1, 'accepted')`,
+		`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (1, 3)`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(handler http.HandlerFunc, target string, header http.Header) []models.NetworkUser {
+		t.Helper()
+		w := serve(handler, "GET", target, header, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", target, w.Code, w.Body)
+		}
+		var users []models.NetworkUser
+		if err := json.NewDecoder(w.Body).Decode(&users); err != nil {
+			t.Fatal(err)
+		}
+		return users
+	}
+
+	for target, handler := range map[string]http.HandlerFunc{
+		"/api/followers?user_id=2":     GetFollowers,
+		"/api/following?user_id=2":     GetFollowing,
+		"/api/follow-counts?user_id=2": GetFollowCounts,
+	} {
+		if w := serve(handler, "GET", target, alice, ""); w.Code != http.StatusForbidden {
+			t.Errorf("%s as a non-follower: %d, want 403", target, w.Code)
+		}
+	}
+	if w := serve(GetFollowers, "GET", "/api/followers?user_id=1", carol, ""); w.Code != http.StatusNotFound {
+		t.Errorf("the followers of somebody who blocked carol: %d, want 404", w.Code)
+	}
+
+	followers := list(GetFollowers, "/api/followers?user_id=2", carol)
+	if len(followers) != 1 || followers[0].ID != 3 {
+		t.Errorf("followers of bob seen by carol: %+v, want carol, without the pending request", followers)
+	}
+	following := list(GetFollowing, "/api/following?user_id=2", carol)
+	if len(following) != 1 || following[0].ID != 1 || !following[0].FollowedByViewer || following[0].Status != "accepted" {
+		t.Errorf("following of bob seen by carol: %+v, want alice, followed by carol", following)
+	}
+	if own := list(GetFollowing, "/api/following", bob); len(own) != 2 {
+		t.Errorf("bob's own following: %+v, want alice and the request to dave", own)
+	} else {
+		for _, user := range own {
+			if user.ID == 4 && (user.Status != "pending" || user.Email != "") {
+				t.Errorf("the pending request to dave: %+v, want a pending minimal card", user)
+			}
+		}
+	}
+
+	w := serve(GetFollowCounts, "GET", "/api/follow-counts?user_id=2", carol, "")
+	var counts map[string]int
+	if err := json.NewDecoder(w.Body).Decode(&counts); err != nil {
+		t.Fatal(err)
+	}
+	if counts["followers"] != 1 || counts["following"] != 1 {
+		t.Errorf("counts of bob: %v, want 1 and 1, pending requests left out", counts)
+	}
+}
+
+// TestBulkUpdateFollowRequests resolves the session user's own requests and
+// reports the others as not found.
+func TestBulkUpdateFollowRequests(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	alice := wstest.Login(t, db, 1, "alice")
+	wstest.Login(t, db, 2, "bob")
+	wstest.Login(t, db, 3, "carol")
+	_, err := db.Exec(`INSERT INTO followers (id, follower_id, following_id, status) VALUES
+		(1, 2, 1, 'pending'), (2, 3, 1, 'pending'), (3, 1, 2, 'pending')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(BulkUpdateFollowRequests, "POST", "/api/follow-requests/bulk", alice, `{"request_ids":[1,3],"status":"accepted"}`)
+	var result struct {
+		Updated  int   `json:"updated"`
+		NotFound []int `json:"not_found"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Updated != 1 || len(result.NotFound) != 1 || result.NotFound[0] != 3 {
+		t.Fatalf("bulk accept: %+v, want 1 updated and request 3 not found", result)
+	}
+	if w := serve(BulkUpdateFollowRequests, "POST", "/api/follow-requests/bulk", alice, `{"all":true,"status":"maybe"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("an unknown status: %d, want 400", w.Code)
+	}
+	if w := serve(UpdateFollowRequest, "POST", "/api/update-follow-request", alice, `{"requestId":3,"status":"accepted"}`); w.Code != http.StatusNotFound {
+		t.Errorf("accepting the request to bob: %d, want 404", w.Code)
+	}
+	serve(BulkUpdateFollowRequests, "POST", "/api/follow-requests/bulk", alice, `{"all":true,"status":"rejected"}`)
+	if n := count(t, db, `SELECT COUNT(*) FROM followers WHERE following_id = 1 AND status = 'pending'`); n != 0 {
+		t.Errorf("%d requests left after rejecting all", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM followers`); n != 2 {
+		t.Errorf("%d follows, want the accepted one and the request to bob", n)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
 	"social-network/internal/models"
+	"social-network/internal/policy"
 	"social-network/internal/repositories"
 )
 
@@ -229,3 +230,19 @@ func CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]any{"message": "Group created successfully", "group_id": group.ID})
 }
+
+// requireGroupMember writes a 403 and returns false unless userID may act in
+// the group under policy.CanActInGroup.
+func requireGroupMember(w http.ResponseWriter, db *sql.DB, userID, groupID int) bool {
+	allowed, err := policy.CanActInGroup(db, userID, groupID)
+	if err != nil {
+		log.Println("❌ Error checking group membership:", err)
+		http.Error(w, "Failed to check group membership", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "You are not a member of this group", http.StatusForbidden)
+		return false
+	}
+	return true
+}
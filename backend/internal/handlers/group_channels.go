@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/repositories"
+	ws "social-network/internal/websocket"
+)
+
+// requireChannelReader writes a 403 and returns false unless userID may read
+// the group chat channel under policy.CanReadChannel.
+func requireChannelReader(w http.ResponseWriter, db *sql.DB, userID, channelID int) bool {
+	allowed, err := policy.CanReadChannel(db, userID, channelID)
+	if err != nil {
+		log.Println("❌ Error checking channel access:", err)
+		http.Error(w, "Failed to check channel access", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, "You cannot access this channel", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// readableChannel returns the channel channelID of the group, or the group's
+// default channel when channelID is 0, if userID may read it. Otherwise it
+// writes the error and returns nil.
+func readableChannel(w http.ResponseWriter, db *sql.DB, userID, groupID, channelID int) *models.GroupChannel {
+	channels := repositories.NewGroupChannelRepository(db)
+	var channel *models.GroupChannel
+	var err error
+	if channelID != 0 {
+		channel, err = channels.GetChannel(channelID)
+	} else {
+		channel, err = channels.DefaultChannel(groupID)
+	}
+	if err == nil && groupID != 0 && channel.GroupID != groupID {
+		err = repositories.ErrChannelNotFound
+	}
+	if errors.Is(err, repositories.ErrChannelNotFound) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Println("❌ Error retrieving channel:", err)
+		http.Error(w, "Failed to retrieve channel", http.StatusInternalServerError)
+		return nil
+	}
+	if !requireChannelReader(w, db, userID, channel.ID) {
+		return nil
+	}
+	return channel
+}
+
+// adminChannel returns the channel if userID is the admin of its group.
+// Otherwise it writes the error and returns nil.
+func adminChannel(w http.ResponseWriter, db *sql.DB, userID, channelID int) *models.GroupChannel {
+	channel, err := repositories.NewGroupChannelRepository(db).GetChannel(channelID)
+	if errors.Is(err, repositories.ErrChannelNotFound) {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		log.Println("❌ Error retrieving channel:", err)
+		http.Error(w, "Failed to retrieve channel", http.StatusInternalServerError)
+		return nil
+	}
+	if !requireGroupAdmin(w, db, userID, channel.GroupID) {
+		return nil
+	}
+	return channel
+}
+
+// requireGroupAdmin writes a 403 and returns false unless userID is the
+// group's admin.
+func requireGroupAdmin(w http.ResponseWriter, db *sql.DB, userID, groupID int) bool {
+	isAdmin, err := repositories.NewGroupRepository(db).IsUserGroupAdmin(userID, groupID)
+	if err != nil {
+		log.Println("❌ Error checking group admin:", err)
+		http.Error(w, "Failed to check group admin", http.StatusInternalServerError)
+		return false
+	}
+	if !isAdmin {
+		http.Error(w, "Only the group admin can do this", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// GetGroupChannelsHandler lists the channels of group_id the session user
+// can read, with their unread count and last message.
+func GetGroupChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+	if err != nil || groupID == 0 {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if !requireGroupMember(w, db, userID, groupID) {
+		return
+	}
+	channels, err := repositories.NewGroupChannelRepository(db).ListChannels(userID, groupID)
+	if err != nil {
+		log.Println("❌ Error retrieving group channels:", err)
+		http.Error(w, "Failed to retrieve channels", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(channels)
+}
+
+// CreateGroupChannelHandler lets the group admin add a channel to the group
+// chat: {"group_id", "name", "private", "member_ids"}, the members only for a
+// private channel. A new public channel is announced in the default one.
+func CreateGroupChannelHandler(hub *ws.GroupHub, w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		GroupID   int    `json:"group_id"`
+		Name      string `json:"name"`
+		Private   bool   `json:"private"`
+		MemberIDs []int  `json:"member_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GroupID == 0 {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	name, err := repositories.ChannelName(req.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if !requireGroupAdmin(w, db, user.ID, req.GroupID) {
+		return
+	}
+	channels := repositories.NewGroupChannelRepository(db)
+	channel, err := channels.CreateChannel(req.GroupID, user.ID, name, req.Private)
+	if errors.Is(err, repositories.ErrChannelExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Println("❌ Error creating channel:", err)
+		http.Error(w, "Failed to create channel", http.StatusInternalServerError)
+		return
+	}
+
+	if channel.Private {
+		groupName, _, _ := GetGroupNameAndCreator(db, channel.GroupID)
+		for _, memberID := range req.MemberIDs {
+			if memberID == user.ID {
+				continue
+			}
+			if err := channels.AddMember(channel, memberID); err != nil {
+				log.Printf("❌ Failed to add User %d to Channel %d: %v", memberID, channel.ID, err)
+				continue
+			}
+			ws.SendNotificationFrom(user.ID, memberID, "group_channel",
+				fmt.Sprintf("%s added you to #%s in %s", user.Nickname, channel.Name, groupName))
+		}
+	} else if general, err := channels.DefaultChannel(channel.GroupID); err == nil {
+		hub.Publish(general.ID, map[string]any{"type": "channel_created", "group_id": channel.GroupID, "channel": channel})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(channel)
+}
+
+// ArchiveGroupChannelHandler lets the group admin archive a channel, which
+// makes it read only, or restore it: {"channel_id", "archived"}.
+func ArchiveGroupChannelHandler(hub *ws.GroupHub, w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ChannelID int  `json:"channel_id"`
+		Archived  bool `json:"archived"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChannelID == 0 {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if adminChannel(w, db, userID, req.ChannelID) == nil {
+		return
+	}
+	channel, err := repositories.NewGroupChannelRepository(db).SetArchived(req.ChannelID, req.Archived)
+	if errors.Is(err, repositories.ErrDefaultChannel) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("❌ Error archiving channel:", err)
+		http.Error(w, "Failed to archive channel", http.StatusInternalServerError)
+		return
+	}
+
+	event := "channel_archived"
+	if channel.ArchivedAt == nil {
+		event = "channel_restored"
+	}
+	hub.Publish(channel.ID, map[string]any{"type": event, "group_id": channel.GroupID, "channel": channel})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(channel)
+}
+
+// GetGroupChannelMembersHandler lists the members of a private channel to
+// those who can read it.
+func GetGroupChannelMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	channelID, err := strconv.Atoi(r.URL.Query().Get("channel_id"))
+	if err != nil || channelID == 0 {
+		http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	channel := readableChannel(w, db, userID, 0, channelID)
+	if channel == nil {
+		return
+	}
+	members, err := repositories.NewGroupChannelRepository(db).GetMembers(channel)
+	if err != nil {
+		log.Println("❌ Error retrieving channel members:", err)
+		http.Error(w, "Failed to retrieve channel members", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// UpdateGroupChannelMembersHandler adds (POST) or removes (DELETE) a member
+// of a private channel: {"channel_id", "user_id"}. The group admin manages
+// the members, a member may also remove themselves. A removed member is
+// disconnected from the channel.
+func UpdateGroupChannelMembersHandler(hub *ws.GroupHub, w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ChannelID int `json:"channel_id"`
+		UserID    int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChannelID == 0 || req.UserID == 0 {
+		http.Error(w, "Invalid channel or user ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	channels := repositories.NewGroupChannelRepository(db)
+	var channel *models.GroupChannel
+	if r.Method == http.MethodDelete && req.UserID == user.ID {
+		channel = readableChannel(w, db, user.ID, 0, req.ChannelID)
+	} else {
+		channel = adminChannel(w, db, user.ID, req.ChannelID)
+	}
+	if channel == nil {
+		return
+	}
+	if !channel.Private {
+		http.Error(w, "Public channels are open to every member of the group", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		removed, err := channels.RemoveMember(channel.ID, req.UserID)
+		if err != nil {
+			log.Println("❌ Error removing channel member:", err)
+			http.Error(w, "Failed to remove channel member", http.StatusInternalServerError)
+			return
+		}
+		if removed {
+			// the group admin can still read it
+			if readable, err := policy.CanReadChannel(db, req.UserID, channel.ID); err == nil && !readable {
+				hub.Evict(channel.ID, req.UserID, map[string]any{"type": "channel_removed", "group_id": channel.GroupID, "channel_id": channel.ID})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "Member removed"})
+		return
+	}
+
+	err := channels.AddMember(channel, req.UserID)
+	if errors.Is(err, repositories.ErrNotGroupMember) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Println("❌ Error adding channel member:", err)
+		http.Error(w, "Failed to add channel member", http.StatusInternalServerError)
+		return
+	}
+	if req.UserID != user.ID {
+		groupName, _, _ := GetGroupNameAndCreator(db, channel.GroupID)
+		ws.SendNotificationFrom(user.ID, req.UserID, "group_channel",
+			fmt.Sprintf("%s added you to #%s in %s", user.Nickname, channel.Name, groupName))
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member added"})
+}
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
+	"social-network/internal/repositories"
+	ws "social-network/internal/websocket"
 )
 
 func GetGroupChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
@@ -23,49 +26,82 @@ func GetGroupChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	channelID, _ := strconv.Atoi(r.URL.Query().Get("channel_id"))
+
 	db := config.GetDB()
 
 	// ✅ Check if user is a member of the group
-	var isMember bool
-	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_members WHERE user_id = ? AND group_id = ?)`, user.ID, groupID).Scan(&isMember)
-	if err != nil || !isMember {
-		http.Error(w, "Unauthorized: You are not in this group", http.StatusForbidden)
+	if !requireGroupMember(w, db, user.ID, groupID) {
+		return
+	}
+	channel := readableChannel(w, db, user.ID, groupID, channelID)
+	if channel == nil {
+		return
+	}
+
+	page, err := historyPage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// ✅ Fetch chat history
-	rows, err := db.Query(`
-		SELECT gm.id, gm.sender_id, u.nickname, gm.content, gm.sent_at
-		FROM group_messages gm
-		JOIN users u ON gm.sender_id = u.id
-		WHERE gm.group_id = ?
-		ORDER BY gm.sent_at ASC`, groupID)
+	messages, hasMore, err := repositories.NewGroupChatRepository(db).GetMessages(channel.ID, page)
 	if err != nil {
+		log.Println("❌ Error retrieving group chat history:", err)
 		http.Error(w, "Failed to retrieve chat history", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var messages []map[string]any
-	for rows.Next() {
-		var msg struct {
-			ID       int    `json:"id"`
-			SenderID int    `json:"sender_id"`
-			Nickname string `json:"nickname"`
-			Content  string `json:"content"`
-			SentAt   string `json:"sent_at"`
-		}
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.Nickname, &msg.Content, &msg.SentAt); err != nil {
-			continue
-		}
-		messages = append(messages, map[string]any{
-			"id":        msg.ID,
-			"sender_id": msg.SenderID,
-			"nickname":  msg.Nickname,
-			"content":   msg.Content,
-			"sent_at":   msg.SentAt,
-		})
-	}
 
+	w.Header().Set("Content-Type", "application/json")
+	setHasMore(w, hasMore)
 	json.NewEncoder(w).Encode(messages)
 }
+
+// MarkGroupChatReadHandler marks a channel of the group chat, the default one
+// unless channel_id is set, read up to message_id (the latest message by
+// default) and tells the members in the channel.
+func MarkGroupChatReadHandler(hub *ws.GroupHub, w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		GroupID   int `json:"group_id"`
+		ChannelID int `json:"channel_id"`
+		MessageID int `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GroupID == 0 {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if !requireGroupMember(w, db, user.ID, req.GroupID) {
+		return
+	}
+	channel := readableChannel(w, db, user.ID, req.GroupID, req.ChannelID)
+	if channel == nil {
+		return
+	}
+
+	lastReadID, err := repositories.NewGroupChatRepository(db).MarkRead(user.ID, channel.ID, req.MessageID)
+	if err != nil {
+		log.Println("❌ Error marking group chat read:", err)
+		http.Error(w, "Failed to mark chat read", http.StatusInternalServerError)
+		return
+	}
+
+	hub.Publish(channel.ID, map[string]any{
+		"type":         "read",
+		"group_id":     req.GroupID,
+		"channel_id":   channel.ID,
+		"reader_id":    user.ID,
+		"last_read_id": lastReadID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"last_read_id": lastReadID})
+}
@@ -6,45 +6,45 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
 	"social-network/internal/models"
+	"social-network/internal/repositories"
 	"social-network/internal/websocket"
 )
 
+// GetGroupPostCommentsHandler returns a page of the group post's comment threads
 func GetGroupPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	postID, err := strconv.Atoi(r.URL.Query().Get("post_id"))
 	if err != nil || postID == 0 {
 		http.Error(w, "Invalid post ID", http.StatusBadRequest)
 		return
 	}
+	limit, offset := pageParams(r)
 
 	db := config.GetDB()
+	if err := checkTargetAccess(db, user.ID, models.TargetGroupPost, postID); err != nil {
+		writeReactionError(w, err)
+		return
+	}
 
-	query := `
-        SELECT id, member_id, g_post_id, content, image , username
-        FROM group_comments WHERE g_post_id = ? ORDER BY id ASC`
-
-	rows, err := db.Query(query, postID)
+	comments, total, err := repositories.NewGroupCommentRepository(db).GetCommentsForPost(postID, user.ID, limit, offset)
 	if err != nil {
 		log.Println("Error fetching comments:", err)
 		http.Error(w, "Error fetching comments", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var comments []models.GroupComment
-	for rows.Next() {
-		var comment models.GroupComment
-		if err := rows.Scan(&comment.ID, &comment.MemberID, &comment.GPostID, &comment.Content, &comment.Image, &comment.Nickname); err != nil {
-			log.Println("Error scanning comment:", err)
-			continue
-		}
-		comments = append(comments, comment)
-	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	setTotalCount(w, total)
 	json.NewEncoder(w).Encode(comments)
 }
 
@@ -61,28 +61,52 @@ func AddGroupPostCommentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
+	comment.MemberID = user.ID
+	comment.Nickname = user.Nickname
+
 	var post_creator int
 	db := config.GetDB()
 	err := db.QueryRow(`
 	SELECT group_id, member_id
-	FROM group_posts 
+	FROM group_posts
 	WHERE id = ? `, comment.GPostID).
 		Scan(&comment.GroupID, &post_creator)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		log.Println("Error getting groupid for comment:", err)
 		http.Error(w, "Error getting groupid for comment", http.StatusInternalServerError)
 		return
 	}
+	if err := checkTargetAccess(db, user.ID, models.TargetGroupPost, comment.GPostID); err != nil {
+		writeReactionError(w, err)
+		return
+	}
 
-	_, err = db.Exec("INSERT INTO group_comments (member_id, g_post_id, content, image , username, group_id) VALUES (?, ?, ?, ?, ?, ?)",
-		comment.MemberID, comment.GPostID, comment.Content, comment.Image, user.Nickname, comment.GroupID)
-	if err != nil {
+	repo := repositories.NewGroupCommentRepository(db)
+
+	// a reply must answer a comment of the same post
+	var parent *models.GroupComment
+	if comment.ParentID != nil {
+		parent, err = repo.GetComment(*comment.ParentID)
+		if err != nil || parent.GPostID != comment.GPostID {
+			http.Error(w, "Parent comment not found", http.StatusBadRequest)
+			return
+		}
+		if err := checkTargetAccess(db, user.ID, models.TargetGroupComment, parent.ID); err != nil {
+			writeReactionError(w, err)
+			return
+		}
+	}
+
+	if err := repo.AddComment(&comment); err != nil {
 		log.Println("Error inserting comment:", err)
 		http.Error(w, "Error adding comment", http.StatusInternalServerError)
 		return
 	}
 
-	newComment, err := LastInsertedGroupComment(comment.MemberID, comment.GPostID)
+	newComment, err := repo.GetComment(comment.ID)
 	if err != nil {
 		log.Println("Error retrieving new comment:", err)
 		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
@@ -90,31 +114,112 @@ func AddGroupPostCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var GroupName string
 	db.QueryRow(`
-	SELECT name
-	FROM groups 
+	SELECT group_name
+	FROM groups
 	WHERE id = ? `, comment.GroupID).
 		Scan(&GroupName)
 
-	websocket.SendNotification(post_creator, "comment", user.Nickname+" commented on your post in Group: "+GroupName)
+	if parent != nil && parent.MemberID != user.ID {
+		websocket.SendNotificationFrom(user.ID, parent.MemberID, "reply", user.Nickname+" replied to your comment in Group: "+GroupName)
+	}
+	if post_creator != user.ID && (parent == nil || parent.MemberID != post_creator) {
+		websocket.SendNotificationFrom(user.ID, post_creator, "comment", user.Nickname+" commented on your post in Group: "+GroupName)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(newComment)
 }
 
-func LastInsertedGroupComment(memberID, postID int) (*models.GroupComment, error) {
-	var comment models.GroupComment
+// UpdateGroupPostCommentHandler lets the author edit their group comment
+func UpdateGroupPostCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
-	db := config.GetDB()
-	err := db.QueryRow(`
-		SELECT id, member_id, g_post_id, content, image , username
-		FROM group_comments 
-		WHERE member_id = ? AND g_post_id = ? 
-		ORDER BY id DESC LIMIT 1`, memberID, postID).
-		Scan(&comment.ID, &comment.MemberID, &comment.GPostID, &comment.Content, &comment.Image, &comment.Nickname)
+	var req struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" {
+		http.Error(w, "Comment cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	repo := repositories.NewGroupCommentRepository(config.GetDB())
+	comment, err := repo.GetComment(req.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving comment:", err)
+		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
+		return
+	}
+	if comment.MemberID != user.ID {
+		http.Error(w, "Only the author can edit this comment", http.StatusForbidden)
+		return
+	}
+
+	if err := repo.UpdateComment(req.ID, req.Content); err != nil {
+		log.Println("❌ Error updating comment:", err)
+		http.Error(w, "Failed to update comment", http.StatusInternalServerError)
+		return
+	}
+
+	comment, err = repo.GetComment(req.ID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil // No comment found
-		}
-		return nil, err
+		log.Println("❌ Error retrieving comment:", err)
+		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteGroupPostCommentHandler deletes a group comment and its replies. The
+// comment's author and the author of the group post may delete it.
+func DeleteGroupPostCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || commentID == 0 {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	repo := repositories.NewGroupCommentRepository(db)
+	comment, err := repo.GetComment(commentID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving comment:", err)
+		http.Error(w, "Failed to retrieve comment", http.StatusInternalServerError)
+		return
+	}
+
+	var postCreatorID int
+	db.QueryRow("SELECT member_id FROM group_posts WHERE id = ?", comment.GPostID).Scan(&postCreatorID)
+	if comment.MemberID != user.ID && postCreatorID != user.ID {
+		http.Error(w, "You cannot delete this comment", http.StatusForbidden)
+		return
+	}
+
+	if err := repo.DeleteComment(commentID); err != nil {
+		log.Println("❌ Error deleting comment:", err)
+		http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+		return
 	}
-	return &comment, nil
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted"})
 }
@@ -48,6 +48,9 @@ func CreateGroupEventHandler(w http.ResponseWriter, r *http.Request) {
 	*/
 	event.CreatorID = userID
 	db := config.GetDB()
+	if !requireGroupMember(w, db, userID, event.GroupID) {
+		return
+	}
 	repo := repositories.NewGroupEventRepository(db)
 
 	err := repo.CreateGroupEvent(&event)
@@ -63,6 +66,12 @@ func CreateGroupEventHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetGroupEventsHandler retrieves all events for a given group
 func GetGroupEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
 	if err != nil || groupID == 0 {
 		http.Error(w, "Invalid group ID", http.StatusBadRequest)
@@ -70,6 +79,9 @@ func GetGroupEventsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	if !requireGroupMember(w, db, userID, groupID) {
+		return
+	}
 	repo := repositories.NewGroupEventRepository(db)
 
 	events, err := repo.GetGroupEvents(groupID)
@@ -106,6 +118,14 @@ func RSVPEventHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	var groupID int
+	if err := db.QueryRow(`SELECT group_id FROM group_events WHERE id = ?`, eventID).Scan(&groupID); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if !requireGroupMember(w, db, user.ID, groupID) {
+		return
+	}
 	repo := repositories.NewEventRSVPRepository(db)
 
 	// Check if user already has an RSVP
@@ -133,14 +153,21 @@ func RSVPEventHandler(w http.ResponseWriter, r *http.Request) {
 	// Send WebSocket notification (optional)
 	fmt.Println("notification sent to event creator: ", creator_id)
 	message := fmt.Sprintf("%s is %s to event %s", user.Nickname, requestBody.Status, title)
-	websocket.SendNotification(creator_id, "event_rsvp", message)
+	websocket.SendNotificationFrom(user.ID, creator_id, "event_rsvp", message)
 	// w.WriteHeader(http.StatusOK)
 	websocket.BroadcastGroupEvents(gid)
 	json.NewEncoder(w).Encode(map[string]string{"message": "RSVP updated successfully"})
 }
 
-// GetRSVPCountHandler returns the number of users attending an event
+// GetRSVPCountHandler returns the number of users attending an event to a
+// member of its group
 func GetRSVPCountHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	eventID, err := strconv.Atoi(r.URL.Query().Get("event_id"))
 	if err != nil || eventID == 0 {
 		http.Error(w, "Invalid event ID", http.StatusBadRequest)
@@ -148,6 +175,14 @@ func GetRSVPCountHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	var groupID int
+	if err := db.QueryRow(`SELECT group_id FROM group_events WHERE id = ?`, eventID).Scan(&groupID); err != nil {
+		http.Error(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	if !requireGroupMember(w, db, userID, groupID) {
+		return
+	}
 	repo := repositories.NewEventRSVPRepository(db)
 
 	count, err := repo.GetRSVPCount(eventID)
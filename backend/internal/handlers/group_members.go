@@ -58,7 +58,7 @@ func LeaveGroupHandler(w http.ResponseWriter, r *http.Request) {
 		var groupName string
 		db.QueryRow(`SELECT creator_id FROM groups WHERE id = ?`, groupID).Scan(&creatorID)
 		db.QueryRow(`SELECT name FROM groups WHERE id = ?`, groupID).Scan(&groupName)
-		websocket.SendNotification(creatorID, "NOTICE", user.Nickname+" has left your group: "+groupName)
+		websocket.SendNotificationFrom(user.ID, creatorID, "NOTICE", user.Nickname+" has left your group: "+groupName)
 	}
 	log.Println("user removed successfully")
 	// w.WriteHeader(http.StatusOK)
@@ -80,6 +80,9 @@ func InviteUserToGroupHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	if !requireGroupMember(w, db, user.ID, groupID) {
+		return
+	}
 	repo := repositories.NewGroupRepository(db)
 
 	// ✅ Check if the invited user is already in the group
@@ -102,7 +105,7 @@ func InviteUserToGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	gname, _, _ := GetGroupNameAndCreator(db, groupID)
-	websocket.SendNotification(invitedUserID, "invitation", user.Nickname+" has invited you to join group: "+gname)
+	websocket.SendNotificationFrom(user.ID, invitedUserID, "invitation", user.Nickname+" has invited you to join group: "+gname)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Invitation sent successfully"})
 }
@@ -298,6 +301,7 @@ func GetUserMemberGroupsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	chatState := repositories.NewGroupChatRepository(db)
 	var groups []models.Group
 	for rows.Next() {
 		var group models.Group
@@ -315,6 +319,11 @@ func GetUserMemberGroupsHandler(w http.ResponseWriter, r *http.Request) {
 			log.Println("❌ Error getting nickname for creator:", err)
 			continue
 		}
+		group.UnreadCount, group.LastMessage, err = chatState.GetChatState(user.ID, group.ID)
+		if err != nil {
+			log.Println("❌ Error getting group chat state:", err)
+			continue
+		}
 		groups = append(groups, group)
 	}
 	log.Println("Retreived user groups successfully")
@@ -351,8 +360,15 @@ func ApproveMembershipHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Membership approved"})
 }
 
-// GetGroupMembersHandler retrieves all approved members of a group
+// GetGroupMembersHandler retrieves all approved members of a group for
+// another member
 func GetGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
 	if err != nil || groupID == 0 {
 		log.Println("id missing", groupID)
@@ -361,6 +377,9 @@ func GetGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	if !requireGroupMember(w, db, userID, groupID) {
+		return
+	}
 	repo := repositories.NewGroupRepository(db)
 
 	members, err := repo.GetGroupMembers(groupID)
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -54,6 +53,9 @@ func CreateGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Group ID and content are required", http.StatusBadRequest)
 		return
 	}
+	if !requireGroupMember(w, config.GetDB(), user.ID, post.GroupID) {
+		return
+	}
 
 	var imagePath string = ""
 	imageFile, header, err := r.FormFile("image")
@@ -131,6 +133,12 @@ func CreateGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
 	if err != nil || groupID == 0 {
 		http.Error(w, "Invalid group ID", http.StatusBadRequest)
@@ -138,10 +146,13 @@ func GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	db := config.GetDB()
+	if !requireGroupMember(w, db, user.ID, groupID) {
+		return
+	}
 
 	query := `
         SELECT id, group_id, member_id, content, image, created_at , username
-        FROM group_posts WHERE group_id = ? ORDER BY created_at DESC`
+        FROM group_posts WHERE group_id = ? AND hidden = 0 ORDER BY created_at DESC`
 
 	rows, err := db.Query(query, groupID)
 	if err != nil {
@@ -152,28 +163,42 @@ func GetGroupPostsHandler(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	var posts []models.GroupPost
+	var ids []int
 	for rows.Next() {
 		var post models.GroupPost
 		if err := rows.Scan(&post.ID, &post.GroupID, &post.MemberID, &post.Content, &post.Image, &post.CreatedAt, &post.Nickname); err != nil {
 			log.Println("Error scanning post:", err)
 			continue
 		}
-		// Get like & dislike counts
-		post.LikeCount, err = GetGroupLikeCount(post.ID, true)
-		if err != nil {
-			return
-		}
-		post.DisLikeCount, err = GetGroupLikeCount(post.ID, false)
-		if err != nil {
-			return
-		}
 		posts = append(posts, post)
+		ids = append(ids, post.ID)
+	}
+
+	reactions, err := repositories.NewReactionRepository(db).GetReactionSummaries(models.TargetGroupPost, ids, user.ID)
+	if err != nil {
+		log.Println("Error fetching reactions:", err)
+		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
+		return
+	}
+	polls, err := repositories.NewPollRepository(db).GetPollsByTargets(models.TargetGroupPost, ids, user.ID)
+	if err != nil {
+		log.Println("Error fetching polls:", err)
+		http.Error(w, "Error fetching posts", http.StatusInternalServerError)
+		return
+	}
+	for i := range posts {
+		posts[i].Reactions = reactions[posts[i].ID]
+		posts[i].LikeCount = posts[i].Reactions.Counts["like"]
+		posts[i].DisLikeCount = posts[i].Reactions.Counts["dislike"]
+		posts[i].Poll = polls[posts[i].ID]
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(posts)
 }
 
+// LikeGroupPostHandler is the legacy like/dislike endpoint for group posts,
+// see LikePost.
 func LikeGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
@@ -181,64 +206,26 @@ func LikeGroupPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := config.GetDB()
-
 	var like models.Like
 	if err := json.NewDecoder(r.Body).Decode(&like); err != nil {
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	var existingLike sql.NullBool
-	err := db.QueryRow("SELECT is_like FROM group_likes WHERE post_id = ? AND member_id = ?", like.Postid, user.ID).Scan(&existingLike)
-
-	if err != nil && err != sql.ErrNoRows {
-		log.Println("❌ Error retrieving like:", err)
-		http.Error(w, "Error checking like status", http.StatusInternalServerError)
-		return
-	}
-
-	if !existingLike.Valid {
-		_, err = db.Exec("INSERT INTO group_likes (post_id, member_id, is_like) VALUES (?, ?, ?)", like.Postid, user.ID, like.IsLike)
-	} else {
-		// _, err = db.Exec("UPDATE group_likes SET is_like = ? WHERE post_id = ? AND member_id = ?", like.IsLike, like.Postid, user.ID)
-		if existingLike.Valid && existingLike.Bool == like.IsLike {
-			log.Println("🟡 Removing existing like from database...")
-			_, err = db.Exec("DELETE FROM group_likes WHERE post_id = ? AND member_id = ?", like.Postid, user.ID)
-		} else {
-			// log.Printf("🔍 Existing Like Check: err=%v, existingLike.Valid=%v, existingLike.Bool=%v", err, existingLike.Valid, existingLike.Bool)
-			log.Println("🟠 Updating like in database...")
-			_, err = db.Exec("UPDATE group_likes SET is_like = ? WHERE post_id = ? AND member_id = ?", like.IsLike, like.Postid, user.ID)
-		}
-	}
-
+	summary, err := applyReaction(user, models.TargetGroupPost, like.Postid, likeReaction(like.IsLike))
 	if err != nil {
-		log.Println("❌ Error updating/removing like:", err)
-		http.Error(w, "Error updating like/dislike", http.StatusInternalServerError)
+		writeReactionError(w, err)
 		return
 	}
 	log.Println("post liked:", like.IsLike, "in group for post:", like.Postid, "by memberid:", user.ID)
 
-	likeCount, _ := GetGroupLikeCount(like.Postid, true)
-	dislikeCount, _ := GetGroupLikeCount(like.Postid, false)
-
 	response := map[string]any{
 		"message":     "Action successful",
 		"post_id":     like.Postid,
-		"likes":       likeCount,
-		"dislikes":    dislikeCount,
+		"likes":       summary.Counts["like"],
+		"dislikes":    summary.Counts["dislike"],
 		"user_action": like.IsLike,
+		"reactions":   summary,
 	}
 	json.NewEncoder(w).Encode(response)
 }
-
-func GetGroupLikeCount(postID int, islike bool) (int, error) {
-	db := config.GetDB()
-	var likeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM group_likes WHERE post_id = ? AND is_like = ?", postID, islike).Scan(&likeCount)
-	if err != nil {
-		log.Println("error counting likes", err)
-		return 0, err
-	}
-	return likeCount, nil
-}
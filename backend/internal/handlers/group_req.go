@@ -35,7 +35,7 @@ func RequestToJoinGroupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	gname, cid, _ := GetGroupNameAndCreator(db, groupID)
-	websocket.SendNotification(cid, "request", user.Nickname+" has requested to join your group: "+gname)
+	websocket.SendNotificationFrom(user.ID, cid, "request", user.Nickname+" has requested to join your group: "+gname)
 	// w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Request sent"})
 }
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/repositories"
+	"social-network/internal/websocket"
+)
+
+const defaultSuspension = 7 * 24 * time.Hour
+
+// ReportHandler lets any user report a user or a piece of content
+func ReportHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var report models.Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	report.Reason = strings.TrimSpace(report.Reason)
+	if !repositories.IsReportableType(report.TargetType) || report.TargetID == 0 || report.Reason == "" {
+		http.Error(w, "A report needs a valid target and a reason", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if report.TargetType != models.TargetUser {
+		if err := checkTargetAccess(db, user.ID, report.TargetType, report.TargetID); err != nil {
+			writeReactionError(w, err)
+			return
+		}
+	}
+
+	repo := repositories.NewModerationRepository(db)
+	targetUserID, err := repo.GetTargetUser(report.TargetType, report.TargetID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Reported item not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving reported item:", err)
+		http.Error(w, "Failed to file report", http.StatusInternalServerError)
+		return
+	}
+	if targetUserID == user.ID {
+		http.Error(w, "You cannot report yourself", http.StatusBadRequest)
+		return
+	}
+
+	report.ReporterID = user.ID
+	report.TargetUserID = targetUserID
+	if err := repo.CreateReport(&report); err != nil {
+		log.Println("❌ Error filing report:", err)
+		http.Error(w, "Failed to file report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Report submitted"})
+}
+
+// GetModerationQueueHandler returns the reports with the given status (open by default)
+func GetModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	moderator := requireModerator(w, r)
+	if moderator.ID == 0 {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+
+	reports, err := repositories.NewModerationRepository(config.GetDB()).GetReports(status)
+	if err != nil {
+		log.Println("❌ Error fetching reports:", err)
+		http.Error(w, "Failed to fetch reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// ModerationActionHandler applies hide, delete, warn, suspend or dismiss to a
+// report (or directly to a target) and records it in the audit trail
+func ModerationActionHandler(w http.ResponseWriter, r *http.Request) {
+	moderator := requireModerator(w, r)
+	if moderator.ID == 0 {
+		return
+	}
+
+	var req struct {
+		ReportID      int    `json:"report_id"`
+		TargetType    string `json:"target_type"`
+		TargetID      int    `json:"target_id"`
+		Action        string `json:"action"`
+		Note          string `json:"note"`
+		DurationHours int    `json:"duration_hours"` // suspend only, defaults to 7 days
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	repo := repositories.NewModerationRepository(db)
+
+	var reportID *int
+	if req.ReportID != 0 {
+		report, err := repo.GetReport(req.ReportID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Println("❌ Error fetching report:", err)
+			http.Error(w, "Failed to fetch report", http.StatusInternalServerError)
+			return
+		}
+		req.TargetType, req.TargetID = report.TargetType, report.TargetID
+		reportID = &req.ReportID
+	}
+	if !repositories.IsReportableType(req.TargetType) || req.TargetID == 0 {
+		http.Error(w, "Invalid moderation target", http.StatusBadRequest)
+		return
+	}
+
+	action := models.ModerationAction{
+		ModeratorID: moderator.ID,
+		Action:      req.Action,
+		TargetType:  req.TargetType,
+		TargetID:    req.TargetID,
+		ReportID:    reportID,
+		Note:        strings.TrimSpace(req.Note),
+	}
+	// the author is looked up before a delete so the audit trail keeps it
+	if targetUserID, err := repo.GetTargetUser(req.TargetType, req.TargetID); err == nil {
+		action.TargetUserID = &targetUserID
+	}
+
+	var err error
+	reportStatus := "resolved"
+	switch req.Action {
+	case "hide":
+		err = repo.HideTarget(req.TargetType, req.TargetID)
+	case "delete":
+		err = repo.DeleteTarget(req.TargetType, req.TargetID)
+	case "warn":
+		if action.TargetUserID == nil {
+			err = sql.ErrNoRows
+			break
+		}
+		message := "A moderator has warned you about your " + strings.ReplaceAll(req.TargetType, "_", " ") + "."
+		if action.Note != "" {
+			message += " " + action.Note
+		}
+		websocket.SendNotification(*action.TargetUserID, "warning", message)
+	case "suspend":
+		if action.TargetUserID == nil {
+			err = sql.ErrNoRows
+			break
+		}
+		var targetRole string
+		db.QueryRow(`SELECT role FROM users WHERE id = ?`, *action.TargetUserID).Scan(&targetRole)
+		if targetRole != models.RoleUser && moderator.Role != models.RoleAdmin {
+			http.Error(w, "Only site admins can suspend moderators", http.StatusForbidden)
+			return
+		}
+		duration := defaultSuspension
+		if req.DurationHours > 0 {
+			duration = time.Duration(req.DurationHours) * time.Hour
+		}
+		err = repo.SuspendUser(*action.TargetUserID, time.Now().Add(duration))
+		if err == nil {
+			websocket.UserConnections.Disconnect(*action.TargetUserID)
+		}
+	case "dismiss":
+		reportStatus = "dismissed"
+	default:
+		http.Error(w, "Unknown action, use hide, delete, warn, suspend or dismiss", http.StatusBadRequest)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Target not found", http.StatusNotFound)
+		return
+	} else if err == repositories.ErrNotModeratable {
+		http.Error(w, "Only content can be hidden or deleted", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Println("❌ Error applying moderation action:", err)
+		http.Error(w, "Failed to apply action", http.StatusInternalServerError)
+		return
+	}
+
+	if err := repo.CloseReports(req.TargetType, req.TargetID, moderator.ID, reportStatus); err != nil {
+		log.Println("❌ Error closing reports:", err)
+	}
+	if err := repo.LogAction(&action); err != nil {
+		log.Println("❌ Error writing moderation audit entry:", err)
+		http.Error(w, "Action applied but could not be recorded", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Action applied"})
+}
+
+// GetModerationAuditHandler returns the latest moderation actions
+func GetModerationAuditHandler(w http.ResponseWriter, r *http.Request) {
+	moderator := requireModerator(w, r)
+	if moderator.ID == 0 {
+		return
+	}
+
+	actions, err := repositories.NewModerationRepository(config.GetDB()).GetActions(200)
+	if err != nil {
+		log.Println("❌ Error fetching moderation audit:", err)
+		http.Error(w, "Failed to fetch audit trail", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actions)
+}
+
+// SetUserRoleHandler lets a site admin promote or demote moderators
+func SetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin := middlewars.GetUserbySession(w, r)
+	if admin.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if admin.Role != models.RoleAdmin {
+		http.Error(w, "Only site admins can change roles", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		UserID int    `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.Role != models.RoleUser && req.Role != models.RoleModerator && req.Role != models.RoleAdmin {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	err := repositories.NewUserRepository(db).SetRole(req.UserID, req.Role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error updating role:", err)
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	repositories.NewModerationRepository(db).LogAction(&models.ModerationAction{
+		ModeratorID:  admin.ID,
+		Action:       "role",
+		TargetType:   models.TargetUser,
+		TargetID:     req.UserID,
+		TargetUserID: &req.UserID,
+		Note:         "role set to " + req.Role,
+	})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated"})
+}
+
+// requireModerator returns the session user if they are a moderator or admin,
+// otherwise it writes the error and returns an empty user.
+func requireModerator(w http.ResponseWriter, r *http.Request) models.User {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return models.User{}
+	}
+	if !user.IsModerator() {
+		http.Error(w, "Moderators only", http.StatusForbidden)
+		return models.User{}
+	}
+	return user
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"social-network/internal/models"
+	"social-network/internal/websocket/wstest"
+)
+
+// TestModeration files a report, works it from the queue and checks who may
+// moderate and change roles.
+func TestModeration(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	alice := wstest.Login(t, db, 1, "alice")
+	moderator := wstest.Login(t, db, 2, "moderator")
+	admin := wstest.Login(t, db, 3, "admin")
+	bob := wstest.Login(t, db, 4, "bob")
+	seed := []string{
+		`UPDATE users SET role = 'moderator' WHERE id = 2`,
+		`UPDATE users SET role = 'admin' WHERE id = 3`,
+		`INSERT INTO posts (id, user_id, username, content, privacy) VALUES (1, 1, 'alice', 'spam', 'public')`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := `{"target_type":"post","target_id":1,"reason":"spam"}`
+	for range 2 {
+		if w := serve(ReportHandler, "POST", "/api/reports", bob, report); w.Code != http.StatusCreated {
+			t.Fatalf("reporting: %d %s, want 201", w.Code, w.Body)
+		}
+	}
+	if w := serve(ReportHandler, "POST", "/api/reports", alice, report); w.Code != http.StatusBadRequest {
+		t.Errorf("reporting oneself: %d, want 400", w.Code)
+	}
+
+	if w := serve(GetModerationQueueHandler, "GET", "/api/moderation/reports", alice, ""); w.Code != http.StatusForbidden {
+		t.Errorf("reading the queue as a user: %d, want 403", w.Code)
+	}
+	w := serve(GetModerationQueueHandler, "GET", "/api/moderation/reports", moderator, "")
+	var queue []models.Report
+	if err := json.NewDecoder(w.Body).Decode(&queue); err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || queue[0].Preview != "spam" || queue[0].TargetUserID != 1 || queue[0].ReportCount != 1 {
+		t.Fatalf("queue: %+v, want the one report of bob on post 1", queue)
+	}
+
+	if w := serve(ModerationActionHandler, "POST", "/api/moderation/actions", alice, `{"report_id":1,"action":"hide"}`); w.Code != http.StatusForbidden {
+		t.Errorf("acting as a user: %d, want 403", w.Code)
+	}
+	if w := serve(ModerationActionHandler, "POST", "/api/moderation/actions", moderator, `{"target_type":"user","target_id":3,"action":"suspend"}`); w.Code != http.StatusForbidden {
+		t.Errorf("a moderator suspending an admin: %d, want 403", w.Code)
+	}
+	if w := serve(ModerationActionHandler, "POST", "/api/moderation/actions", moderator, `{"report_id":1,"action":"hide"}`); w.Code != http.StatusOK {
+		t.Fatalf("hiding the reported post: %d %s, want 200", w.Code, w.Body)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM posts WHERE id = 1 AND hidden = 1`); n != 1 {
+		t.Error("the post was not hidden")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM reports WHERE status = 'open'`); n != 0 {
+		t.Error("the report is still open")
+	}
+	if w := serve(ModerationActionHandler, "POST", "/api/moderation/actions", moderator, `{"target_type":"post","target_id":99,"action":"delete"}`); w.Code != http.StatusNotFound {
+		t.Errorf("deleting a missing post: %d, want 404", w.Code)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM moderation_actions`); n != 1 {
+		t.Errorf("%d audit entries, want only the hide", n)
+	}
+
+	if w := serve(SetUserRoleHandler, "POST", "/api/admin/role", moderator, `{"user_id":4,"role":"moderator"}`); w.Code != http.StatusForbidden {
+		t.Errorf("a moderator changing roles: %d, want 403", w.Code)
+	}
+	if w := serve(SetUserRoleHandler, "POST", "/api/admin/role", admin, `{"user_id":4,"role":"moderator"}`); w.Code != http.StatusOK {
+		t.Fatalf("an admin changing roles: %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(GetModerationQueueHandler, "GET", "/api/moderation/reports?status=resolved", bob, ""); w.Code != http.StatusOK {
+		t.Errorf("reading the queue as a new moderator: %d, want 200", w.Code)
+	}
+}
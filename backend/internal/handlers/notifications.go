@@ -4,14 +4,11 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"strconv"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
 	"social-network/internal/repositories"
 	ws "social-network/internal/websocket"
-
-	"github.com/gorilla/websocket"
 )
 
 func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
@@ -42,20 +39,12 @@ func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func WebSocketNotificationHandler(w http.ResponseWriter, r *http.Request) {
-	userIDStr := r.URL.Query().Get("user_id")
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // ✅ Allow requests from any frontend domain
-		},
-	}
-
-	conn, err := upgrader.Upgrade(w, r, nil)
-	// conn, err := websocket.Upgrade(w, r, nil, 1024, 1024) // ✅ Fix: Added missing buffer sizes
+	conn, err := ws.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("❌ Failed to upgrade WebSocket:", err)
 		http.Error(w, "WebSocket upgrade failed", http.StatusInternalServerError)
@@ -63,8 +52,9 @@ func WebSocketNotificationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Store connection in WebSocket manager
-	ws.NotificationManager.RegisterClient(userID, conn)
+	client := ws.NotificationManager.RegisterClient(userID, conn)
 	log.Printf("✅ WebSocket connected for User %d", userID)
+	go ws.NotificationManager.Listen(userID, client)
 }
 
 func MarkNotificationsAsReadHandler(w http.ResponseWriter, r *http.Request) {
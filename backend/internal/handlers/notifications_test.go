@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ws "social-network/internal/websocket"
+	"social-network/internal/websocket/wstest"
+)
+
+// TestNotificationSocketRequiresSession refuses a notification socket without
+// a session and registers it for the session user, whatever ?user_id says.
+func TestNotificationSocketRequiresSession(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	server := httptest.NewServer(http.HandlerFunc(WebSocketNotificationHandler))
+	defer server.Close()
+	header := wstest.Login(t, db, 21, "mallory")
+	wstest.Login(t, db, 22, "victim")
+
+	if conn, err := wstest.Dial(server, "/?user_id=22", nil); err == nil {
+		conn.Close()
+		t.Fatal("connected without a session")
+	}
+	conn, err := wstest.Dial(server, "/?user_id=22", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ws.NotificationManager.Mutex.Lock()
+		mallory, victim := len(ws.NotificationManager.Clients[21]), len(ws.NotificationManager.Clients[22])
+		ws.NotificationManager.Mutex.Unlock()
+		if victim != 0 {
+			t.Fatal("registered the socket for the user of ?user_id")
+		}
+		if mallory != 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the session user is not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"social-network/internal/repositories"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageParams reads the ?limit and ?offset query parameters, falling back to
+// defaultPageSize and 0 and capping limit at maxPageSize.
+func pageParams(r *http.Request) (limit, offset int) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	offset, err = strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// setTotalCount exposes the total number of items behind a paginated list.
+func setTotalCount(w http.ResponseWriter, total int) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+}
+
+// historyPage reads the ?before or ?since message id and ?limit of a chat
+// history request. Without any of them the whole history is returned, as
+// before paging existed.
+func historyPage(r *http.Request) (repositories.HistoryPage, error) {
+	page := repositories.HistoryPage{}
+	query := r.URL.Query()
+	if query.Has("before") || query.Has("since") || query.Has("limit") {
+		page.Limit, _ = pageParams(r)
+	}
+	for name, dest := range map[string]*int{"before": &page.Before, "since": &page.Since} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 0 {
+			return page, errors.New("invalid " + name + " message id")
+		}
+		*dest = id
+	}
+	if page.Before > 0 && page.Since > 0 {
+		return page, errors.New("use either before or since")
+	}
+	return page, nil
+}
+
+// setHasMore tells the client whether more messages exist past this page.
+func setHasMore(w http.ResponseWriter, hasMore bool) {
+	w.Header().Set("X-Has-More", strconv.FormatBool(hasMore))
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/repositories"
+	"social-network/internal/websocket"
+)
+
+const maxPollOptions = 10
+
+var errPollForbidden = errors.New("you cannot access this poll")
+
+// CreatePollHandler attaches a poll to one of the user's posts or group posts
+func CreatePollHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		TargetType     string   `json:"target_type"`
+		TargetID       int      `json:"target_id"`
+		Question       string   `json:"question"`
+		Options        []string `json:"options"`
+		MultipleChoice bool     `json:"multiple_choice"`
+		Anonymous      bool     `json:"anonymous"`
+		ClosesAt       string   `json:"closes_at"` // RFC3339, optional
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if req.TargetType != models.TargetPost && req.TargetType != models.TargetGroupPost {
+		http.Error(w, "Polls can only be attached to posts or group posts", http.StatusBadRequest)
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	var labels []string
+	for _, option := range req.Options {
+		if option = strings.TrimSpace(option); option != "" {
+			labels = append(labels, option)
+		}
+	}
+	if req.Question == "" || len(labels) < 2 || len(labels) > maxPollOptions {
+		http.Error(w, fmt.Sprintf("A poll needs a question and 2 to %d options", maxPollOptions), http.StatusBadRequest)
+		return
+	}
+
+	poll := models.Poll{
+		TargetType:     req.TargetType,
+		TargetID:       req.TargetID,
+		CreatorID:      user.ID,
+		Question:       req.Question,
+		MultipleChoice: req.MultipleChoice,
+		Anonymous:      req.Anonymous,
+	}
+	if req.ClosesAt != "" {
+		closesAt, err := time.Parse(time.RFC3339, req.ClosesAt)
+		if err != nil || !closesAt.After(time.Now()) {
+			http.Error(w, "closes_at must be a future RFC3339 time", http.StatusBadRequest)
+			return
+		}
+		poll.ClosesAt = &closesAt
+	}
+
+	db := config.GetDB()
+	ownerID, err := repositories.NewReactionRepository(db).GetTargetOwner(req.TargetType, req.TargetID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving post author:", err)
+		http.Error(w, "Failed to create poll", http.StatusInternalServerError)
+		return
+	}
+	if ownerID != user.ID {
+		http.Error(w, "Only the author can add a poll to a post", http.StatusForbidden)
+		return
+	}
+
+	repo := repositories.NewPollRepository(db)
+	pollID, err := repo.CreatePoll(&poll, labels)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			http.Error(w, "This post already has a poll", http.StatusConflict)
+			return
+		}
+		log.Println("❌ Error creating poll:", err)
+		http.Error(w, "Failed to create poll", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := repo.GetPoll(pollID, user.ID)
+	if err != nil {
+		log.Println("❌ Error retrieving poll:", err)
+		http.Error(w, "Failed to retrieve poll", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// GetPollHandler returns a poll by poll_id, or the poll attached to target_type/target_id
+func GetPollHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	db := config.GetDB()
+	repo := repositories.NewPollRepository(db)
+
+	var poll *models.Poll
+	var err error
+	if pollID, convErr := strconv.Atoi(r.URL.Query().Get("poll_id")); convErr == nil && pollID != 0 {
+		poll, err = repo.GetPoll(pollID, user.ID)
+		if err == sql.ErrNoRows {
+			poll, err = nil, nil
+		}
+	} else {
+		targetID, convErr := strconv.Atoi(r.URL.Query().Get("target_id"))
+		if convErr != nil || targetID == 0 {
+			http.Error(w, "Invalid poll ID", http.StatusBadRequest)
+			return
+		}
+		poll, err = repo.GetPollByTarget(r.URL.Query().Get("target_type"), targetID, user.ID)
+	}
+	if err != nil {
+		log.Println("❌ Error retrieving poll:", err)
+		http.Error(w, "Failed to retrieve poll", http.StatusInternalServerError)
+		return
+	}
+	if poll == nil {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	}
+
+	if err := checkPollTarget(db, user.ID, poll); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// VotePollHandler sets the user's choices on a poll
+func VotePollHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		PollID    int   `json:"poll_id"`
+		OptionIDs []int `json:"option_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PollID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	repo := repositories.NewPollRepository(db)
+
+	poll, err := repo.GetPoll(req.PollID, user.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving poll:", err)
+		http.Error(w, "Failed to retrieve poll", http.StatusInternalServerError)
+		return
+	}
+	if err := checkPollTarget(db, user.ID, poll); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	err = repo.Vote(req.PollID, user.ID, req.OptionIDs)
+	switch {
+	case errors.Is(err, repositories.ErrPollClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, repositories.ErrInvalidPollOption):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Println("❌ Error saving vote:", err)
+		http.Error(w, "Failed to vote", http.StatusInternalServerError)
+		return
+	}
+
+	poll, err = repo.GetPoll(req.PollID, user.ID)
+	if err != nil {
+		log.Println("❌ Error retrieving poll:", err)
+		http.Error(w, "Failed to retrieve poll", http.StatusInternalServerError)
+		return
+	}
+	websocket.BroadcastPollUpdate(poll)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
+
+// ClosePollHandler lets the poll creator close it before its close time
+func ClosePollHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		PollID int `json:"poll_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.PollID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	poll, err := repositories.NewPollRepository(db).GetPoll(req.PollID, user.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("❌ Error retrieving poll:", err)
+		http.Error(w, "Failed to retrieve poll", http.StatusInternalServerError)
+		return
+	}
+	if poll.CreatorID != user.ID {
+		http.Error(w, "Only the poll creator can close it", http.StatusForbidden)
+		return
+	}
+
+	if err := closePoll(db, req.PollID); err != nil {
+		http.Error(w, "Failed to close poll", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Poll closed"})
+}
+
+// RunPollCloser closes polls whose close time has passed, checking every
+// interval. It returns once quit is closed.
+func RunPollCloser(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+		db := config.GetDB()
+		ids, err := repositories.NewPollRepository(db).GetExpiredPollIDs(time.Now())
+		if err != nil {
+			log.Println("❌ Error fetching expired polls:", err)
+			continue
+		}
+		for _, id := range ids {
+			closePoll(db, id)
+		}
+	}
+}
+
+// closePoll closes the poll, tells the author and pushes the final results.
+func closePoll(db *sql.DB, pollID int) error {
+	repo := repositories.NewPollRepository(db)
+	changed, err := repo.ClosePoll(pollID)
+	if err != nil {
+		log.Println("❌ Error closing poll:", err)
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	poll, err := repo.GetPoll(pollID, 0)
+	if err != nil {
+		log.Println("❌ Error retrieving closed poll:", err)
+		return err
+	}
+	websocket.SendNotification(poll.CreatorID, "poll_closed",
+		fmt.Sprintf("Your poll \"%s\" has closed with %d votes.", poll.Question, poll.TotalVotes))
+	websocket.BroadcastPollUpdate(poll)
+	return nil
+}
+
+// checkPollTarget applies the visibility of the post, or the group membership
+// for group posts, to the poll attached to it.
+func checkPollTarget(db *sql.DB, userID int, poll *models.Poll) error {
+	allowed, err := policy.CanAccessTarget(db, userID, poll.TargetType, poll.TargetID)
+	if err != nil || !allowed {
+		return errPollForbidden
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"social-network/internal/websocket/wstest"
+)
+
+// TestPollFollowsPostVisibility lets only those who may see the post see and
+// vote on its poll.
+func TestPollFollowsPostVisibility(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	wstest.Login(t, db, 1, "alice")
+	bob := wstest.Login(t, db, 2, "bob")
+	seed := []string{
+		`INSERT INTO posts (id, user_id, username, content, privacy) VALUES (1, 1, 'alice', 'followers only', 'followers')`,
+		`INSERT INTO polls (id, target_type, target_id, creator_id, question) VALUES (1, 'post', 1, 1, '?')`,
+		`INSERT INTO poll_options (id, poll_id, label, position) VALUES (1, 1, 'a', 0), (2, 1, 'b', 1)`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if w := serve(GetPollHandler, "GET", "/api/polls?poll_id=1", bob, ""); w.Code != http.StatusForbidden {
+		t.Errorf("reading the poll of a post bob cannot see: %d, want 403", w.Code)
+	}
+	if w := serve(VotePollHandler, "POST", "/api/polls/vote", bob, `{"poll_id":1,"option_ids":[1]}`); w.Code != http.StatusForbidden {
+		t.Errorf("voting on the poll of a post bob cannot see: %d, want 403", w.Code)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM poll_votes`); n != 0 {
+		t.Fatalf("%d votes recorded, want none", n)
+	}
+
+	if _, err := db.Exec(`INSERT INTO followers (follower_id, following_id, status) VALUES (2, 1, 'accepted')`); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(VotePollHandler, "POST", "/api/polls/vote", bob, `{"poll_id":1,"option_ids":[1]}`); w.Code != http.StatusOK {
+		t.Errorf("voting as a follower: %d %s, want 200", w.Code, w.Body)
+	}
+	if w := serve(ClosePollHandler, "POST", "/api/polls/close", bob, `{"poll_id":1}`); w.Code != http.StatusForbidden {
+		t.Errorf("closing the poll of somebody else: %d, want 403", w.Code)
+	}
+}
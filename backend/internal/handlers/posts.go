@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,7 +15,6 @@ import (
 	"social-network/internal/middlewars"
 	"social-network/internal/models"
 	"social-network/internal/repositories"
-	"social-network/internal/websocket"
 )
 
 func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -120,13 +118,14 @@ func GetAllPostsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(posts)
 }
 
+// LikePost is the legacy like/dislike endpoint, kept for the existing
+// buttons; it goes through the same reaction toggle as /api/reactions.
 func LikePost(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	db := config.GetDB()
 
 	var like models.Like
 	if err := json.NewDecoder(r.Body).Decode(&like); err != nil {
@@ -134,75 +133,30 @@ func LikePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var existingLike sql.NullBool
-	err := db.QueryRow("SELECT is_like FROM likes WHERE post_id = ? AND user_id = ?", like.Postid, user.ID).Scan(&existingLike)
-
-	if err != nil && err != sql.ErrNoRows {
-		log.Println("❌ Error retrieving like:", err)
-		http.Error(w, "Error checking like status", http.StatusInternalServerError)
-		return
-	}
-
-	// **Fetch Post Creator ID**
-	var postCreator int
-	err = db.QueryRow("SELECT user_id FROM posts WHERE id = ?", like.Postid).Scan(&postCreator)
+	summary, err := applyReaction(user, models.TargetPost, like.Postid, likeReaction(like.IsLike))
 	if err != nil {
-		log.Println("❌ Error retrieving creator ID:", err)
-		http.Error(w, "Cannot retrieve post creator ID", http.StatusInternalServerError)
+		writeReactionError(w, err)
 		return
 	}
 
-	notificationMsg := "liked your post."
-
-	// **✅ If like does NOT exist, INSERT it**
-	// if err == sql.ErrNoRows {
-	if !existingLike.Valid {
-		log.Println("🟢 Inserting new like into database...")
-		_, err = db.Exec("INSERT INTO likes (post_id, user_id, is_like) VALUES (?, ?, ?)", like.Postid, user.ID, like.IsLike)
-		if err != nil {
-			log.Println("❌ Error inserting like:", err)
-			http.Error(w, "Error adding like", http.StatusInternalServerError)
-			return
-		}
-
-		// **Send Notification**
-		if like.IsLike {
-			websocket.SendNotification(postCreator, "like", user.Nickname+" "+notificationMsg)
-		} else {
-			websocket.SendNotification(postCreator, "dislike", user.Nickname+" disliked your post.")
-		}
-	} else {
-		// **If like exists, update or remove it**
-		if existingLike.Valid && existingLike.Bool == like.IsLike {
-			log.Println("🟡 Removing existing like from database...")
-			_, err = db.Exec("DELETE FROM likes WHERE post_id = ? AND user_id = ?", like.Postid, user.ID)
-		} else {
-			log.Printf("🔍 Existing Like Check: err=%v, existingLike.Valid=%v, existingLike.Bool=%v", err, existingLike.Valid, existingLike.Bool)
-			log.Println("🟠 Updating like in database...")
-			_, err = db.Exec("UPDATE likes SET is_like = ? WHERE post_id = ? AND user_id = ?", like.IsLike, like.Postid, user.ID)
-		}
-
-		if err != nil {
-			log.Println("❌ Error updating/removing like:", err)
-			http.Error(w, "Error updating like/dislike", http.StatusInternalServerError)
-			return
-		}
-	}
-	likeCount, _ := repositories.GetLikeCount(like.Postid)
-	dislikeCount, _ := repositories.GetDislikeCount(like.Postid)
-
-	websocket.BroadcastPostUpdate(like.Postid, likeCount, dislikeCount)
-
 	response := map[string]any{
 		"message":     "Action successful",
 		"post_id":     like.Postid,
-		"likes":       likeCount,
-		"dislikes":    dislikeCount,
+		"likes":       summary.Counts["like"],
+		"dislikes":    summary.Counts["dislike"],
 		"user_action": like.IsLike,
+		"reactions":   summary,
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
+func likeReaction(isLike bool) string {
+	if isLike {
+		return "like"
+	}
+	return "dislike"
+}
+
 func GetUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 	user := middlewars.GetUserbySession(w, r)
 	if user.ID == 0 {
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/repositories"
+	"social-network/internal/websocket"
+)
+
+var (
+	errInvalidReactionTarget = errors.New("invalid reaction target")
+	errInvalidReaction       = errors.New("unknown reaction")
+	errTargetForbidden       = errors.New("you cannot access this")
+)
+
+// GetReactionTypesHandler returns the configured reaction set
+func GetReactionTypesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Reactions())
+}
+
+// GetReactionsHandler returns the reaction breakdown of a single target
+func GetReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	targetType := r.URL.Query().Get("target_type")
+	targetID, err := strconv.Atoi(r.URL.Query().Get("target_id"))
+	if err != nil || targetID == 0 || !repositories.IsValidTargetType(targetType) {
+		http.Error(w, "Invalid reaction target", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if err := checkTargetAccess(db, user.ID, targetType, targetID); err != nil {
+		writeReactionError(w, err)
+		return
+	}
+
+	summary, err := repositories.NewReactionRepository(db).GetReactionSummary(targetType, targetID, user.ID)
+	if err != nil {
+		log.Println("❌ Error retrieving reactions:", err)
+		http.Error(w, "Failed to retrieve reactions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// ReactHandler adds, switches or removes the user's reaction on any target
+func ReactHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.Reaction
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	summary, err := applyReaction(user, req.TargetType, req.TargetID, req.Reaction)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":     "Action successful",
+		"target_type": req.TargetType,
+		"target_id":   req.TargetID,
+		"reactions":   summary,
+	})
+}
+
+// applyReaction is the single toggle used by every reaction endpoint,
+// including the legacy like/dislike ones.
+func applyReaction(user models.User, targetType string, targetID int, reaction string) (models.ReactionSummary, error) {
+	if targetID == 0 || !repositories.IsValidTargetType(targetType) {
+		return models.ReactionSummary{}, errInvalidReactionTarget
+	}
+	if !config.IsValidReaction(reaction) {
+		return models.ReactionSummary{}, errInvalidReaction
+	}
+
+	db := config.GetDB()
+	if err := checkTargetAccess(db, user.ID, targetType, targetID); err != nil {
+		return models.ReactionSummary{}, err
+	}
+
+	repo := repositories.NewReactionRepository(db)
+	ownerID, err := repo.GetTargetOwner(targetType, targetID)
+	if err != nil {
+		return models.ReactionSummary{}, err
+	}
+
+	current, err := repo.ToggleReaction(targetType, targetID, user.ID, reaction)
+	if err != nil {
+		log.Println("❌ Error updating reaction:", err)
+		return models.ReactionSummary{}, err
+	}
+
+	summary, err := repo.GetReactionSummary(targetType, targetID, user.ID)
+	if err != nil {
+		log.Println("❌ Error retrieving reactions:", err)
+		return models.ReactionSummary{}, err
+	}
+
+	if current != "" && ownerID != user.ID {
+		notifyReaction(user, ownerID, targetType, current)
+	}
+
+	switch targetType {
+	case models.TargetPost:
+		websocket.BroadcastPostUpdate(targetID, summary)
+	case models.TargetMessage:
+		var receiverID int
+		db.QueryRow("SELECT receiver_id FROM messages WHERE id = ?", targetID).Scan(&receiverID)
+		websocket.BroadcastReactionUpdate(targetType, targetID, summary, ownerID, receiverID)
+	default:
+		websocket.BroadcastReactionUpdate(targetType, targetID, summary)
+	}
+	return summary, nil
+}
+
+func writeReactionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidReactionTarget), errors.Is(err, errInvalidReaction):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Target not found", http.StatusNotFound)
+	case errors.Is(err, errTargetForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, "Error updating reaction", http.StatusInternalServerError)
+	}
+}
+
+// checkTargetAccess makes sure the target exists and that userID may access
+// it under policy.CanAccessTarget.
+func checkTargetAccess(db *sql.DB, userID int, targetType string, targetID int) error {
+	if !repositories.IsValidTargetType(targetType) {
+		return errInvalidReactionTarget
+	}
+	allowed, err := policy.CanAccessTarget(db, userID, targetType, targetID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errTargetForbidden
+	}
+	return nil
+}
+
+func notifyReaction(user models.User, ownerID int, targetType, reaction string) {
+	var what string
+	switch targetType {
+	case models.TargetPost, models.TargetGroupPost:
+		what = "your post."
+	case models.TargetComment, models.TargetGroupComment:
+		what = "your comment."
+	default:
+		// reactions on chat messages are shown live in the conversation
+		return
+	}
+
+	switch reaction {
+	case "like":
+		websocket.SendNotificationFrom(user.ID, ownerID, "like", user.Nickname+" liked "+what)
+	case "dislike":
+		websocket.SendNotificationFrom(user.ID, ownerID, "dislike", user.Nickname+" disliked "+what)
+	default:
+		emoji := reaction
+		for _, rt := range config.Reactions() {
+			if rt.Key == reaction && rt.Emoji != "" {
+				emoji = rt.Emoji
+			}
+		}
+		websocket.SendNotificationFrom(user.ID, ownerID, "reaction", user.Nickname+" reacted "+emoji+" to "+what)
+	}
+}
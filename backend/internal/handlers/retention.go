@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/repositories"
+	ws "social-network/internal/websocket"
+)
+
+// lifetimeLabels phrase the timers of repositories.MessageLifetimes in
+// system messages
+var lifetimeLabels = map[string]string{"24h": "24 hours", "7d": "7 days", "90d": "90 days"}
+
+// timerChangedText is the system message posted when a user sets a chat's
+// disappearing message timer.
+func timerChangedText(nickname, lifetime string) string {
+	if lifetime == "off" {
+		return fmt.Sprintf("%s turned off disappearing messages", nickname)
+	}
+	return fmt.Sprintf("%s set disappearing messages to %s", nickname, lifetimeLabels[lifetime])
+}
+
+// GetChatRetentionHandler returns the disappearing message timer of the
+// conversation with user_id.
+func GetChatRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	peerID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || peerID == 0 {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	retention, err := repositories.NewRetentionRepository(config.GetDB()).ConversationRetention(userID, peerID)
+	if err != nil {
+		log.Println("❌ Error retrieving chat retention:", err)
+		http.Error(w, "Failed to retrieve disappearing messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retention)
+}
+
+// SetChatRetentionHandler sets the disappearing message timer of the
+// conversation with user_id, {"user_id", "lifetime"}, and posts the change in
+// the conversation. Either side may change it once they may write to each
+// other directly, see policy.CheckMessage.
+func SetChatRetentionHandler(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserID   int    `json:"user_id"`
+		Lifetime string `json:"lifetime"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == 0 || req.UserID == user.ID {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	lifetime, err := repositories.ParseLifetime(req.Lifetime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	// the timer change is posted in the conversation, so a message request
+	// is not enough
+	decision, err := policy.CheckMessage(db, user.ID, req.UserID)
+	if err != nil {
+		log.Println("❌ Failed to check messaging permission:", err)
+		http.Error(w, "Failed to check messaging permission", http.StatusInternalServerError)
+		return
+	}
+	if decision != policy.MessageAllowed {
+		http.Error(w, "You cannot change the timer of this conversation: "+decision, http.StatusForbidden)
+		return
+	}
+
+	retentions := repositories.NewRetentionRepository(db)
+	current, err := retentions.ConversationRetention(user.ID, req.UserID)
+	if err == nil && current.Lifetime != req.Lifetime {
+		err = retentions.SetConversationLifetime(user.ID, req.UserID, lifetime)
+		if err == nil {
+			postChatTimerChange(hub, user, req.UserID, req.Lifetime)
+		}
+	}
+	if err != nil {
+		log.Println("❌ Error setting chat retention:", err)
+		http.Error(w, "Failed to set disappearing messages", http.StatusInternalServerError)
+		return
+	}
+
+	retention, err := retentions.ConversationRetention(user.ID, req.UserID)
+	if err != nil {
+		log.Println("❌ Error retrieving chat retention:", err)
+		http.Error(w, "Failed to retrieve disappearing messages", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retention)
+}
+
+// postChatTimerChange posts the system message of a timer change in the
+// conversation and sends it to both sides.
+func postChatTimerChange(hub *Hub, user models.User, peerID int, lifetime string) {
+	saved, _, err := repositories.NewChatRepository(config.GetDB()).SaveMessage(repositories.MessageDraft{
+		SenderID:   user.ID,
+		ReceiverID: peerID,
+		Content:    timerChangedText(user.Nickname, lifetime),
+		System:     true,
+	})
+	if err != nil {
+		log.Println("❌ Failed to post timer change:", err)
+		return
+	}
+	payload, _ := json.Marshal(saved)
+	hub.publish(peerID, outbound{payload: payload, messageID: saved.ID}, nil)
+	hub.publish(user.ID, outbound{payload: payload}, nil)
+}
+
+// GetGroupChatRetentionHandler returns the disappearing message timer of
+// the chat of group_id.
+func GetGroupChatRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
+	if err != nil || groupID == 0 {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if !requireGroupMember(w, db, userID, groupID) {
+		return
+	}
+	retention, err := repositories.NewRetentionRepository(db).GroupRetention(groupID)
+	if err != nil {
+		log.Println("❌ Error retrieving group chat retention:", err)
+		http.Error(w, "Failed to retrieve disappearing messages", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retention)
+}
+
+// SetGroupChatRetentionHandler lets the group admin set the disappearing
+// message timer of every channel of the group chat, {"group_id",
+// "lifetime"}. The change is posted in the channels that are not archived.
+func SetGroupChatRetentionHandler(hub *ws.GroupHub, w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		GroupID  int    `json:"group_id"`
+		Lifetime string `json:"lifetime"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GroupID == 0 {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	lifetime, err := repositories.ParseLifetime(req.Lifetime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	db := config.GetDB()
+	if !requireGroupAdmin(w, db, user.ID, req.GroupID) {
+		return
+	}
+
+	retentions := repositories.NewRetentionRepository(db)
+	current, err := retentions.GroupRetention(req.GroupID)
+	if err == nil && current.Lifetime != req.Lifetime {
+		err = retentions.SetGroupLifetime(user.ID, req.GroupID, lifetime)
+		if err == nil {
+			postGroupTimerChange(hub, user, req.GroupID, req.Lifetime)
+		}
+	}
+	if err != nil {
+		log.Println("❌ Error setting group chat retention:", err)
+		http.Error(w, "Failed to set disappearing messages", http.StatusInternalServerError)
+		return
+	}
+
+	retention, err := retentions.GroupRetention(req.GroupID)
+	if err != nil {
+		log.Println("❌ Error retrieving group chat retention:", err)
+		http.Error(w, "Failed to retrieve disappearing messages", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retention)
+}
+
+// postGroupTimerChange posts the system message of a timer change in each
+// open channel of the group chat.
+func postGroupTimerChange(hub *ws.GroupHub, admin models.User, groupID int, lifetime string) {
+	db := config.GetDB()
+	channels, err := repositories.NewGroupChannelRepository(db).ListChannels(admin.ID, groupID)
+	if err != nil {
+		log.Println("❌ Failed to post timer change:", err)
+		return
+	}
+	chats := repositories.NewGroupChatRepository(db)
+	for _, channel := range channels {
+		if channel.ArchivedAt != nil {
+			continue
+		}
+		saved, _, err := chats.SaveGroupChatMessage(repositories.MessageDraft{
+			SenderID:  admin.ID,
+			GroupID:   groupID,
+			ChannelID: channel.ID,
+			Content:   timerChangedText(admin.Nickname, lifetime),
+			System:    true,
+		})
+		if err != nil {
+			log.Printf("❌ Failed to post timer change in Channel %d: %v", channel.ID, err)
+			continue
+		}
+		hub.Publish(channel.ID, saved)
+	}
+}
+
+// GetMaxRetentionHandler returns the site's maximum message lifetime to
+// site admins.
+func GetMaxRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	admin := middlewars.GetUserbySession(w, r)
+	if admin.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if admin.Role != models.RoleAdmin {
+		http.Error(w, "Only site admins can manage message retention", http.StatusForbidden)
+		return
+	}
+
+	max, err := repositories.NewRetentionRepository(config.GetDB()).MaxLifetime()
+	if err != nil {
+		log.Println("❌ Error retrieving max retention:", err)
+		http.Error(w, "Failed to retrieve message retention", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"max_lifetime": repositories.LifetimeName(max)})
+}
+
+// SetMaxRetentionHandler lets site admins cap how long any chat message is
+// kept, {"max_lifetime"}, off for no cap. The cap also applies to messages
+// already sent.
+func SetMaxRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	admin := middlewars.GetUserbySession(w, r)
+	if admin.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if admin.Role != models.RoleAdmin {
+		http.Error(w, "Only site admins can manage message retention", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		MaxLifetime string `json:"max_lifetime"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	max, err := repositories.ParseLifetime(req.MaxLifetime)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := repositories.NewRetentionRepository(config.GetDB()).SetMaxLifetime(admin.ID, max); err != nil {
+		log.Println("❌ Error setting max retention:", err)
+		http.Error(w, "Failed to set message retention", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🗑️ Admin %d set the maximum message lifetime to %s", admin.ID, req.MaxLifetime)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"max_lifetime": req.MaxLifetime})
+}
+
+// unclaimedUploadAge is how long a chat upload waits for a message to send it
+// before the reaper removes it
+const unclaimedUploadAge = 24 * time.Hour
+
+// RunMessageReaper deletes the chat messages whose lifetime is over, with
+// their attachments, and the uploads no message took, checking every
+// interval. It returns once quit is closed.
+func RunMessageReaper(interval time.Duration, quit <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+		deleted, err := repositories.NewRetentionRepository(config.GetDB()).DeleteExpired()
+		if err != nil {
+			log.Println("❌ Error deleting expired messages:", err)
+		}
+		if deleted > 0 {
+			log.Printf("🗑️ Deleted %d expired chat messages", deleted)
+		}
+
+		removed, err := repositories.NewAttachmentRepository(config.GetDB()).DeleteUnclaimed(unclaimedUploadAge)
+		if err != nil {
+			log.Println("❌ Error deleting unclaimed chat uploads:", err)
+		}
+		if removed > 0 {
+			log.Printf("🗑️ Deleted %d unclaimed chat uploads", removed)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/repositories"
+)
+
+// GetFollowSuggestionsHandler returns a page of ranked follow suggestions,
+// each with the reason it was suggested
+func GetFollowSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit, offset := pageParams(r)
+
+	db := config.GetDB()
+	suggestions, err := repositories.NewSuggestionRepository(db).GetSuggestions(user.ID, limit, offset)
+	if err != nil {
+		log.Println("❌ Error fetching follow suggestions:", err)
+		http.Error(w, "Failed to retrieve suggestions", http.StatusInternalServerError)
+		return
+	}
+	for i := range suggestions {
+		visible, err := policy.ProfileFor(db, user.ID, &suggestions[i].User)
+		if err != nil {
+			log.Println("❌ Error applying profile privacy:", err)
+			http.Error(w, "Failed to retrieve suggestions", http.StatusInternalServerError)
+			return
+		}
+		suggestions[i].User = *visible
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// DismissSuggestionHandler stops suggesting a user to the session user
+func DismissSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var target models.User
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil || target.ID == 0 || target.ID == user.ID {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := repositories.NewSuggestionRepository(config.GetDB()).DismissSuggestion(user.ID, target.ID); err != nil {
+		log.Println("❌ Error dismissing suggestion:", err)
+		http.Error(w, "Failed to dismiss suggestion", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Suggestion dismissed"})
+}
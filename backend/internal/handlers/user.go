@@ -1,16 +1,20 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
 	"social-network/internal/models"
+	"social-network/internal/policy"
 	"social-network/internal/repositories"
+	"social-network/internal/websocket"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -98,6 +102,10 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	if storedUser.IsSuspended() {
+		http.Error(w, "Account suspended until "+storedUser.SuspendedUntil.Format(time.RFC3339), http.StatusForbidden)
+		return
+	}
 
 	middlewars.DeleteSession(storedUser.ID)
 	// Set session
@@ -142,6 +150,27 @@ func GetUserData(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to retrieve userData", http.StatusInternalServerError)
 		return
 	}
+	if userData == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	blocked, err := policy.IsBlocked(db, user.ID, viewingUserID)
+	if err != nil {
+		log.Println("❌ Error checking blocks:", err)
+		http.Error(w, "Failed to retrieve userData", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	userData, err = policy.ProfileFor(db, user.ID, userData)
+	if err != nil {
+		log.Println("❌ Error applying profile privacy:", err)
+		http.Error(w, "Failed to retrieve userData", http.StatusInternalServerError)
+		return
+	}
 	json.NewEncoder(w).Encode(userData)
 }
 
@@ -184,16 +213,33 @@ func UpdatePrivacy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update the privacy setting in the database
-	_, err = db.Exec("UPDATE users SET is_private = ? WHERE id = ?", req.IsPrivate, user.ID)
+	// Update the privacy setting, a public profile has nothing left to approve
+	followRepo := repositories.NewFollowRepository(db)
+	requesters, err := followRepo.SetPrivacy(user.ID, req.IsPrivate)
 	if err != nil {
+		log.Println("❌ Error updating the privacy setting:", err)
 		http.Error(w, "Database update failed", http.StatusInternalServerError)
 		return
 	}
 
+	response := map[string]any{"message": "Privacy setting updated successfully"}
+	if !req.IsPrivate {
+		for _, requesterID := range requesters {
+			websocket.SendNotificationFrom(user.ID, requesterID, "follow", fmt.Sprintf("%s accepted your follow request!", user.Nickname))
+		}
+		response["accepted_requests"] = len(requesters)
+	} else {
+		// existing followers keep their access, let the user review them
+		followers, _, err := followRepo.GetFollowCounts(user.ID)
+		if err != nil {
+			log.Println("❌ Error counting followers:", err)
+		}
+		response["followers_to_review"] = followers
+	}
+
 	// Respond with success message
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message": "Privacy setting updated successfully"}`))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
@@ -222,7 +268,76 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	users, err = visibleProfiles(db, user.ID, users)
+	if err != nil {
+		log.Println("❌ Error applying profile privacy:", err)
+		http.Error(w, "Failed to retrieve users", http.StatusInternalServerError)
+		return
+	}
+
 	// Send response as JSON
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(users)
 }
+
+// visibleProfiles replaces every user of a list with what viewerID may see of them
+func visibleProfiles(db *sql.DB, viewerID int, users []models.User) ([]models.User, error) {
+	for i := range users {
+		visible, err := policy.ProfileFor(db, viewerID, &users[i])
+		if err != nil {
+			return nil, err
+		}
+		users[i] = *visible
+	}
+	return users, nil
+}
+
+// UpdateProfilePrivacy sets who may see the email, birthdate, gender and real
+// name of the logged-in user. Fields left empty keep their current setting.
+func UpdateProfilePrivacy(w http.ResponseWriter, r *http.Request) {
+	user := middlewars.GetUserbySession(w, r)
+	if user.ID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ProfilePrivacy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	repo := repositories.NewUserRepository(config.GetDB())
+	current, err := repo.GetUserDataById(user.ID)
+	if err != nil || current == nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		return
+	}
+	privacy := *current.FieldPrivacy
+	for _, field := range []struct {
+		value string
+		dest  *string
+	}{
+		{req.Email, &privacy.Email},
+		{req.Birthdate, &privacy.Birthdate},
+		{req.Gender, &privacy.Gender},
+		{req.Name, &privacy.Name},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if !models.ValidVisibility(field.value) {
+			http.Error(w, "Visibility must be public, followers or only_me", http.StatusBadRequest)
+			return
+		}
+		*field.dest = field.value
+	}
+
+	if err := repo.UpdateProfilePrivacy(user.ID, privacy); err != nil {
+		log.Println("❌ Error updating profile privacy:", err)
+		http.Error(w, "Database update failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(privacy)
+}
@@ -1,10 +1,12 @@
 package middlewars
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"social-network/internal/config"
 	"social-network/internal/models"
@@ -53,15 +55,20 @@ func DeleteSession(id int) {
 
 func GetUserBy_username(u string) models.User {
 	db := config.GetDB()
-	query := "SELECT * FROM users WHERE nickname = ?"
+	query := `SELECT id, nickname, email, password, age, gender, first_name, last_name, date_of_birth, is_private, role, suspended_until
+		FROM users WHERE nickname = ?`
 	var theUser models.User
+	var suspendedUntil sql.NullTime
 	err := db.QueryRow(query, u).Scan(
 		&theUser.ID, &theUser.Nickname, &theUser.Email, &theUser.Password,
 		&theUser.Age, &theUser.Gender, &theUser.FirstName, &theUser.LastName, &theUser.Birthdate,
-		&theUser.IsPrivate)
+		&theUser.IsPrivate, &theUser.Role, &suspendedUntil)
 	if err != nil {
 		log.Println(err, "error in querying usr")
 	}
+	if suspendedUntil.Valid {
+		theUser.SuspendedUntil = &suspendedUntil.Time
+	}
 	return theUser
 }
 
@@ -83,7 +90,13 @@ func GetUserbySession(w http.ResponseWriter, r *http.Request) models.User {
 		log.Println("No session cookie found in db")
 		return models.User{}
 	}
-	return GetUserBy_username(username)
+	user := GetUserBy_username(username)
+	if user.IsSuspended() {
+		http.Error(w, "Account suspended until "+user.SuspendedUntil.Format(time.RFC3339), http.StatusForbidden)
+		log.Println("Rejected session of suspended user", user.ID)
+		return models.User{}
+	}
+	return user
 }
 
 func Logout(w http.ResponseWriter, r *http.Request) {
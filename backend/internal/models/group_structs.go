@@ -9,6 +9,9 @@ type Group struct {
 	CreatorID   int    `json:"creator_id"`
 	CreatorName string `json:"creator_nickname"` // New field
 	MemberCount int    `json:"member_count"`
+	// chat state of the viewer, only filled in the chat list
+	UnreadCount int               `json:"unread_count,omitempty"`
+	LastMessage *GroupChatMessage `json:"last_message,omitempty"`
 }
 
 type GroupMember struct {
@@ -19,40 +22,66 @@ type GroupMember struct {
 }
 
 type GroupComment struct {
-	ID       int     `json:"id"`
-	MemberID int     `json:"member_id"`
-	GPostID  int     `json:"g_post_id"`
-	Content  string  `json:"content"`
-	Image    *string `json:"image,omitempty"` // Optional field
-	Nickname string  `json:"nickname"`
-	GroupID  int     `json:"group_id"`
+	ID        int             `json:"id"`
+	MemberID  int             `json:"member_id"`
+	GPostID   int             `json:"g_post_id"`
+	ParentID  *int            `json:"parent_id"`
+	Content   string          `json:"content"`
+	Image     *string         `json:"image,omitempty"` // Optional field
+	Nickname  string          `json:"nickname"`
+	GroupID   int             `json:"group_id"`
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+	EditedAt  *time.Time      `json:"edited_at,omitempty"`
+	Reactions ReactionSummary `json:"reactions"`
+	Replies   []GroupComment  `json:"replies"`
 }
 
 type GroupPost struct {
-	ID           int     `json:"id"`
-	GroupID      int     `json:"group_id"`
-	MemberID     int     `json:"member_id"`
-	Content      string  `json:"content"`
-	Image        *string `json:"image,omitempty"` // Optional field
-	CreatedAt    string  `json:"created_at"`
-	Nickname     string  `json:"nickname"`
-	LikeCount    int     `json:"likes"`
-	DisLikeCount int     `json:"dislikes"`
+	ID           int             `json:"id"`
+	GroupID      int             `json:"group_id"`
+	MemberID     int             `json:"member_id"`
+	Content      string          `json:"content"`
+	Image        *string         `json:"image,omitempty"` // Optional field
+	CreatedAt    string          `json:"created_at"`
+	Nickname     string          `json:"nickname"`
+	LikeCount    int             `json:"likes"`
+	DisLikeCount int             `json:"dislikes"`
+	Reactions    ReactionSummary `json:"reactions"`
+	Poll         *Poll           `json:"poll,omitempty"`
 }
 
-type GroupLike struct {
-	ID       int  `json:"id"`
-	PostID   int  `json:"post_id"`
-	MemberID int  `json:"member_id"`
-	IsLike   bool `json:"is_like"` // true for like, false for dislike
+type GroupChatMessage struct {
+	ID        int       `json:"id"`
+	GroupID   int       `json:"group_id"`
+	ChannelID int       `json:"channel_id"`
+	SenderID  int       `json:"sender_id"`
+	Nickname  string    `json:"nickname"`
+	Content   string    `json:"content"`
+	SentAt    time.Time `json:"sent_at"`
+
+	ReplyTo     *MessageQuote    `json:"reply_to,omitempty"`
+	EditedAt    *time.Time       `json:"edited_at,omitempty"`
+	Deleted     bool             `json:"deleted,omitempty"`
+	Attachments []ChatAttachment `json:"attachments,omitempty"`
+	ClientID    string           `json:"client_id,omitempty"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty"`
+	System      bool             `json:"system,omitempty"`
 }
 
-type GroupChatMessage struct {
-	ID       int       `json:"id"`
-	GroupID  int       `json:"group_id"`
-	SenderID int       `json:"sender_id"`
-	Content  string    `json:"content"`
-	SentAt   time.Time `json:"sent_at"`
+// GroupChannel is a topic channel of a group chat. A private channel is only
+// seen by its members and the group's admin, an archived one is read only.
+type GroupChannel struct {
+	ID         int        `json:"id"`
+	GroupID    int        `json:"group_id"`
+	Name       string     `json:"name"`
+	Private    bool       `json:"private"`
+	IsDefault  bool       `json:"is_default"` // #general, where messages without a channel go
+	CreatorID  int        `json:"creator_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// chat state of the viewer, only filled in the channel list
+	UnreadCount int               `json:"unread_count"`
+	LastMessage *GroupChatMessage `json:"last_message,omitempty"`
 }
 
 type GroupEvent struct {
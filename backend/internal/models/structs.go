@@ -13,18 +13,62 @@ type User struct {
 	LastName  string `json:"last_name"`
 	Birthdate string `json:"dbirth"`
 	IsPrivate bool   `json:"isprivate"`
+	Role      string `json:"role,omitempty"` // "user", "moderator" or "admin"
+	// SuspendedUntil is set while a moderator has suspended the account
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	// FieldPrivacy is only sent to the profile's owner
+	FieldPrivacy *ProfilePrivacy `json:"field_privacy,omitempty"`
+}
+
+// ProfilePrivacy says who may see each optional profile field.
+type ProfilePrivacy struct {
+	Email     string `json:"email"`
+	Birthdate string `json:"birthdate"` // also covers age
+	Gender    string `json:"gender"`
+	Name      string `json:"name"` // first and last name
+}
+
+// Visibility levels of a profile field, see ProfilePrivacy
+const (
+	VisibilityPublic    = "public"
+	VisibilityFollowers = "followers"
+	VisibilityOnlyMe    = "only_me"
+)
+
+// ValidVisibility reports whether v is a known visibility level.
+func ValidVisibility(v string) bool {
+	return v == VisibilityPublic || v == VisibilityFollowers || v == VisibilityOnlyMe
+}
+
+// Site roles, see User.Role
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// IsModerator reports whether the user may work the moderation queue.
+func (u User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// IsSuspended reports whether the account is currently suspended.
+func (u User) IsSuspended() bool {
+	return u.SuspendedUntil != nil && u.SuspendedUntil.After(time.Now())
 }
 
 type Post struct {
-	ID           int       `json:"id"`
-	UserID       int       `json:"user_id"`
-	Nickname     string    `json:"nickname"`
-	Content      string    `json:"content"`
-	Image        *string   `json:"image"` // Nullable field
-	Privacy      string    `json:"privacy"`
-	CreatedAt    time.Time `json:"created_at"`
-	LikeCount    int       `json:"likes"`
-	DisLikeCount int       `json:"dislikes"`
+	ID           int             `json:"id"`
+	UserID       int             `json:"user_id"`
+	Nickname     string          `json:"nickname"`
+	Content      string          `json:"content"`
+	Image        *string         `json:"image"` // Nullable field
+	Privacy      string          `json:"privacy"`
+	CreatedAt    time.Time       `json:"created_at"`
+	LikeCount    int             `json:"likes"`
+	DisLikeCount int             `json:"dislikes"`
+	Reactions    ReactionSummary `json:"reactions"`
+	Poll         *Poll           `json:"poll,omitempty"`
 }
 
 type Notification struct {
@@ -51,6 +95,23 @@ type Follow struct {
 	Status      string `json:"status"` // "pending" or "accepted"
 }
 
+// NetworkUser is a user listed in someone's followers or following
+type NetworkUser struct {
+	User
+	Status           string `json:"status,omitempty"` // follow status, only in following lists
+	FollowedByViewer bool   `json:"followed_by_viewer"`
+}
+
+// FollowSuggestion is a user the viewer may want to follow and why
+type FollowSuggestion struct {
+	User            User   `json:"user"`
+	MutualFollowers int    `json:"mutual_followers"`
+	SharedGroups    int    `json:"shared_groups"`
+	SharedEvents    int    `json:"shared_events"`
+	RecentPosts     int    `json:"recent_posts"`
+	Reason          string `json:"reason"` // e.g. "3 mutual followers"
+}
+
 type EventRSVP struct {
 	ID        int    `json:"id"`
 	EventID   int    `json:"event_id"`
@@ -60,12 +121,17 @@ type EventRSVP struct {
 }
 
 type Comment struct {
-	ID       int    `json:"id"`
-	PostID   int    `json:"post_id"`
-	UserID   int    `json:"user_id"`
-	Content  string `json:"content"`
-	Image    string `json:"image"`
-	Nickname string `json:"nickname"`
+	ID        int             `json:"id"`
+	PostID    int             `json:"post_id"`
+	UserID    int             `json:"user_id"`
+	ParentID  *int            `json:"parent_id"`
+	Content   string          `json:"content"`
+	Image     string          `json:"image"`
+	Nickname  string          `json:"nickname"`
+	CreatedAt *time.Time      `json:"created_at,omitempty"`
+	EditedAt  *time.Time      `json:"edited_at,omitempty"` // set once the author edits it
+	Reactions ReactionSummary `json:"reactions"`
+	Replies   []Comment       `json:"replies"`
 }
 
 type ChatMessage struct {
@@ -75,14 +141,175 @@ type ChatMessage struct {
 	GroupID    *int      `json:"group_id,omitempty"`    // Nullable for direct messages
 	Content    string    `json:"content"`
 	SentAt     time.Time `json:"sent_at"`
+
+	ReplyTo     *MessageQuote    `json:"reply_to,omitempty"`
+	EditedAt    *time.Time       `json:"edited_at,omitempty"` // set once the sender edited it
+	Deleted     bool             `json:"deleted,omitempty"`   // unsent by the sender, the content is gone
+	Attachments []ChatAttachment `json:"attachments,omitempty"`
+	ClientID    string           `json:"client_id,omitempty"`    // the sender's id for it, see MessageDraft
+	DeliveredAt *time.Time       `json:"delivered_at,omitempty"` // first written to a connection of the recipient
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty"`   // a disappearing message is deleted then
+	System      bool             `json:"system,omitempty"`       // posted for the conversation, e.g. a timer change
+}
+
+// MessageRetention is the disappearing message timer of a conversation or
+// group chat: off, 24h, 7d or 90d. Messages live for the shorter of Lifetime
+// and the site's MaxLifetime, Effective.
+type MessageRetention struct {
+	Lifetime    string     `json:"lifetime"`
+	MaxLifetime string     `json:"max_lifetime"`
+	Effective   string     `json:"effective"`
+	SetBy       int        `json:"set_by,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// MessageSearchResult is a direct (ReceiverID set) or group (GroupID set)
+// message that matched a chat search. HistoryBefore, passed as ?before= to
+// the matching history endpoint, opens the history at the message.
+type MessageSearchResult struct {
+	ChatMessage
+	Nickname      string `json:"nickname"`             // the sender
+	ChannelID     *int   `json:"channel_id,omitempty"` // of a group message
+	HistoryBefore int    `json:"history_before"`
+}
+
+// ChatAttachment is a file sent in a direct or group chat. The file is only
+// served, at URL, to the people who can read the message.
+type ChatAttachment struct {
+	ID           int    `json:"id"`
+	FileName     string `json:"file_name"`
+	MimeType     string `json:"mime_type"`
+	Size         int64  `json:"size"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"` // images only
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+
+	UploaderID     int    `json:"-"`
+	MessageID      *int   `json:"-"`
+	GroupMessageID *int   `json:"-"`
+	Path           string `json:"-"`
+	ThumbnailPath  string `json:"-"`
 }
 
+// MessageQuote is the earlier chat message a reply quotes
+type MessageQuote struct {
+	ID       int    `json:"id"`
+	SenderID int    `json:"sender_id"`
+	Content  string `json:"content"` // a preview, empty once deleted
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+// Presence is whether a user is connected to chat. It only lives in memory.
+type Presence struct {
+	UserID   int        `json:"user_id"`
+	Status   string     `json:"status"` // "online", "away" or "offline"
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// ChatSummary is one conversation in the recent chats list
+type ChatSummary struct {
+	ID              int         `json:"id"` // the other user
+	Nickname        string      `json:"nickname"`
+	FirstName       string      `json:"first_name"`
+	LastName        string      `json:"last_name"`
+	LastMessageTime time.Time   `json:"last_message_time"`
+	LastMessage     ChatMessage `json:"last_message"` // content cut to a preview
+	UnreadCount     int         `json:"unread_count"`
+	// PeerLastReadID is the last message the other user has read
+	PeerLastReadID int `json:"peer_last_read_id"`
+}
+
+// Like is the legacy like/dislike payload still accepted by /api/like and
+// /api/groups/like; it is mapped onto the "like" and "dislike" reactions.
 type Like struct {
 	ID     int  `json:"id"`
 	Postid int  `json:"postid"`
 	IsLike bool `json:"islike"`
 }
 
+// Target types, shared by reactions, polls and reports. Only reports can
+// target a user.
+const (
+	TargetUser         = "user"
+	TargetPost         = "post"
+	TargetGroupPost    = "group_post"
+	TargetComment      = "comment"
+	TargetGroupComment = "group_comment"
+	TargetMessage      = "message"
+	TargetGroupMessage = "group_message"
+)
+
+type ReactionType struct {
+	Key   string `json:"key"`
+	Emoji string `json:"emoji"`
+}
+
+type Reaction struct {
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	Reaction   string `json:"reaction"`
+}
+
+// ReactionSummary is the per-reaction breakdown of a single target plus the
+// reaction of the user asking for it (empty if they haven't reacted).
+type ReactionSummary struct {
+	Counts         map[string]int `json:"counts"`
+	Total          int            `json:"total"`
+	ViewerReaction string         `json:"viewer_reaction"`
+}
+
+type Poll struct {
+	ID             int          `json:"id"`
+	TargetType     string       `json:"target_type"` // "post" or "group_post"
+	TargetID       int          `json:"target_id"`
+	CreatorID      int          `json:"creator_id"`
+	Question       string       `json:"question"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	Anonymous      bool         `json:"anonymous"`
+	ClosesAt       *time.Time   `json:"closes_at"` // Nullable, open until closed by hand
+	Closed         bool         `json:"closed"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Options        []PollOption `json:"options"`
+	TotalVotes     int          `json:"total_votes"`
+	ViewerVotes    []int        `json:"viewer_votes"` // Option ids the viewer voted for
+}
+
+type PollOption struct {
+	ID     int      `json:"id"`
+	Label  string   `json:"label"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"` // Nicknames, only for non-anonymous polls
+}
+
+type Report struct {
+	ID           int       `json:"id"`
+	ReporterID   int       `json:"reporter_id"`
+	Reporter     string    `json:"reporter_nickname"`
+	TargetType   string    `json:"target_type"`
+	TargetID     int       `json:"target_id"`
+	TargetUserID int       `json:"target_user_id"`
+	TargetUser   string    `json:"target_user_nickname"`
+	Preview      string    `json:"preview"`      // Content of the reported item at query time
+	ReportCount  int       `json:"report_count"` // Open reports on the same target
+	Reason       string    `json:"reason"`
+	Status       string    `json:"status"` // "open", "resolved" or "dismissed"
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ModerationAction struct {
+	ID           int       `json:"id"`
+	ModeratorID  int       `json:"moderator_id"`
+	Moderator    string    `json:"moderator_nickname"`
+	Action       string    `json:"action"` // "hide", "delete", "warn", "suspend", "dismiss" or "role"
+	TargetType   string    `json:"target_type"`
+	TargetID     int       `json:"target_id"`
+	TargetUserID *int      `json:"target_user_id"`
+	ReportID     *int      `json:"report_id"`
+	Note         string    `json:"note"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
 type PostVisibility struct {
 	PostCreator int `json:"post_creator"` // The user who created the post
 	UserID      int `json:"user_id"`      // The user allowed to see the post
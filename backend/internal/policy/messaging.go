@@ -0,0 +1,66 @@
+package policy
+
+import (
+	"database/sql"
+)
+
+// Outcomes of CheckMessage. Anything but MessageAllowed and MessageRequest
+// is a rejection, sent back to the sender as the error of a socket event.
+const (
+	MessageAllowed          = "allowed"
+	MessageRequest          = "request" // goes to the receiver's message requests
+	MessageUnknownRecipient = "unknown_recipient"
+	MessageBlocked          = "blocked"
+	MessageRecipientPrivate = "recipient_private"
+	MessageRequestDeclined  = "request_declined"
+)
+
+// CheckMessage decides what happens to a direct message from senderID to
+// receiverID. It goes straight to the conversation when either follows the
+// other, when the receiver accepted the sender's request or wrote to the
+// sender before. Otherwise a public receiver gets it as a message request and
+// a private one never gets it. Blocks always win.
+func CheckMessage(db *sql.DB, senderID, receiverID int) (string, error) {
+	var isPrivate bool
+	err := db.QueryRow(`SELECT is_private FROM users WHERE id = ?`, receiverID).Scan(&isPrivate)
+	if err == sql.ErrNoRows || senderID == receiverID {
+		return MessageUnknownRecipient, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if blocked, err := IsBlocked(db, senderID, receiverID); err != nil || blocked {
+		return MessageBlocked, err
+	}
+
+	follows, err := exists(db, `
+		SELECT 1 FROM followers
+		WHERE status = 'accepted'
+			AND ((follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?))`,
+		senderID, receiverID, receiverID, senderID)
+	if err != nil || follows {
+		return MessageAllowed, err
+	}
+
+	var status string
+	err = db.QueryRow(`SELECT status FROM message_requests WHERE sender_id = ? AND receiver_id = ?`, senderID, receiverID).Scan(&status)
+	switch {
+	case err != nil && err != sql.ErrNoRows:
+		return "", err
+	case status == "accepted":
+		return MessageAllowed, nil
+	case status == "declined":
+		return MessageRequestDeclined, nil
+	case status == "pending":
+		return MessageRequest, nil
+	}
+
+	wroteBefore, err := exists(db, `SELECT 1 FROM messages WHERE sender_id = ? AND receiver_id = ?`, receiverID, senderID)
+	if err != nil || wroteBefore {
+		return MessageAllowed, err
+	}
+	if isPrivate {
+		return MessageRecipientPrivate, nil
+	}
+	return MessageRequest, nil
+}
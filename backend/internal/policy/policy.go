@@ -0,0 +1,252 @@
+// Package policy holds the visibility and authorization rules of the site.
+//
+// The single checks (CanViewPost, CanMessage, ...) and the SQL fragments used
+// by list queries (VisiblePosts, NotBlocked, ...) are built from the same
+// conditions, so a post that shows up in a feed is always a post the viewer
+// may open, react to and comment on.
+package policy
+
+import (
+	"database/sql"
+	"fmt"
+
+	"social-network/internal/models"
+)
+
+// NotBlocked keeps the rows whose user (userColumn) and viewerID have not
+// blocked each other.
+func NotBlocked(userColumn string, viewerID int) (string, []any) {
+	return fmt.Sprintf(`NOT EXISTS (
+		SELECT 1 FROM user_blocks blk
+		WHERE (blk.blocker_id = ? AND blk.blocked_id = %[1]s) OR (blk.blocker_id = %[1]s AND blk.blocked_id = ?)
+	)`, userColumn), []any{viewerID, viewerID}
+}
+
+// NotMuted keeps the rows whose user (userColumn) viewerID has not muted.
+func NotMuted(userColumn string, viewerID int) (string, []any) {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM user_mutes mt WHERE mt.muter_id = ? AND mt.muted_id = %s)`, userColumn),
+		[]any{viewerID}
+}
+
+// Follows is true when followerID has an accepted follow on the user in userColumn.
+func Follows(userColumn string, followerID int) (string, []any) {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM followers fl
+		WHERE fl.follower_id = ? AND fl.following_id = %s AND fl.status = 'accepted'
+	)`, userColumn), []any{followerID}
+}
+
+// VisiblePosts keeps the posts (table alias) viewerID may see:
+//   - their own posts
+//   - public posts of public users
+//   - public and followers-only posts of users they follow
+//   - "selected" posts of users who picked them
+//
+// Hidden posts and posts across a block are never visible.
+func VisiblePosts(alias string, viewerID int) (string, []any) {
+	follows, followsArgs := Follows(alias+".user_id", viewerID)
+	notBlocked, notBlockedArgs := NotBlocked(alias+".user_id", viewerID)
+
+	cond := fmt.Sprintf(`(%[1]s.hidden = 0 AND (
+		%[1]s.user_id = ?
+		OR (%[3]s AND (
+			(%[1]s.privacy = 'public' AND (SELECT u.is_private FROM users u WHERE u.id = %[1]s.user_id) = 0)
+			OR (%[1]s.privacy IN ('public', 'followers') AND %[2]s)
+			OR (%[1]s.privacy = 'selected' AND EXISTS (
+				SELECT 1 FROM posts_visibility vis WHERE vis.post_creator = %[1]s.user_id AND vis.user_id = ?
+			))
+		))
+	))`, alias, follows, notBlocked)
+
+	args := []any{viewerID}
+	args = append(args, notBlockedArgs...)
+	args = append(args, followsArgs...)
+	args = append(args, viewerID)
+	return cond, args
+}
+
+// VisibleProfiles keeps the users (id column) whose full profile viewerID may
+// see: themselves, public users and users they follow, never across a block.
+func VisibleProfiles(userColumn string, viewerID int) (string, []any) {
+	follows, followsArgs := Follows(userColumn, viewerID)
+	notBlocked, notBlockedArgs := NotBlocked(userColumn, viewerID)
+
+	cond := fmt.Sprintf(`(%[1]s = ? OR (%[3]s AND (
+		(SELECT u.is_private FROM users u WHERE u.id = %[1]s) = 0 OR %[2]s
+	)))`, userColumn, follows, notBlocked)
+
+	args := []any{viewerID}
+	args = append(args, notBlockedArgs...)
+	args = append(args, followsArgs...)
+	return cond, args
+}
+
+// Messageable keeps the users (id column) viewerID may send direct messages
+// to: public users and anyone following or followed by the viewer, never
+// across a block.
+func Messageable(userColumn string, viewerID int) (string, []any) {
+	notBlocked, notBlockedArgs := NotBlocked(userColumn, viewerID)
+
+	cond := fmt.Sprintf(`(%[1]s != ? AND %[2]s AND (
+		(SELECT u.is_private FROM users u WHERE u.id = %[1]s) = 0
+		OR EXISTS (
+			SELECT 1 FROM followers fl
+			WHERE fl.status = 'accepted'
+				AND ((fl.follower_id = ? AND fl.following_id = %[1]s) OR (fl.follower_id = %[1]s AND fl.following_id = ?))
+		)
+	))`, userColumn, notBlocked)
+
+	args := []any{viewerID}
+	args = append(args, notBlockedArgs...)
+	args = append(args, viewerID, viewerID)
+	return cond, args
+}
+
+// GroupMember is true when userID is an approved member of the group in groupColumn.
+func GroupMember(groupColumn string, userID int) (string, []any) {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM group_members gmb
+		WHERE gmb.group_id = %s AND gmb.id = ? AND gmb.status = 'approved'
+	)`, groupColumn), []any{userID}
+}
+
+// ChannelReadable is true when userID may read the group chat channel in
+// channelColumn: any approved member of the group may read a public channel,
+// only its members and the group's admin a private one.
+func ChannelReadable(channelColumn string, userID int) (string, []any) {
+	member, args := GroupMember("ch.group_id", userID)
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM group_chat_channels ch
+		WHERE ch.id = %s AND %s AND (
+			ch.private = 0
+			OR EXISTS (SELECT 1 FROM group_chat_channel_members chm WHERE chm.channel_id = ch.id AND chm.user_id = ?)
+			OR EXISTS (SELECT 1 FROM groups g WHERE g.id = ch.group_id AND g.creator_id = ?)
+		)
+	)`, channelColumn, member), append(args, userID, userID)
+}
+
+// CanViewPost reports whether viewerID may see the post.
+func CanViewPost(db *sql.DB, viewerID, postID int) (bool, error) {
+	cond, args := VisiblePosts("p", viewerID)
+	return exists(db, `SELECT 1 FROM posts p WHERE p.id = ? AND `+cond, append([]any{postID}, args...)...)
+}
+
+// CanComment reports whether viewerID may comment on, or react to, the post.
+// Anyone who can see a post can take part in it.
+func CanComment(db *sql.DB, viewerID, postID int) (bool, error) {
+	return CanViewPost(db, viewerID, postID)
+}
+
+// CanViewProfile reports whether viewerID may see the full profile of userID.
+func CanViewProfile(db *sql.DB, viewerID, userID int) (bool, error) {
+	cond, args := VisibleProfiles("u0.id", viewerID)
+	return exists(db, `SELECT 1 FROM users u0 WHERE u0.id = ? AND `+cond, append([]any{userID}, args...)...)
+}
+
+// CanMessage reports whether senderID may write to receiverID directly, not
+// as a message request: CheckMessage allows it. Typing events, edits and
+// presence follow it.
+func CanMessage(db *sql.DB, senderID, receiverID int) (bool, error) {
+	decision, err := CheckMessage(db, senderID, receiverID)
+	return decision == MessageAllowed, err
+}
+
+// CanActInGroup reports whether userID is an approved member of the group and
+// may therefore read and write its posts, comments, events and chat.
+func CanActInGroup(db *sql.DB, userID, groupID int) (bool, error) {
+	cond, args := GroupMember("?", userID)
+	return exists(db, `SELECT 1 WHERE `+cond, append([]any{groupID}, args...)...)
+}
+
+// CanReadChannel reports whether userID may read the group chat channel
+// under ChannelReadable.
+func CanReadChannel(db *sql.DB, userID, channelID int) (bool, error) {
+	cond, args := ChannelReadable("?", userID)
+	return exists(db, `SELECT 1 WHERE `+cond, append([]any{channelID}, args...)...)
+}
+
+// CanPostInChannel reports whether userID may write in the group chat
+// channel: read it, and it is not archived.
+func CanPostInChannel(db *sql.DB, userID, channelID int) (bool, error) {
+	cond, args := ChannelReadable("c0.id", userID)
+	return exists(db, `SELECT 1 FROM group_chat_channels c0 WHERE c0.id = ? AND c0.archived_at IS NULL AND `+cond,
+		append([]any{channelID}, args...)...)
+}
+
+// CanAccessTarget reports whether userID may see, and react to or report, a
+// piece of content. It returns sql.ErrNoRows when the target does not exist
+// or was hidden by a moderator.
+func CanAccessTarget(db *sql.DB, userID int, targetType string, targetID int) (bool, error) {
+	var query string
+	switch targetType {
+	case models.TargetPost:
+		query = `SELECT id, user_id FROM posts WHERE id = ? AND hidden = 0`
+	case models.TargetComment:
+		query = `SELECT post_id, user_id FROM comments WHERE id = ? AND hidden = 0`
+	case models.TargetGroupPost:
+		query = `SELECT group_id, member_id FROM group_posts WHERE id = ? AND hidden = 0`
+	case models.TargetGroupComment:
+		query = `SELECT group_id, member_id FROM group_comments WHERE id = ? AND hidden = 0`
+	case models.TargetGroupMessage:
+		query = `SELECT COALESCE(channel_id, 0), sender_id FROM group_messages WHERE id = ? AND hidden = 0`
+	case models.TargetMessage:
+		query = `SELECT receiver_id, sender_id FROM messages WHERE id = ? AND hidden = 0`
+	default:
+		return false, fmt.Errorf("unknown target type %q", targetType)
+	}
+
+	var parentID, ownerID int
+	if err := db.QueryRow(query, targetID).Scan(&parentID, &ownerID); err != nil {
+		return false, err
+	}
+	if ownerID != userID {
+		if blocked, err := IsBlocked(db, userID, ownerID); err != nil || blocked {
+			return false, err
+		}
+	}
+
+	switch targetType {
+	case models.TargetPost, models.TargetComment:
+		return CanViewPost(db, userID, parentID)
+	case models.TargetMessage:
+		return userID == ownerID || userID == parentID, nil
+	case models.TargetGroupMessage:
+		return CanReadChannel(db, userID, parentID)
+	default:
+		return CanActInGroup(db, userID, parentID)
+	}
+}
+
+// CanDownloadAttachment reports whether userID may download a chat
+// attachment: its uploader always may, otherwise only those who can access
+// the message it was sent with.
+func CanDownloadAttachment(db *sql.DB, userID int, attachment *models.ChatAttachment) (bool, error) {
+	var allowed bool
+	var err error
+	switch {
+	case attachment.UploaderID == userID:
+		return true, nil
+	case attachment.MessageID != nil:
+		allowed, err = CanAccessTarget(db, userID, models.TargetMessage, *attachment.MessageID)
+	case attachment.GroupMessageID != nil:
+		allowed, err = CanAccessTarget(db, userID, models.TargetGroupMessage, *attachment.GroupMessageID)
+	}
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return allowed, err
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func IsBlocked(db *sql.DB, userA, userB int) (bool, error) {
+	return exists(db, `
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)`,
+		userA, userB, userB, userA)
+}
+
+func exists(db *sql.DB, query string, args ...any) (bool, error) {
+	var found bool
+	err := db.QueryRow(`SELECT EXISTS(`+query+`)`, args...).Scan(&found)
+	return found, err
+}
@@ -0,0 +1,466 @@
+package policy
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"social-network/internal/config"
+	"social-network/internal/models"
+)
+
+const (
+	alice   = 1 // public
+	bob     = 2 // private
+	carol   = 3 // public, follows bob
+	dave    = 4 // private, pending request to bob, followed by alice
+	eve     = 5 // public, blocked by alice
+	mallory = 6 // public, follows bob
+)
+
+const (
+	alicePublic    = 1
+	bobPublic      = 2
+	bobFollowers   = 3
+	bobSelected    = 4 // selected: carol
+	aliceFollowers = 5
+	evePublic      = 6
+	aliceHidden    = 7
+)
+
+// newTestDB builds a fresh database from the migrations and seeds the
+// users, follows, posts, blocks and group used by every scenario.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "policy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := config.ApplyMigrations(db, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := []string{
+		`INSERT INTO users (id, nickname, email, password, first_name, last_name, date_of_birth, is_private) VALUES
+			(1, 'alice', 'alice@x.io', '-', 'Alice', 'A', '2000-01-01', 0),
+			(2, 'bob', 'bob@x.io', '-', 'Bob', 'B', '2000-01-01', 1),
+			(3, 'carol', 'carol@x.io', '-', 'Carol', 'C', '2000-01-01', 0),
+			(4, 'dave', 'dave@x.io', '-', 'Dave', 'D', '2000-01-01', 1),
+			(5, 'eve', 'eve@x.io', '-', 'Eve', 'E', '2000-01-01', 0),
+			(6, 'mallory', 'mallory@x.io', '-', 'Mallory', 'M', '2000-01-01', 0)`,
+		`INSERT INTO followers (follower_id, following_id, status) VALUES
+			(3, 2, 'accepted'), (6, 2, 'accepted'), (4, 2, 'pending'), (1, 4, 'accepted')`,
+		`INSERT INTO posts (id, user_id, content, privacy) VALUES
+			(1, 1, 'alice public', 'public'),
+			(2, 2, 'bob public', 'public'),
+			(3, 2, 'bob followers', 'followers'),
+			(4, 2, 'bob selected', 'selected'),
+			(5, 1, 'alice followers', 'followers'),
+			(6, 5, 'eve public', 'public'),
+			(7, 1, 'alice hidden', 'public')`,
+		`UPDATE posts SET hidden = 1 WHERE id = 7`,
+		`INSERT INTO posts_visibility (post_creator, user_id) VALUES (2, 3)`,
+		`INSERT INTO comments (id, post_id, user_id, content) VALUES (1, 3, 3, 'on bob followers')`,
+		`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (1, 5)`,
+		`INSERT INTO groups (id, group_name, creator_id) VALUES (1, 'club', 1)`,
+		`INSERT INTO group_members (id, group_id, username, status) VALUES (1, 1, 'alice', 'approved'), (2, 1, 'bob', 'pending')`,
+		`INSERT INTO group_posts (id, group_id, member_id, content, username) VALUES (1, 1, 1, 'hello club', 'alice')`,
+		`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES (1, 1, 3, 'hi carol')`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+	return db
+}
+
+func TestCanViewPost(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name   string
+		viewer int
+		post   int
+		want   bool
+	}{
+		{"author sees own followers-only post", alice, aliceFollowers, true},
+		{"public post of public user", carol, alicePublic, true},
+		{"public post of private user, stranger", alice, bobPublic, false},
+		{"public post of private user, follower", carol, bobPublic, true},
+		{"followers-only post, follower", carol, bobFollowers, true},
+		{"followers-only post, pending request", dave, bobFollowers, false},
+		{"followers-only post of public user, stranger", carol, aliceFollowers, false},
+		{"selected post, selected user", carol, bobSelected, true},
+		{"selected post, follower not selected", mallory, bobSelected, false},
+		{"blocker cannot see blocked user's public post", alice, evePublic, false},
+		{"blocked user cannot see blocker's public post", eve, alicePublic, false},
+		{"hidden post", carol, aliceHidden, false},
+		{"hidden post, author", alice, aliceHidden, false},
+		{"missing post", alice, 999, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanViewPost(db, tt.viewer, tt.post)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanViewPost(%d, %d) = %v, want %v", tt.viewer, tt.post, got, tt.want)
+			}
+			if comment, _ := CanComment(db, tt.viewer, tt.post); comment != got {
+				t.Errorf("CanComment(%d, %d) = %v, want %v", tt.viewer, tt.post, comment, got)
+			}
+		})
+	}
+}
+
+// TestVisiblePostsMatchesCanViewPost makes sure list queries built from the
+// fragment return exactly the posts CanViewPost allows.
+func TestVisiblePostsMatchesCanViewPost(t *testing.T) {
+	db := newTestDB(t)
+
+	for viewer := alice; viewer <= mallory; viewer++ {
+		cond, args := VisiblePosts("p", viewer)
+		rows, err := db.Query(`SELECT p.id FROM posts p WHERE `+cond, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listed := make(map[int]bool)
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			listed[id] = true
+		}
+		rows.Close()
+
+		for post := alicePublic; post <= aliceHidden; post++ {
+			allowed, err := CanViewPost(db, viewer, post)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if listed[post] != allowed {
+				t.Errorf("viewer %d, post %d: listed %v but CanViewPost %v", viewer, post, listed[post], allowed)
+			}
+		}
+	}
+}
+
+func TestCanViewProfile(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name   string
+		viewer int
+		user   int
+		want   bool
+	}{
+		{"own private profile", bob, bob, true},
+		{"public profile", bob, carol, true},
+		{"private profile, follower", carol, bob, true},
+		{"private profile, stranger", alice, bob, false},
+		{"private profile, pending request", dave, bob, false},
+		{"blocked user", alice, eve, false},
+		{"blocker", eve, alice, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanViewProfile(db, tt.viewer, tt.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanViewProfile(%d, %d) = %v, want %v", tt.viewer, tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanMessage(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name     string
+		sender   int
+		receiver int
+		want     bool
+	}{
+		{"public recipient, stranger", alice, carol, false},
+		{"reply to a stranger's message", carol, alice, true},
+		{"private recipient, stranger", alice, bob, false},
+		{"private recipient, sender follows them", carol, bob, true},
+		{"private recipient follows the sender", bob, carol, true},
+		{"private recipient, pending request", dave, bob, false},
+		{"private recipient followed by the sender", alice, dave, true},
+		{"blocked recipient", alice, eve, false},
+		{"blocker as recipient", eve, alice, false},
+		{"yourself", alice, alice, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanMessage(db, tt.sender, tt.receiver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanMessage(%d, %d) = %v, want %v", tt.sender, tt.receiver, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMessage(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO message_requests (sender_id, receiver_id, status) VALUES
+		(6, 1, 'declined'), (6, 3, 'accepted'), (5, 3, 'pending')`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		sender   int
+		receiver int
+		want     string
+	}{
+		{"follower to followed private user", carol, bob, MessageAllowed},
+		{"followed private user to follower", bob, carol, MessageAllowed},
+		{"follower to followed user", alice, dave, MessageAllowed},
+		{"stranger to public user", alice, carol, MessageRequest},
+		{"reply to a stranger's message", carol, alice, MessageAllowed},
+		{"stranger to private user", alice, bob, MessageRecipientPrivate},
+		{"pending follow request is no follow", dave, bob, MessageRecipientPrivate},
+		{"pending message request", eve, carol, MessageRequest},
+		{"accepted message request", mallory, carol, MessageAllowed},
+		{"declined message request", mallory, alice, MessageRequestDeclined},
+		{"blocker", alice, eve, MessageBlocked},
+		{"blocked", eve, alice, MessageBlocked},
+		{"missing user", alice, 999, MessageUnknownRecipient},
+		{"self", alice, alice, MessageUnknownRecipient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckMessage(db, tt.sender, tt.receiver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CheckMessage(%d, %d) = %q, want %q", tt.sender, tt.receiver, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanActInGroup(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name  string
+		user  int
+		group int
+		want  bool
+	}{
+		{"approved member", alice, 1, true},
+		{"pending member", bob, 1, false},
+		{"not a member", carol, 1, false},
+		{"missing group", alice, 999, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanActInGroup(db, tt.user, tt.group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanActInGroup(%d, %d) = %v, want %v", tt.user, tt.group, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChannelAccess(t *testing.T) {
+	db := newTestDB(t)
+	for _, query := range []string{
+		`INSERT INTO group_members (id, group_id, username, status) VALUES (6, 1, 'mallory', 'approved')`,
+		`INSERT INTO group_chat_channels (id, group_id, name, private, creator_id) VALUES
+			(2, 1, 'staff', 1, 1), (3, 1, 'mods', 1, 1), (4, 1, 'old', 0, 1)`,
+		`INSERT INTO group_chat_channel_members (channel_id, user_id) VALUES (3, 6), (3, 4)`,
+		`UPDATE group_chat_channels SET archived_at = CURRENT_TIMESTAMP WHERE id = 4`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		user     int
+		channel  int
+		wantRead bool
+		wantPost bool
+	}{
+		{"default channel, member", mallory, 1, true, true},
+		{"default channel, pending member", bob, 1, false, false},
+		{"private channel, group admin", alice, 2, true, true},
+		{"private channel, member not added", mallory, 2, false, false},
+		{"private channel, added member", mallory, 3, true, true},
+		{"private channel, added but not in the group", dave, 3, false, false},
+		{"archived channel, member", mallory, 4, true, false},
+		{"missing channel", alice, 999, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read, err := CanReadChannel(db, tt.user, tt.channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			post, err := CanPostInChannel(db, tt.user, tt.channel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read != tt.wantRead || post != tt.wantPost {
+				t.Errorf("read, post (%d, %d) = %v, %v, want %v, %v", tt.user, tt.channel, read, post, tt.wantRead, tt.wantPost)
+			}
+		})
+	}
+}
+
+func TestCanAccessTarget(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name       string
+		user       int
+		targetType string
+		targetID   int
+		want       bool
+		wantErr    error
+	}{
+		{"comment on a post the user can see", mallory, models.TargetComment, 1, true, nil},
+		{"comment on a post the user cannot see", alice, models.TargetComment, 1, false, nil},
+		{"post across a block", eve, models.TargetPost, alicePublic, false, nil},
+		{"hidden post", carol, models.TargetPost, aliceHidden, false, sql.ErrNoRows},
+		{"group post, member", alice, models.TargetGroupPost, 1, true, nil},
+		{"group post, pending member", bob, models.TargetGroupPost, 1, false, nil},
+		{"message, sender", alice, models.TargetMessage, 1, true, nil},
+		{"message, recipient", carol, models.TargetMessage, 1, true, nil},
+		{"message, someone else", bob, models.TargetMessage, 1, false, nil},
+		{"missing message", alice, models.TargetMessage, 999, false, sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanAccessTarget(db, tt.user, tt.targetType, tt.targetID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CanAccessTarget error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CanAccessTarget(%d, %s, %d) = %v, want %v", tt.user, tt.targetType, tt.targetID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanDownloadAttachment(t *testing.T) {
+	db := newTestDB(t)
+	for _, query := range []string{
+		`INSERT INTO group_messages (id, sender_id, group_id, channel_id, content) VALUES (1, 1, 1, 1, 'hello club')`,
+		`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES (2, 1, 3, 'hidden')`,
+		`UPDATE messages SET hidden = 1 WHERE id = 2`,
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := func(n int) *int { return &n }
+
+	tests := []struct {
+		name       string
+		user       int
+		attachment models.ChatAttachment
+		want       bool
+	}{
+		{"uploader, not sent yet", alice, models.ChatAttachment{UploaderID: alice}, true},
+		{"someone else, not sent yet", carol, models.ChatAttachment{UploaderID: alice}, false},
+		{"message, recipient", carol, models.ChatAttachment{UploaderID: alice, MessageID: id(1)}, true},
+		{"message, someone else", bob, models.ChatAttachment{UploaderID: alice, MessageID: id(1)}, false},
+		{"hidden message, recipient", carol, models.ChatAttachment{UploaderID: alice, MessageID: id(2)}, false},
+		{"group message, member", alice, models.ChatAttachment{UploaderID: carol, GroupMessageID: id(1)}, true},
+		{"group message, pending member", bob, models.ChatAttachment{UploaderID: alice, GroupMessageID: id(1)}, false},
+		{"group message, outsider", mallory, models.ChatAttachment{UploaderID: alice, GroupMessageID: id(1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CanDownloadAttachment(db, tt.user, &tt.attachment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CanDownloadAttachment(%d) = %v, want %v", tt.user, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`UPDATE users SET name_visibility = 'only_me', gender_visibility = 'followers' WHERE id = ?`, mallory); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		viewer     int
+		user       int
+		wantEmail  bool // email defaults to followers
+		wantName   bool
+		wantGender bool
+	}{
+		{"owner sees everything", mallory, mallory, true, true, true},
+		{"private profile, stranger", alice, bob, false, false, false},
+		{"private profile, follower", carol, bob, true, true, true},
+		{"private profile, pending request", dave, bob, false, false, false},
+		{"public profile, stranger", alice, carol, false, true, true},
+		{"only_me and followers fields, stranger", alice, mallory, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := loadProfile(t, db, tt.user)
+			got, err := ProfileFor(db, tt.viewer, user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got.Email != "") != tt.wantEmail {
+				t.Errorf("email visible = %v, want %v", got.Email != "", tt.wantEmail)
+			}
+			if (got.FirstName != "") != tt.wantName {
+				t.Errorf("name visible = %v, want %v", got.FirstName != "", tt.wantName)
+			}
+			if (got.Gender != "") != tt.wantGender {
+				t.Errorf("gender visible = %v, want %v", got.Gender != "", tt.wantGender)
+			}
+			if (got.FieldPrivacy != nil) != (tt.viewer == tt.user) {
+				t.Errorf("field privacy sent to viewer %d of user %d", tt.viewer, tt.user)
+			}
+		})
+	}
+}
+
+func loadProfile(t *testing.T, db *sql.DB, userID int) *models.User {
+	t.Helper()
+	user := models.User{FieldPrivacy: &models.ProfilePrivacy{}}
+	err := db.QueryRow(`
+		SELECT id, nickname, email, gender, first_name, last_name, date_of_birth, is_private,
+			email_visibility, birthdate_visibility, gender_visibility, name_visibility
+		FROM users WHERE id = ?`, userID).
+		Scan(&user.ID, &user.Nickname, &user.Email, &user.Gender, &user.FirstName, &user.LastName, &user.Birthdate,
+			&user.IsPrivate, &user.FieldPrivacy.Email, &user.FieldPrivacy.Birthdate, &user.FieldPrivacy.Gender,
+			&user.FieldPrivacy.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
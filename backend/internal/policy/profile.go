@@ -0,0 +1,70 @@
+package policy
+
+import (
+	"database/sql"
+
+	"social-network/internal/models"
+)
+
+// ProfileFor returns the part of user's profile viewerID may see. The user
+// must carry its FieldPrivacy settings.
+//
+// The owner gets everything. Viewers without access to a private profile get
+// the minimal card (id and nickname). Everyone else gets the fields whose
+// visibility allows them.
+func ProfileFor(db *sql.DB, viewerID int, user *models.User) (*models.User, error) {
+	if user.ID == viewerID {
+		return user, nil
+	}
+	allowed, err := CanViewProfile(db, viewerID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return MinimalCard(user), nil
+	}
+
+	cond, args := Follows("?", viewerID)
+	follows, err := exists(db, `SELECT 1 WHERE `+cond, append(args, user.ID)...)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := *user
+	privacy := user.FieldPrivacy
+	if privacy == nil {
+		privacy = &models.ProfilePrivacy{}
+	}
+	if !fieldVisible(privacy.Email, follows) {
+		visible.Email = ""
+	}
+	if !fieldVisible(privacy.Birthdate, follows) {
+		visible.Birthdate = ""
+		visible.Age = 0
+	}
+	if !fieldVisible(privacy.Gender, follows) {
+		visible.Gender = ""
+	}
+	if !fieldVisible(privacy.Name, follows) {
+		visible.FirstName = ""
+		visible.LastName = ""
+	}
+	visible.FieldPrivacy = nil
+	return &visible, nil
+}
+
+// MinimalCard is what anyone may see of a user.
+func MinimalCard(user *models.User) *models.User {
+	return &models.User{ID: user.ID, Nickname: user.Nickname, IsPrivate: user.IsPrivate}
+}
+
+func fieldVisible(visibility string, follows bool) bool {
+	switch visibility {
+	case models.VisibilityPublic:
+		return true
+	case models.VisibilityFollowers:
+		return follows
+	default:
+		return false
+	}
+}
@@ -0,0 +1,35 @@
+package pubsub
+
+import "sync"
+
+// Memory is the PubSub of a single instance. Handlers run on the publisher's
+// goroutine.
+type Memory struct {
+	mu       sync.RWMutex
+	handlers map[string][]func([]byte)
+}
+
+func NewMemory() *Memory {
+	return &Memory{handlers: make(map[string][]func([]byte))}
+}
+
+func (m *Memory) Publish(topic string, data []byte) error {
+	m.mu.RLock()
+	handlers := m.handlers[topic]
+	m.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(data)
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(topic string, handler func([]byte)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[topic] = append(m.handlers[topic], handler)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,37 @@
+// Package pubsub carries real-time events between the instances of the
+// server, so that a user connected to one instance receives what is sent
+// through another.
+package pubsub
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// PubSub delivers what is published on a topic to every subscriber of that
+// topic, on every instance, the publishing one included. Handlers of a topic
+// get its messages in publishing order.
+type PubSub interface {
+	Publish(topic string, data []byte) error
+	Subscribe(topic string, handler func(data []byte)) error
+	Close() error
+}
+
+// Open returns the PubSub configured by rawURL: in-memory when it is empty,
+// a Redis server for redis://[:password@]host:port.
+func Open(rawURL string) (PubSub, error) {
+	if rawURL == "" {
+		return NewMemory(), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pub/sub url: %v", err)
+	}
+	switch u.Scheme {
+	case "redis":
+		password, _ := u.User.Password()
+		return DialRedis(u.Host, password)
+	default:
+		return nil, fmt.Errorf("unsupported pub/sub scheme %q", u.Scheme)
+	}
+}
@@ -0,0 +1,129 @@
+package pubsub_test
+
+import (
+	"testing"
+	"time"
+
+	"social-network/internal/pubsub"
+	"social-network/internal/pubsub/pubsubtest"
+)
+
+// receive subscribes to topic and returns the channel its messages arrive on.
+func receive(t *testing.T, bus pubsub.PubSub, topic string) <-chan string {
+	t.Helper()
+	received := make(chan string, 16)
+	if err := bus.Subscribe(topic, func(data []byte) { received <- string(data) }); err != nil {
+		t.Fatalf("subscribe %s: %v", topic, err)
+	}
+	return received
+}
+
+func expect(t *testing.T, received <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-received:
+		if got != want {
+			t.Fatalf("received %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("nothing received, want %q", want)
+	}
+}
+
+func dial(t *testing.T, server *pubsubtest.RedisServer) *pubsub.Redis {
+	t.Helper()
+	bus, err := pubsub.DialRedis(server.Addr, server.Password)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+func TestMemory(t *testing.T) {
+	bus := pubsub.NewMemory()
+	chat := receive(t, bus, "chat")
+	other := receive(t, bus, "group")
+
+	bus.Publish("chat", []byte("hello"))
+	expect(t, chat, "hello")
+	if len(other) != 0 {
+		t.Fatal("a message reached another topic")
+	}
+}
+
+func TestRedisAcrossInstances(t *testing.T) {
+	server, err := pubsubtest.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	instanceA, instanceB := dial(t, server), dial(t, server)
+	onA := receive(t, instanceA, "chat")
+	onB := receive(t, instanceB, "chat")
+
+	// in order, on every instance, the publishing one included
+	for _, message := range []string{"first", "second", "with\r\nnewlines"} {
+		if err := instanceB.Publish("chat", []byte(message)); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	for _, received := range []<-chan string{onA, onB} {
+		expect(t, received, "first")
+		expect(t, received, "second")
+		expect(t, received, "with\r\nnewlines")
+	}
+}
+
+func TestRedisAuth(t *testing.T) {
+	server, err := pubsubtest.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Password = "secret"
+
+	if _, err := pubsub.DialRedis(server.Addr, "wrong"); err == nil {
+		t.Fatal("dial with a wrong password succeeded")
+	}
+	bus, err := pubsub.Open("redis://:secret@" + server.Addr)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer bus.Close()
+	received := receive(t, bus, "notifications")
+	bus.Publish("notifications", []byte("ping"))
+	expect(t, received, "ping")
+}
+
+func TestRedisReconnects(t *testing.T) {
+	server, err := pubsubtest.NewRedisServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	instanceA, instanceB := dial(t, server), dial(t, server)
+	onA := receive(t, instanceA, "chat")
+
+	server.DropClients()
+	// A resubscribes on its own, B reconnects on its next publish
+	waitSubscribers(t, server, 0)
+	waitSubscribers(t, server, 1)
+	if err := instanceB.Publish("chat", []byte("after restart")); err != nil {
+		t.Fatalf("publish after restart: %v", err)
+	}
+	expect(t, onA, "after restart")
+}
+
+func waitSubscribers(t *testing.T, server *pubsubtest.RedisServer, want int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for server.Subscribers("social-network:chat") != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers, want %d", server.Subscribers("social-network:chat"), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,190 @@
+// Package pubsubtest provides a local stand-in for a Redis server to test
+// the networked PubSub against, without a real server.
+package pubsubtest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RedisServer speaks just enough of the Redis protocol for pub/sub: PING,
+// AUTH, PUBLISH and SUBSCRIBE.
+type RedisServer struct {
+	Addr     string
+	Password string // required by AUTH when set
+
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]bool
+	channels map[string]map[net.Conn]bool
+}
+
+// NewRedisServer starts a server on a random local port.
+func NewRedisServer() (*RedisServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &RedisServer{
+		Addr:     listener.Addr().String(),
+		listener: listener,
+		conns:    make(map[net.Conn]bool),
+		channels: make(map[string]map[net.Conn]bool),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Close stops the server and drops every client.
+func (s *RedisServer) Close() {
+	s.listener.Close()
+	s.DropClients()
+}
+
+// DropClients closes every client connection, as a restarting server would.
+func (s *RedisServer) DropClients() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Subscribers returns how many connections are subscribed to channel.
+func (s *RedisServer) Subscribers(channel string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels[channel])
+}
+
+func (s *RedisServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *RedisServer) serve(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		for _, subscribers := range s.channels {
+			delete(subscribers, conn)
+		}
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	authed := false
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		command := strings.ToUpper(args[0])
+		if s.Password != "" && !authed && command != "AUTH" {
+			s.write(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+
+		switch command {
+		case "PING":
+			s.write(conn, "+PONG\r\n")
+		case "AUTH":
+			if len(args) != 2 || args[1] != s.Password {
+				s.write(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authed = true
+			s.write(conn, "+OK\r\n")
+		case "SUBSCRIBE":
+			for _, channel := range args[1:] {
+				s.mu.Lock()
+				if s.channels[channel] == nil {
+					s.channels[channel] = make(map[net.Conn]bool)
+				}
+				s.channels[channel][conn] = true
+				s.mu.Unlock()
+				s.write(conn, "*3\r\n"+bulk("subscribe")+bulk(channel)+":1\r\n")
+			}
+		case "PUBLISH":
+			if len(args) != 3 {
+				s.write(conn, "-ERR wrong number of arguments for 'publish' command\r\n")
+				continue
+			}
+			message := "*3\r\n" + bulk("message") + bulk(args[1]) + bulk(args[2])
+			s.mu.Lock()
+			subscribers := make([]net.Conn, 0, len(s.channels[args[1]]))
+			for subscriber := range s.channels[args[1]] {
+				subscribers = append(subscribers, subscriber)
+			}
+			s.mu.Unlock()
+			for _, subscriber := range subscribers {
+				s.write(subscriber, message)
+			}
+			s.write(conn, ":"+strconv.Itoa(len(subscribers))+"\r\n")
+		default:
+			s.write(conn, fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0]))
+		}
+	}
+}
+
+// write sends a reply, one at a time per server so that replies to
+// different clients never interleave on a connection.
+func (s *RedisServer) write(conn net.Conn, reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	io.WriteString(conn, reply)
+}
+
+func bulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
+
+// readCommand reads a command sent as an array of bulk strings.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil // inline command
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(header, "$"), "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
@@ -0,0 +1,326 @@
+package pubsub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// redisPrefix namespaces the channels of this application on a shared server
+	redisPrefix = "social-network:"
+	dialTimeout = 5 * time.Second
+	// maxReconnectWait caps the backoff between attempts to reach a lost server
+	maxReconnectWait = 5 * time.Second
+)
+
+var ErrClosed = errors.New("pub/sub closed")
+
+// Redis is a PubSub over the PUBLISH and SUBSCRIBE commands of a Redis (or
+// compatible) server. It keeps one connection to publish and one in
+// subscriber mode, and reconnects and resubscribes when the server is lost;
+// what is published meanwhile is not delivered.
+type Redis struct {
+	addr     string
+	password string
+
+	pubMu sync.Mutex
+	pub   *redisConn
+
+	subMu    sync.Mutex
+	sub      *redisConn
+	handlers map[string][]func([]byte)
+	pending  map[string]chan struct{} // subscriptions waiting for the server's confirmation
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// DialRedis connects to the server at addr (host:port).
+func DialRedis(addr, password string) (*Redis, error) {
+	r := &Redis{
+		addr:     addr,
+		password: password,
+		handlers: make(map[string][]func([]byte)),
+		pending:  make(map[string]chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	var err error
+	if r.pub, err = r.dial(); err != nil {
+		return nil, err
+	}
+	if r.sub, err = r.dial(); err != nil {
+		r.pub.Close()
+		return nil, err
+	}
+	go r.listen(r.sub)
+	return r, nil
+}
+
+func (r *Redis) Publish(topic string, data []byte) error {
+	r.pubMu.Lock()
+	defer r.pubMu.Unlock()
+
+	// one retry on a fresh connection, the server may have restarted
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		select {
+		case <-r.closed:
+			return ErrClosed
+		default:
+		}
+		if r.pub == nil {
+			if r.pub, err = r.dial(); err != nil {
+				continue
+			}
+		}
+		if _, err = r.pub.do("PUBLISH", redisPrefix+topic, string(data)); err == nil {
+			return nil
+		}
+		r.pub.Close()
+		r.pub = nil
+	}
+	return err
+}
+
+// Subscribe returns once the server confirmed the subscription, so that
+// nothing published afterwards is missed.
+func (r *Redis) Subscribe(topic string, handler func([]byte)) error {
+	r.subMu.Lock()
+	first := len(r.handlers[topic]) == 0
+	r.handlers[topic] = append(r.handlers[topic], handler)
+	if !first || r.sub == nil {
+		r.subMu.Unlock()
+		return nil // a reconnecting listener subscribes to every topic
+	}
+	confirmed := make(chan struct{})
+	r.pending[redisPrefix+topic] = confirmed
+	err := r.sub.send("SUBSCRIBE", redisPrefix+topic)
+	r.subMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// the confirmation is read by listen
+	select {
+	case <-confirmed:
+		return nil
+	case <-r.closed:
+		return ErrClosed
+	case <-time.After(dialTimeout):
+		return fmt.Errorf("no confirmation for subscription to %s", topic)
+	}
+}
+
+func (r *Redis) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		r.pubMu.Lock()
+		if r.pub != nil {
+			r.pub.Close()
+		}
+		r.pubMu.Unlock()
+		r.subMu.Lock()
+		if r.sub != nil {
+			r.sub.Close()
+		}
+		r.subMu.Unlock()
+	})
+	return nil
+}
+
+// listen hands the messages of the subscriber connection to the handlers of
+// their topic, reconnecting until Close.
+func (r *Redis) listen(conn *redisConn) {
+	for {
+		reply, err := conn.read()
+		var replyErr RedisError
+		if errors.As(err, &replyErr) {
+			log.Println("❌ Pub/sub server refused a subscription:", err)
+			continue
+		}
+		if err != nil {
+			select {
+			case <-r.closed:
+				return
+			default:
+			}
+			log.Println("⚠️ Lost the pub/sub server, reconnecting:", err)
+			if conn = r.resubscribe(); conn == nil {
+				return
+			}
+			continue
+		}
+
+		// ["message", channel, data] or ["subscribe", channel, count]
+		parts, ok := reply.([]any)
+		if !ok || len(parts) != 3 {
+			continue
+		}
+		kind, _ := parts[0].([]byte)
+		channel, _ := parts[1].([]byte)
+		data, _ := parts[2].([]byte)
+		if string(kind) == "subscribe" {
+			r.subMu.Lock()
+			if confirmed, ok := r.pending[string(channel)]; ok {
+				close(confirmed)
+				delete(r.pending, string(channel))
+			}
+			r.subMu.Unlock()
+			continue
+		}
+		if string(kind) != "message" {
+			continue
+		}
+		topic := strings.TrimPrefix(string(channel), redisPrefix)
+
+		r.subMu.Lock()
+		handlers := r.handlers[topic]
+		r.subMu.Unlock()
+		for _, handler := range handlers {
+			handler(data)
+		}
+	}
+}
+
+// resubscribe opens a new subscriber connection and subscribes it to every
+// topic, retrying with backoff. It returns nil once r is closed.
+func (r *Redis) resubscribe() *redisConn {
+	r.subMu.Lock()
+	if r.sub != nil {
+		r.sub.Close()
+		r.sub = nil
+	}
+	r.subMu.Unlock()
+
+	wait := 100 * time.Millisecond
+	for {
+		select {
+		case <-r.closed:
+			return nil
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, maxReconnectWait)
+
+		conn, err := r.dial()
+		if err != nil {
+			continue
+		}
+		r.subMu.Lock()
+		args := []string{"SUBSCRIBE"}
+		for topic := range r.handlers {
+			args = append(args, redisPrefix+topic)
+		}
+		if len(args) > 1 {
+			err = conn.send(args...)
+		}
+		if err == nil {
+			r.sub = conn
+		}
+		r.subMu.Unlock()
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		log.Println("✅ Reconnected to the pub/sub server")
+		return conn
+	}
+}
+
+func (r *Redis) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", r.addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+	if r.password != "" {
+		if _, err := conn.do("AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// redisConn speaks RESP, the Redis protocol.
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// send writes a command without waiting for the reply.
+func (c *redisConn) send(args ...string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	_, err := io.WriteString(c.Conn, b.String())
+	return err
+}
+
+// do sends a command and reads its reply.
+func (c *redisConn) do(args ...string) (any, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read returns the next reply: a string, an int64, a []byte (nil for a
+// null), a []any or a RedisError.
+func (c *redisConn) read() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		parts := make([]any, n)
+		for i := range parts {
+			if parts[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return parts, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+// RedisError is an error reply of the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"social-network/internal/models"
+)
+
+// MaxAttachmentsPerMessage is how many uploads one chat message may reference
+const MaxAttachmentsPerMessage = 10
+
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// AttachmentRepository stores the files uploaded for chat messages
+type AttachmentRepository struct {
+	DB *sql.DB
+}
+
+// NewAttachmentRepository creates a new instance of AttachmentRepository
+func NewAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{DB: db}
+}
+
+const attachmentColumns = `id, uploader_id, message_id, group_message_id, file_name, mime_type, size, path,
+	COALESCE(thumbnail_path, ''), width, height`
+
+func scanAttachment(row rowScanner) (models.ChatAttachment, error) {
+	var a models.ChatAttachment
+	err := row.Scan(&a.ID, &a.UploaderID, &a.MessageID, &a.GroupMessageID, &a.FileName, &a.MimeType, &a.Size, &a.Path,
+		&a.ThumbnailPath, &a.Width, &a.Height)
+	a.URL = fmt.Sprintf("/api/chat/attachment?id=%d", a.ID)
+	if a.ThumbnailPath != "" {
+		a.ThumbnailURL = a.URL + "&thumbnail=1"
+	}
+	return a, err
+}
+
+// CreateAttachment stores an upload that no message references yet.
+func (repo *AttachmentRepository) CreateAttachment(a *models.ChatAttachment) (*models.ChatAttachment, error) {
+	var thumbnail any
+	if a.ThumbnailPath != "" {
+		thumbnail = a.ThumbnailPath
+	}
+	result, err := repo.DB.Exec(`
+		INSERT INTO chat_attachments (uploader_id, file_name, mime_type, size, path, thumbnail_path, width, height)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.UploaderID, a.FileName, a.MimeType, a.Size, a.Path, thumbnail, a.Width, a.Height)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetAttachment(int(id))
+}
+
+// GetAttachment returns one attachment, ErrAttachmentNotFound if it does not exist.
+func (repo *AttachmentRepository) GetAttachment(id int) (*models.ChatAttachment, error) {
+	a, err := scanAttachment(repo.DB.QueryRow(`SELECT `+attachmentColumns+` FROM chat_attachments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// claimAttachments links uploaderID's unused uploads to a new message, in the
+// transaction that stores it. column is message_id or group_message_id. It
+// fails with ErrAttachmentNotFound unless every id could be claimed.
+func claimAttachments(tx *sql.Tx, column string, messageID, uploaderID int, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if len(ids) > MaxAttachmentsPerMessage {
+		return ErrAttachmentNotFound
+	}
+	args := []any{messageID, uploaderID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	result, err := tx.Exec(`
+		UPDATE chat_attachments SET `+column+` = ?
+		WHERE uploader_id = ? AND message_id IS NULL AND group_message_id IS NULL
+		AND id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); int(n) != len(ids) {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
+
+// loadAttachments returns the attachments of the given messages by message
+// id. column is message_id or group_message_id.
+func loadAttachments(db *sql.DB, column string, messageIDs []int) (map[int][]models.ChatAttachment, error) {
+	byMessage := make(map[int][]models.ChatAttachment)
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT `+attachmentColumns+` FROM chat_attachments
+		WHERE `+column+` IN (`+placeholders(len(messageIDs))+`)
+		ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		messageID := a.MessageID
+		if column == "group_message_id" {
+			messageID = a.GroupMessageID
+		}
+		byMessage[*messageID] = append(byMessage[*messageID], a)
+	}
+	return byMessage, rows.Err()
+}
+
+// deleteAttachments removes the attachments of a message and their files.
+// column is message_id or group_message_id.
+func deleteAttachments(db *sql.DB, column string, messageID int) error {
+	byMessage, err := loadAttachments(db, column, []int{messageID})
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`DELETE FROM chat_attachments WHERE `+column+` = ?`, messageID); err != nil {
+		return err
+	}
+	for _, a := range byMessage[messageID] {
+		removeAttachmentFiles(a)
+	}
+	return nil
+}
+
+// DeleteUnclaimed removes the uploads no message took within olderThan, and
+// their files, and returns how many it removed.
+func (repo *AttachmentRepository) DeleteUnclaimed(olderThan time.Duration) (int, error) {
+	rows, err := repo.DB.Query(`
+		DELETE FROM chat_attachments
+		WHERE message_id IS NULL AND group_message_id IS NULL AND julianday(created_at) <= julianday('now', ?)
+		RETURNING path, COALESCE(thumbnail_path, '')`, fmt.Sprintf("-%d seconds", int64(olderThan/time.Second)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var removed []models.ChatAttachment
+	for rows.Next() {
+		var a models.ChatAttachment
+		if err := rows.Scan(&a.Path, &a.ThumbnailPath); err != nil {
+			return 0, err
+		}
+		removed = append(removed, a)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	// the rows are gone, a message can no longer claim the files
+	for _, a := range removed {
+		removeAttachmentFiles(a)
+	}
+	return len(removed), nil
+}
+
+func removeAttachmentFiles(a models.ChatAttachment) {
+	for _, path := range []string{a.Path, a.ThumbnailPath} {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Println("❌ Error removing attachment file:", err)
+		}
+	}
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeleteUnclaimed(t *testing.T) {
+	db, dir := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES (1, 1, 2, 'hi')`); err != nil {
+		t.Fatal(err)
+	}
+	claimed := attach(t, db, dir, "message_id", 1)
+	upload := func(name string, age time.Duration) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := db.Exec(`INSERT INTO chat_attachments (uploader_id, file_name, mime_type, size, path, created_at)
+			VALUES (1, 'x.txt', 'text/plain', 1, ?, ?)`, path, time.Now().UTC().Add(-age))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	abandoned := upload("abandoned", 2*day)
+	pending := upload("pending", time.Minute)
+	if _, err := db.Exec(`UPDATE chat_attachments SET created_at = ? WHERE message_id = 1`, time.Now().UTC().Add(-2*day)); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := NewAttachmentRepository(db).DeleteUnclaimed(day)
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d, %v, want the abandoned upload", removed, err)
+	}
+	if _, err := os.Stat(abandoned); !os.IsNotExist(err) {
+		t.Errorf("the file of the abandoned upload was not removed")
+	}
+	for _, path := range []string{claimed, pending} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("file %s: %v", path, err)
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM chat_attachments`); n != 2 {
+		t.Errorf("%d attachments left, want the claimed and the recent one", n)
+	}
+}
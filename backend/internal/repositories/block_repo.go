@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"social-network/internal/models"
+)
+
+// BlockRepository handles blocked and muted users
+type BlockRepository struct {
+	DB *sql.DB
+}
+
+// NewBlockRepository creates a new instance of BlockRepository
+func NewBlockRepository(db *sql.DB) *BlockRepository {
+	return &BlockRepository{DB: db}
+}
+
+// BlockUser blocks blockedID for blockerID and removes any follow relation
+// and "selected" post visibility between the two, both ways.
+func (repo *BlockRepository) BlockUser(blockerID, blockedID int) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)`, blockerID, blockedID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM followers
+		WHERE (follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)`,
+		blockerID, blockedID, blockedID, blockerID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM posts_visibility
+		WHERE (post_creator = ? AND user_id = ?) OR (post_creator = ? AND user_id = ?)`,
+		blockerID, blockedID, blockedID, blockerID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnblockUser lifts the block of blockedID by blockerID.
+func (repo *BlockRepository) UnblockUser(blockerID, blockedID int) error {
+	_, err := repo.DB.Exec(`DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	return err
+}
+
+// GetBlockedUsers returns the users blocked by userID.
+func (repo *BlockRepository) GetBlockedUsers(userID int) ([]models.User, error) {
+	return repo.listUsers(`
+		SELECT u.id, u.nickname, u.first_name, u.last_name
+		FROM user_blocks b JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY b.created_at DESC`, userID)
+}
+
+// MuteUser hides the posts of mutedID from the feed of muterID.
+func (repo *BlockRepository) MuteUser(muterID, mutedID int) error {
+	_, err := repo.DB.Exec(`INSERT OR IGNORE INTO user_mutes (muter_id, muted_id) VALUES (?, ?)`, muterID, mutedID)
+	return err
+}
+
+// UnmuteUser shows the posts of mutedID in the feed of muterID again.
+func (repo *BlockRepository) UnmuteUser(muterID, mutedID int) error {
+	_, err := repo.DB.Exec(`DELETE FROM user_mutes WHERE muter_id = ? AND muted_id = ?`, muterID, mutedID)
+	return err
+}
+
+// GetMutedUsers returns the users muted by userID.
+func (repo *BlockRepository) GetMutedUsers(userID int) ([]models.User, error) {
+	return repo.listUsers(`
+		SELECT u.id, u.nickname, u.first_name, u.last_name
+		FROM user_mutes m JOIN users u ON u.id = m.muted_id
+		WHERE m.muter_id = ?
+		ORDER BY m.created_at DESC`, userID)
+}
+
+// listUsers runs a query for the id, nickname and names of users.
+func (repo *BlockRepository) listUsers(query string, userID int) ([]models.User, error) {
+	rows, err := repo.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Nickname, &user.FirstName, &user.LastName); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
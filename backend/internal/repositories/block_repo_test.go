@@ -0,0 +1,44 @@
+package repositories
+
+import "testing"
+
+func TestBlockUser(t *testing.T) {
+	db, _ := newTestDB(t)
+	seed := []string{
+		`INSERT INTO users (id, nickname, email, password, first_name, last_name, date_of_birth) VALUES
+			(3, 'carol', 'carol@x.io', '-', 'Carol', 'C', '2000-01-01')`,
+		`INSERT INTO followers (follower_id, following_id, status) VALUES (1, 2, 'accepted'), (2, 1, 'pending'), (3, 1, 'accepted')`,
+		`INSERT INTO posts_visibility (post_creator, user_id) VALUES (1, 2), (2, 1), (1, 3)`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+	repo := NewBlockRepository(db)
+
+	if err := repo.BlockUser(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM followers WHERE 3 NOT IN (follower_id, following_id)`); n != 0 {
+		t.Errorf("%d follows left between the two, want none either way", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM posts_visibility WHERE user_id != 3`); n != 0 {
+		t.Errorf("%d selected post audiences left between the two, want none either way", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM followers`) + count(t, db, `SELECT COUNT(*) FROM posts_visibility`); n != 2 {
+		t.Error("the block touched the relations with somebody else")
+	}
+
+	blocked, err := repo.GetBlockedUsers(2)
+	if err != nil || len(blocked) != 1 || blocked[0].ID != 1 {
+		t.Fatalf("blocked users of bob: %v, %v, want alice", blocked, err)
+	}
+	if err := repo.UnblockUser(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	// an empty list is [] in JSON, not null
+	if blocked, err := repo.GetBlockedUsers(2); err != nil || blocked == nil || len(blocked) != 0 {
+		t.Fatalf("blocked users after unblocking: %#v, %v, want an empty list", blocked, err)
+	}
+}
@@ -2,8 +2,12 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"social-network/internal/models"
@@ -19,47 +23,425 @@ func NewChatRepository(db *sql.DB) *ChatRepository {
 	return &ChatRepository{DB: db}
 }
 
-func (repo *ChatRepository) GetMessages(user1, user2 int) ([]models.ChatMessage, error) {
+// HistoryPage selects a window of a chat history by message id. With Since
+// set it returns the messages after that id, oldest first, for a client
+// catching up. Otherwise it returns the newest messages before Before (or
+// the newest overall), still in chronological order, for "load older".
+// Limit 0 returns the whole window, as clients from before paging expect.
+type HistoryPage struct {
+	Before int
+	Since  int
+	Limit  int
+}
+
+// window turns the page into an id condition and ordering, fetching one row
+// more than the limit to tell whether more messages exist.
+func (page HistoryPage) window(idColumn string) (cond string, args []any, order string) {
+	limit := ""
+	if page.Limit > 0 {
+		limit = " LIMIT " + strconv.Itoa(page.Limit+1)
+	}
+	if page.Since > 0 {
+		return idColumn + " > ?", []any{page.Since}, idColumn + " ASC" + limit
+	}
+	if page.Before > 0 {
+		return idColumn + " < ?", []any{page.Before}, idColumn + " DESC" + limit
+	}
+	return "1 = 1", nil, idColumn + " DESC" + limit
+}
+
+// trim drops the extra row fetched by window and puts the messages in
+// chronological order. It reports whether more messages exist.
+func trim[T any](page HistoryPage, messages []T) ([]T, bool) {
+	hasMore := page.Limit > 0 && len(messages) > page.Limit
+	if hasMore {
+		messages = messages[:page.Limit]
+	}
+	if page.Since == 0 {
+		slices.Reverse(messages)
+	}
+	return messages, hasMore
+}
+
+// MessageEditWindow is how long after sending a chat message its sender may
+// still edit it. Unsending has no limit.
+const MessageEditWindow = 15 * time.Minute
+
+var (
+	ErrMessageNotFound  = errors.New("message not found")
+	ErrEditWindowClosed = errors.New("message can no longer be edited")
+)
+
+// chatMessageColumns selects a direct message m with the message it replies
+// to as q, see scanChatMessage.
+const chatMessageColumns = `m.id, m.sender_id, m.receiver_id, m.content, m.sent_at, m.edited_at, m.deleted_at IS NOT NULL,
+	COALESCE(m.client_id, ''), m.delivered_at, m.expires_at, m.system,
+	q.id, q.sender_id, q.content, q.deleted_at IS NOT NULL OR q.hidden = 1
+	FROM messages m
+	LEFT JOIN messages q ON q.id = m.reply_to_id`
+
+func scanChatMessage(row rowScanner) (models.ChatMessage, error) {
+	var msg models.ChatMessage
+	var quote quoteColumns
+	err := row.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.SentAt, &msg.EditedAt, &msg.Deleted,
+		&msg.ClientID, &msg.DeliveredAt, &msg.ExpiresAt, &msg.System, &quote.id, &quote.senderID, &quote.content, &quote.deleted)
+	msg.ReplyTo = quote.quote()
+	return msg, err
+}
+
+// quoteColumns receives the LEFT JOINed replied-to message, all NULL when
+// the message is not a reply.
+type quoteColumns struct {
+	id, senderID sql.NullInt64
+	content      sql.NullString
+	deleted      sql.NullBool
+}
+
+func (q quoteColumns) quote() *models.MessageQuote {
+	if !q.id.Valid {
+		return nil
+	}
+	quote := &models.MessageQuote{ID: int(q.id.Int64), SenderID: int(q.senderID.Int64), Deleted: q.deleted.Bool}
+	if !quote.Deleted {
+		quote.Content = preview(q.content.String)
+	}
+	return quote
+}
+
+// GetMessages returns a page of the conversation between two users and
+// whether more messages exist in the paging direction.
+func (repo *ChatRepository) GetMessages(user1, user2 int, page HistoryPage) ([]models.ChatMessage, bool, error) {
+	cond, args, order := page.window("m.id")
 	rows, err := repo.DB.Query(`
-		SELECT id, sender_id, receiver_id, content, sent_at 
-		FROM messages 
-		WHERE (sender_id = ? AND receiver_id = ?) 
-		OR (sender_id = ? AND receiver_id = ?) 
-		ORDER BY sent_at ASC`, user1, user2, user2, user1)
+		SELECT `+chatMessageColumns+`
+		WHERE ((m.sender_id = ? AND m.receiver_id = ?) 
+		OR (m.sender_id = ? AND m.receiver_id = ?)) AND m.hidden = 0 AND `+cond+`
+		ORDER BY `+order, append([]any{user1, user2, user2, user1}, args...)...)
 	if err != nil {
 		log.Println("❌ Error fetching messages:", err)
-		return nil, err
+		return nil, false, err
 	}
 	defer rows.Close()
 
-	var messages []models.ChatMessage
+	messages := []models.ChatMessage{}
 	for rows.Next() {
-		var msg models.ChatMessage
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Content, &msg.SentAt); err != nil {
+		msg, err := scanChatMessage(rows)
+		if err != nil {
 			log.Println("❌ Error scanning chat history row:", err)
-			return nil, err
+			return nil, false, err
 		}
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
 
+	messages, hasMore := trim(page, messages)
+	if err := repo.withAttachments(messages); err != nil {
+		return nil, false, err
+	}
 	log.Printf("📜 Retrieved %d messages between users %d and %d", len(messages), user1, user2)
-	return messages, nil
+	return messages, hasMore, nil
+}
+
+// GetMessage returns one direct message, ErrMessageNotFound if it does not exist.
+func (repo *ChatRepository) GetMessage(messageID int) (*models.ChatMessage, error) {
+	msg, err := scanChatMessage(repo.DB.QueryRow(`SELECT `+chatMessageColumns+` WHERE m.id = ?`, messageID))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	messages := []models.ChatMessage{msg}
+	if err := repo.withAttachments(messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
 }
 
-func (repo *ChatRepository) SaveMessage(senderID, receiverID int, content string) error {
-	query := `INSERT INTO messages (sender_id, receiver_id, content, sent_at) VALUES (?, ?, ?, ?)`
+func (repo *ChatRepository) withAttachments(messages []models.ChatMessage) error {
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	byMessage, err := loadAttachments(repo.DB, "message_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// MessageDraft is a chat message about to be stored. ReceiverID is set for a
+// direct message, GroupID for a group message.
+type MessageDraft struct {
+	SenderID      int
+	ReceiverID    int
+	GroupID       int
+	ChannelID     int // the channel of the group chat, with GroupID
+	Content       string
+	ReplyToID     int    // quoted message of the same conversation or group, 0 for none
+	AttachmentIDs []int  // unused uploads of the sender
+	ClientID      string // generated by the client, a retry with the same id is stored once
+	System        bool   // posted for the conversation, e.g. a timer change
+}
+
+// nullIfEmpty stores optional text columns as NULL.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// isUniqueViolation reports whether err is a UNIQUE constraint failure.
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// SaveMessage stores a direct message and returns it. When the sender already
+// sent a message with the same ClientID that one is returned instead and
+// created is false.
+func (repo *ChatRepository) SaveMessage(draft MessageDraft) (msg *models.ChatMessage, created bool, err error) {
+	if existing, err := repo.messageByClientID(draft.SenderID, draft.ClientID); err != ErrMessageNotFound {
+		return existing, false, err
+	}
+
+	var replyTo any
+	if draft.ReplyToID != 0 {
+		var exists bool
+		err := repo.DB.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND hidden = 0
+			AND ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?)))`,
+			draft.ReplyToID, draft.SenderID, draft.ReceiverID, draft.ReceiverID, draft.SenderID).Scan(&exists)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			return nil, false, ErrMessageNotFound
+		}
+		replyTo = draft.ReplyToID
+	}
 
-	result, err := repo.DB.Exec(query, senderID, receiverID, content, time.Now())
+	_, lifetime, err := NewRetentionRepository(repo.DB).conversation(draft.SenderID, draft.ReceiverID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query := `INSERT INTO messages (sender_id, receiver_id, content, sent_at, reply_to_id, client_id, expires_at, system)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, draft.SenderID, draft.ReceiverID, draft.Content, time.Now(), replyTo, nullIfEmpty(draft.ClientID),
+		expiresAt(lifetime), draft.System)
+	if isUniqueViolation(err) {
+		// the same message arrived concurrently on another connection
+		tx.Rollback()
+		existing, err := repo.messageByClientID(draft.SenderID, draft.ClientID)
+		return existing, false, err
+	}
 	if err != nil {
 		log.Println("❌ Error saving message:", err)
-		return fmt.Errorf("failed to save message: %w", err) // Return wrapped error for better debugging
+		return nil, false, fmt.Errorf("failed to save message: %w", err) // Return wrapped error for better debugging
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("❌ no message inserted")
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := claimAttachments(tx, "message_id", int(id), draft.SenderID, draft.AttachmentIDs); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
 	}
 
-	log.Printf("📩 Message saved: Sender %d -> Receiver %d: %s", senderID, receiverID, content)
-	return nil
+	log.Printf("📩 Message saved: Sender %d -> Receiver %d: %s", draft.SenderID, draft.ReceiverID, draft.Content)
+	msg, err = repo.GetMessage(int(id))
+	return msg, err == nil, err
+}
+
+// messageByClientID returns senderID's message with the given client id,
+// ErrMessageNotFound if there is none or clientID is empty.
+func (repo *ChatRepository) messageByClientID(senderID int, clientID string) (*models.ChatMessage, error) {
+	if clientID == "" {
+		return nil, ErrMessageNotFound
+	}
+	var id int
+	err := repo.DB.QueryRow(`SELECT id FROM messages WHERE sender_id = ? AND client_id = ?`, senderID, clientID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetMessage(id)
+}
+
+// MarkDelivered records that messageID reached its recipient. It returns the
+// message and whether this was the first delivery.
+func (repo *ChatRepository) MarkDelivered(messageID int) (*models.ChatMessage, bool, error) {
+	result, err := repo.DB.Exec(`UPDATE messages SET delivered_at = ? WHERE id = ? AND delivered_at IS NULL`, time.Now().UTC(), messageID)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, false, nil
+	}
+	msg, err := repo.GetMessage(messageID)
+	return msg, err == nil, err
+}
+
+// GetUndelivered returns up to limit messages to receiverID that never reached
+// any of their connections, oldest first.
+func (repo *ChatRepository) GetUndelivered(receiverID, limit int) ([]models.ChatMessage, error) {
+	rows, err := repo.DB.Query(`
+		SELECT `+chatMessageColumns+`
+		WHERE m.receiver_id = ? AND m.delivered_at IS NULL AND m.hidden = 0
+		ORDER BY m.id LIMIT ?`, receiverID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []models.ChatMessage{}
+	for rows.Next() {
+		msg, err := scanChatMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, repo.withAttachments(messages)
+}
+
+// EditMessage replaces the content of senderID's message within
+// MessageEditWindow of sending it and returns the edited message.
+func (repo *ChatRepository) EditMessage(senderID, messageID int, content string) (*models.ChatMessage, error) {
+	msg, err := repo.GetMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.SenderID != senderID || msg.Deleted || msg.System {
+		return nil, ErrMessageNotFound
+	}
+	if time.Since(msg.SentAt) > MessageEditWindow {
+		return nil, ErrEditWindowClosed
+	}
+
+	if _, err := repo.DB.Exec(`UPDATE messages SET content = ?, edited_at = ? WHERE id = ?`, content, time.Now().UTC(), messageID); err != nil {
+		return nil, err
+	}
+	return repo.GetMessage(messageID)
+}
+
+// UnsendMessage deletes the content and attachments of senderID's message,
+// leaving a tombstone in the conversation, and returns it.
+func (repo *ChatRepository) UnsendMessage(senderID, messageID int) (*models.ChatMessage, error) {
+	result, err := repo.DB.Exec(`
+		UPDATE messages SET content = '', deleted_at = ?
+		WHERE id = ? AND sender_id = ? AND deleted_at IS NULL AND system = 0`, time.Now().UTC(), messageID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrMessageNotFound
+	}
+	if err := deleteAttachments(repo.DB, "message_id", messageID); err != nil {
+		return nil, err
+	}
+	return repo.GetMessage(messageID)
+}
+
+// previewLength is how many characters of the last message chat lists show
+const previewLength = 100
+
+func preview(content string) string {
+	runes := []rune(content)
+	if len(runes) <= previewLength {
+		return content
+	}
+	return string(runes[:previewLength]) + "…"
+}
+
+// GetRecentChats returns the conversations of userID, latest first, with the
+// last message as a preview, the number of unread messages and how far the
+// other user has read. Message requests userID has not accepted are left out.
+func (repo *ChatRepository) GetRecentChats(userID int) ([]models.ChatSummary, error) {
+	rows, err := repo.DB.Query(`
+		SELECT u.id, u.nickname, u.first_name, u.last_name,
+			m.id, m.sender_id, m.receiver_id, m.content, m.sent_at,
+			(SELECT COUNT(*) FROM messages x
+				WHERE x.sender_id = u.id AND x.receiver_id = ? AND x.hidden = 0
+				AND x.id > COALESCE((SELECT r.last_read_id FROM conversation_reads r WHERE r.user_id = ? AND r.peer_id = u.id), 0)),
+			COALESCE((SELECT r.last_read_id FROM conversation_reads r WHERE r.user_id = u.id AND r.peer_id = ?), 0)
+		FROM (
+			SELECT CASE WHEN sender_id = ? THEN receiver_id ELSE sender_id END AS peer_id, MAX(id) AS last_id
+			FROM messages
+			WHERE (sender_id = ? OR receiver_id = ?) AND hidden = 0
+			GROUP BY peer_id
+		) c
+		JOIN users u ON u.id = c.peer_id
+		JOIN messages m ON m.id = c.last_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM message_requests mr
+			WHERE mr.sender_id = c.peer_id AND mr.receiver_id = ? AND mr.status != 'accepted')
+		ORDER BY m.id DESC`, userID, userID, userID, userID, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chats := []models.ChatSummary{}
+	for rows.Next() {
+		var chat models.ChatSummary
+		last := &chat.LastMessage
+		err := rows.Scan(&chat.ID, &chat.Nickname, &chat.FirstName, &chat.LastName,
+			&last.ID, &last.SenderID, &last.ReceiverID, &last.Content, &last.SentAt,
+			&chat.UnreadCount, &chat.PeerLastReadID)
+		if err != nil {
+			return nil, err
+		}
+		last.Content = preview(last.Content)
+		chat.LastMessageTime = last.SentAt
+		chats = append(chats, chat)
+	}
+	return chats, rows.Err()
+}
+
+// MarkConversationRead moves userID's read pointer on the conversation with
+// peerID up to upToID, or to the latest message when upToID is 0. The pointer
+// never moves back. It returns the stored pointer.
+func (repo *ChatRepository) MarkConversationRead(userID, peerID, upToID int) (int, error) {
+	var lastID int
+	err := repo.DB.QueryRow(`
+		SELECT COALESCE(MAX(id), 0) FROM messages
+		WHERE sender_id = ? AND receiver_id = ? AND (? = 0 OR id <= ?)`,
+		peerID, userID, upToID, upToID).Scan(&lastID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = repo.DB.Exec(`
+		INSERT INTO conversation_reads (user_id, peer_id, last_read_id, read_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, peer_id) DO UPDATE SET
+			last_read_id = MAX(last_read_id, excluded.last_read_id), read_at = excluded.read_at`,
+		userID, peerID, lastID, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	err = repo.DB.QueryRow(`SELECT last_read_id FROM conversation_reads WHERE user_id = ? AND peer_id = ?`, userID, peerID).Scan(&lastID)
+	return lastID, err
 }
@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetMessagesPage(t *testing.T) {
+	db, _ := newTestDB(t)
+	for i := 1; i <= 25; i++ {
+		if _, err := db.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES (?, 1, 2, 'hi')`, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := NewChatRepository(db)
+	ids := func(page HistoryPage) ([]int, bool) {
+		t.Helper()
+		messages, hasMore, err := repo.GetMessages(1, 2, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, m := range messages {
+			ids = append(ids, m.ID)
+		}
+		return ids, hasMore
+	}
+
+	if got, hasMore := ids(HistoryPage{}); len(got) != 25 || got[0] != 1 || hasMore {
+		t.Errorf("without a limit got %v, more %v, want all 25 in order", got, hasMore)
+	}
+	if got, hasMore := ids(HistoryPage{Limit: 20}); len(got) != 20 || got[0] != 6 || !hasMore {
+		t.Errorf("newest 20 got %v, more %v, want 6 to 25 and more", got, hasMore)
+	}
+	if got, hasMore := ids(HistoryPage{Before: 6, Limit: 20}); len(got) != 5 || got[4] != 5 || hasMore {
+		t.Errorf("before 6 got %v, more %v, want 1 to 5", got, hasMore)
+	}
+	if got, hasMore := ids(HistoryPage{Since: 20, Limit: 3}); len(got) != 3 || got[0] != 21 || !hasMore {
+		t.Errorf("since 20 got %v, more %v, want 21 to 23 and more", got, hasMore)
+	}
+}
+
+func TestMarkConversationRead(t *testing.T) {
+	db, _ := newTestDB(t)
+	_, err := db.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES
+		(1, 2, 1, 'a'), (2, 1, 2, 'b'), (3, 2, 1, 'c'), (4, 2, 1, 'd')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewChatRepository(db)
+	state := func(userID int) (unread, peerRead int) {
+		t.Helper()
+		chats, err := repo.GetRecentChats(userID)
+		if err != nil || len(chats) != 1 {
+			t.Fatalf("recent chats of %d: %v, %v, want one", userID, chats, err)
+		}
+		return chats[0].UnreadCount, chats[0].PeerLastReadID
+	}
+	mark := func(userID, peerID, upToID, want int) {
+		t.Helper()
+		if got, err := repo.MarkConversationRead(userID, peerID, upToID); err != nil || got != want {
+			t.Fatalf("%d reading up to %d: pointer %d, %v, want %d", userID, upToID, got, err, want)
+		}
+	}
+
+	if unread, _ := state(1); unread != 3 {
+		t.Fatalf("%d unread before reading, want 3", unread)
+	}
+	mark(1, 2, 3, 3)
+	if unread, _ := state(1); unread != 1 {
+		t.Errorf("%d unread after reading up to 3, want 1", unread)
+	}
+	mark(1, 2, 1, 3)
+	mark(2, 1, 0, 2)
+	if _, peerRead := state(1); peerRead != 2 {
+		t.Errorf("bob has read up to %d, want 2, the last message of alice", peerRead)
+	}
+	mark(1, 2, 0, 4)
+	if unread, peerRead := state(2); unread != 0 || peerRead != 4 {
+		t.Errorf("bob sees %d unread and alice's pointer at %d, want 0 and 4", unread, peerRead)
+	}
+}
+
+func TestMarkGroupChatRead(t *testing.T) {
+	db, _ := newTestDB(t)
+	_, err := db.Exec(`INSERT INTO group_messages (id, group_id, channel_id, sender_id, content) VALUES
+		(1, 1, 1, 2, 'a'), (2, 1, 1, 1, 'b'), (3, 1, 1, 2, 'c')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewGroupChatRepository(db)
+	unread := func() int {
+		t.Helper()
+		n, last, err := repo.GetChannelState(1, 1)
+		if err != nil || last == nil || last.ID != 3 {
+			t.Fatalf("channel state: last %v, %v, want message 3", last, err)
+		}
+		return n
+	}
+
+	if n := unread(); n != 2 {
+		t.Fatalf("%d unread before reading, want the 2 of bob", n)
+	}
+	if got, err := repo.MarkRead(1, 1, 1); err != nil || got != 1 {
+		t.Fatalf("reading up to 1: pointer %d, %v", got, err)
+	}
+	if n := unread(); n != 1 {
+		t.Errorf("%d unread after reading up to 1, want 1", n)
+	}
+	if got, err := repo.MarkRead(1, 1, 0); err != nil || got != 3 {
+		t.Fatalf("reading everything: pointer %d, %v, want 3", got, err)
+	}
+	if got, err := repo.MarkRead(1, 1, 2); err != nil || got != 3 {
+		t.Errorf("reading up to 2 again moved the pointer back to %d, %v", got, err)
+	}
+	if n := unread(); n != 0 {
+		t.Errorf("%d unread after reading everything", n)
+	}
+}
+
+func TestEditAndUnsendMessage(t *testing.T) {
+	db, dir := newTestDB(t)
+	now, old := time.Now().UTC(), time.Now().UTC().Add(-MessageEditWindow-time.Minute)
+	_, err := db.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content, sent_at, reply_to_id) VALUES
+		(1, 1, 2, 'typo', ?, NULL), (2, 1, 2, 'old', ?, NULL), (3, 2, 1, 'reply', ?, 1)`, now, old, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := attach(t, db, dir, "message_id", 1)
+	repo := NewChatRepository(db)
+
+	if _, err := repo.EditMessage(2, 1, "mine now"); err != ErrMessageNotFound {
+		t.Errorf("editing the message of somebody else: %v, want ErrMessageNotFound", err)
+	}
+	if _, err := repo.EditMessage(1, 2, "too late"); err != ErrEditWindowClosed {
+		t.Errorf("editing after the window: %v, want ErrEditWindowClosed", err)
+	}
+	edited, err := repo.EditMessage(1, 1, "fixed")
+	if err != nil || edited.Content != "fixed" || edited.EditedAt == nil {
+		t.Fatalf("editing within the window: %+v, %v", edited, err)
+	}
+
+	if _, err := repo.UnsendMessage(2, 1); err != ErrMessageNotFound {
+		t.Errorf("unsending the message of somebody else: %v, want ErrMessageNotFound", err)
+	}
+	unsent, err := repo.UnsendMessage(1, 1)
+	if err != nil || !unsent.Deleted || unsent.Content != "" || len(unsent.Attachments) != 0 {
+		t.Fatalf("unsending: %+v, %v, want a tombstone", unsent, err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Error("the attachment file of the unsent message was kept")
+	}
+	if _, err := repo.UnsendMessage(1, 1); err != ErrMessageNotFound {
+		t.Errorf("unsending twice: %v, want ErrMessageNotFound", err)
+	}
+	if _, err := repo.EditMessage(1, 1, "back"); err != ErrMessageNotFound {
+		t.Errorf("editing an unsent message: %v, want ErrMessageNotFound", err)
+	}
+	// unsending has no time limit, and the replies quote the tombstone
+	if _, err := repo.UnsendMessage(1, 2); err != nil {
+		t.Errorf("unsending after the edit window: %v", err)
+	}
+	reply, err := repo.GetMessage(3)
+	if err != nil || reply.ReplyTo == nil || !reply.ReplyTo.Deleted || reply.ReplyTo.Content != "" {
+		t.Fatalf("reply to the unsent message: %+v, %v, want a deleted quote", reply, err)
+	}
+}
+
+func TestEditAndUnsendGroupChatMessage(t *testing.T) {
+	db, _ := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO group_chat_channels (id, group_id, name, creator_id) VALUES (2, 1, 'random', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`INSERT INTO group_messages (id, group_id, channel_id, sender_id, content, sent_at) VALUES
+		(1, 1, 1, 1, 'typo', ?), (2, 1, 1, 1, 'old', ?)`, time.Now().UTC(), time.Now().UTC().Add(-MessageEditWindow-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewGroupChatRepository(db)
+
+	if _, err := repo.EditMessage(2, 1, 1, "elsewhere"); err != ErrMessageNotFound {
+		t.Errorf("editing through another channel: %v, want ErrMessageNotFound", err)
+	}
+	if _, err := repo.EditMessage(1, 2, 1, "mine now"); err != ErrMessageNotFound {
+		t.Errorf("editing the message of somebody else: %v, want ErrMessageNotFound", err)
+	}
+	if _, err := repo.EditMessage(1, 1, 2, "too late"); err != ErrEditWindowClosed {
+		t.Errorf("editing after the window: %v, want ErrEditWindowClosed", err)
+	}
+	if edited, err := repo.EditMessage(1, 1, 1, "fixed"); err != nil || edited.Content != "fixed" || edited.EditedAt == nil {
+		t.Fatalf("editing within the window: %+v, %v", edited, err)
+	}
+	if _, err := repo.UnsendMessage(2, 1, 1); err != ErrMessageNotFound {
+		t.Errorf("unsending through another channel: %v, want ErrMessageNotFound", err)
+	}
+	if unsent, err := repo.UnsendMessage(1, 1, 2); err != nil || !unsent.Deleted || unsent.Content != "" {
+		t.Fatalf("unsending after the edit window: %+v, %v, want a tombstone", unsent, err)
+	}
+}
@@ -0,0 +1,139 @@
+package repositories
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"social-network/internal/models"
+	"social-network/internal/policy"
+)
+
+var ErrEmptySearch = errors.New("search has no words")
+
+// MessageSearch is a keyword search over the chats of UserID. PeerID limits
+// it to the conversation with one user, GroupID to one group chat and
+// ChannelID to one of its channels; the other filters are optional.
+type MessageSearch struct {
+	UserID    int
+	Query     string
+	SenderID  int
+	PeerID    int
+	GroupID   int
+	ChannelID int
+	From, To  time.Time // sent_at in [From, To)
+	Limit     int
+	Offset    int
+}
+
+// ftsQuery turns free text into an FTS match expression: every word must
+// appear, as a prefix, and the user cannot inject FTS operators.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word != "" {
+			terms = append(terms, `"`+word+`*"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchMessages returns a page of the messages matching search, newest
+// first, and whether more matches exist. Only conversations the user takes
+// part in and group chat channels they can read are searched; hidden and
+// unsent messages never match.
+func (repo *ChatRepository) SearchMessages(search MessageSearch) ([]models.MessageSearchResult, bool, error) {
+	match := ftsQuery(search.Query)
+	if match == "" {
+		return nil, false, ErrEmptySearch
+	}
+
+	// filters shared by both halves of the union, over the alias x
+	filters := func(x string) (string, []any) {
+		cond, args := "", []any{}
+		if search.SenderID != 0 {
+			cond += " AND " + x + ".sender_id = ?"
+			args = append(args, search.SenderID)
+		}
+		// julianday compares the stored texts of both formats, CURRENT_TIMESTAMP's and the driver's
+		if !search.From.IsZero() {
+			cond += " AND julianday(" + x + ".sent_at) >= julianday(?)"
+			args = append(args, search.From.UTC())
+		}
+		if !search.To.IsZero() {
+			cond += " AND julianday(" + x + ".sent_at) < julianday(?)"
+			args = append(args, search.To.UTC())
+		}
+		return cond, args
+	}
+
+	var parts []string
+	var args []any
+	if search.GroupID == 0 && search.ChannelID == 0 {
+		cond, filterArgs := filters("m")
+		query := `
+			SELECT m.id, m.sender_id, m.receiver_id, NULL, NULL, m.content, m.sent_at, m.edited_at, u.nickname
+			FROM messages_fts f
+			JOIN messages m ON m.id = f.docid
+			JOIN users u ON u.id = m.sender_id
+			WHERE messages_fts MATCH ? AND m.hidden = 0 AND m.deleted_at IS NULL
+				AND (m.sender_id = ? OR m.receiver_id = ?)` + cond
+		args = append(args, match, search.UserID, search.UserID)
+		if search.PeerID != 0 {
+			query += " AND (m.sender_id = ? OR m.receiver_id = ?)"
+			filterArgs = append(filterArgs, search.PeerID, search.PeerID)
+		}
+		parts = append(parts, query)
+		args = append(args, filterArgs...)
+	}
+	if search.PeerID == 0 {
+		cond, filterArgs := filters("gm")
+		member, memberArgs := policy.ChannelReadable("gm.channel_id", search.UserID)
+		query := `
+			SELECT gm.id, gm.sender_id, NULL, gm.group_id, gm.channel_id, gm.content, gm.sent_at, gm.edited_at, u.nickname
+			FROM group_messages_fts f
+			JOIN group_messages gm ON gm.id = f.docid
+			JOIN users u ON u.id = gm.sender_id
+			WHERE group_messages_fts MATCH ? AND gm.hidden = 0 AND gm.deleted_at IS NULL
+				AND ` + member + cond
+		args = append(append(append(args, match), memberArgs...), filterArgs...)
+		if search.GroupID != 0 {
+			query += " AND gm.group_id = ?"
+			args = append(args, search.GroupID)
+		}
+		if search.ChannelID != 0 {
+			query += " AND gm.channel_id = ?"
+			args = append(args, search.ChannelID)
+		}
+		parts = append(parts, query)
+	}
+
+	rows, err := repo.DB.Query(`SELECT * FROM (`+strings.Join(parts, " UNION ALL ")+`)
+		ORDER BY julianday(sent_at) DESC, id DESC LIMIT ? OFFSET ?`, append(args, search.Limit+1, search.Offset)...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	results := []models.MessageSearchResult{}
+	for rows.Next() {
+		var result models.MessageSearchResult
+		msg := &result.ChatMessage
+		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.GroupID, &result.ChannelID, &msg.Content, &msg.SentAt, &msg.EditedAt, &result.Nickname)
+		if err != nil {
+			return nil, false, err
+		}
+		result.HistoryBefore = msg.ID + 1
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(results) > search.Limit
+	if hasMore {
+		results = results[:search.Limit]
+	}
+	return results, hasMore, nil
+}
@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+)
+
+// TestSearchMessagesSentAt filters and orders by the instant a message was
+// sent, whatever the format its sent_at was stored in.
+func TestSearchMessagesSentAt(t *testing.T) {
+	db, _ := newTestDB(t)
+	// 1 at 09:00 UTC stored with an offset, 2 at 10:30 UTC as CURRENT_TIMESTAMP stores it
+	_, err := db.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content, sent_at) VALUES
+		(1, 1, 2, 'hello early', '2026-01-02 11:00:00+02:00'), (2, 2, 1, 'hello late', '2026-01-02 10:30:00')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewChatRepository(db)
+	ids := func(search MessageSearch) []int {
+		t.Helper()
+		search.UserID, search.Query, search.Limit = 1, "hello", 10
+		results, _, err := repo.SearchMessages(search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		return ids
+	}
+
+	if got := ids(MessageSearch{}); len(got) != 2 || got[0] != 2 {
+		t.Errorf("got messages %v, want the later 2 first", got)
+	}
+	ten := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	if got := ids(MessageSearch{From: ten}); len(got) != 1 || got[0] != 2 {
+		t.Errorf("from 10:00 got messages %v, want [2]", got)
+	}
+	if got := ids(MessageSearch{To: ten}); len(got) != 1 || got[0] != 1 {
+		t.Errorf("to 10:00 got messages %v, want [1]", got)
+	}
+}
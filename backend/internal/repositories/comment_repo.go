@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"database/sql"
+	"time"
 
 	"social-network/internal/models"
 )
@@ -14,49 +15,171 @@ func NewCommentRepository(db *sql.DB) *CommentRepository {
 	return &CommentRepository{DB: db}
 }
 
-func (repo *CommentRepository) GetCommentsForPost(postID int) ([]models.Comment, error) {
-	var comments []models.Comment
+// GetCommentsForPost returns a page of top-level comments of the post, oldest
+// first, each with its whole reply thread, plus the total number of top-level comments.
+func (repo *CommentRepository) GetCommentsForPost(postID, viewerID, limit, offset int) ([]models.Comment, int, error) {
+	var total int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM comments WHERE post_id = ? AND hidden = 0 AND parent_id IS NULL`, postID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	rows, err := repo.DB.Query(`
-        SELECT *
-        FROM comments
-        WHERE post_id = ?
-        ORDER BY id ASC`, postID)
+	rows, err := repo.DB.Query(threadPage("comments", "post_id",
+		`id, post_id, user_id, parent_id, username, content, image, created_at, edited_at`), postID, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
+	var roots []models.Comment
+	children := make(map[int][]models.Comment)
+	var ids []int
 	for rows.Next() {
-		var comment models.Comment
-		err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Nickname, &comment.Content, &comment.Image)
+		comment, err := scanComment(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
+		}
+		ids = append(ids, comment.ID)
+		if comment.ParentID == nil {
+			roots = append(roots, *comment)
+		} else {
+			children[*comment.ParentID] = append(children[*comment.ParentID], *comment)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	reactions, err := NewReactionRepository(repo.DB).GetReactionSummaries(models.TargetComment, ids, viewerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range roots {
+		roots[i].Reactions = reactions[roots[i].ID]
+	}
+	for parentID := range children {
+		for i := range children[parentID] {
+			children[parentID][i].Reactions = reactions[children[parentID][i].ID]
 		}
-		comments = append(comments, comment)
 	}
-	return comments, nil
+	for i := range roots {
+		attachReplies(&roots[i], children)
+	}
+	return roots, total, nil
+}
+
+// threadPage selects columns of a page (LIMIT ?, OFFSET ?) of the top-level
+// comments on the post (postColumn = ?) in table, and of every reply below
+// them, oldest first. A hidden comment hides its replies too.
+func threadPage(table, postColumn, columns string) string {
+	return `WITH RECURSIVE page(id) AS (
+			SELECT id FROM ` + table + ` WHERE ` + postColumn + ` = ? AND hidden = 0 AND parent_id IS NULL
+			ORDER BY id LIMIT ? OFFSET ?
+		), thread(id) AS (
+			SELECT id FROM page
+			UNION ALL SELECT c.id FROM ` + table + ` c JOIN thread t ON c.parent_id = t.id WHERE c.hidden = 0
+		)
+		SELECT ` + columns + ` FROM ` + table + ` WHERE id IN (SELECT id FROM thread) ORDER BY id`
 }
 
+// attachReplies fills the replies of comment, and of its replies, from children.
+// Replies to a hidden comment are dropped together with it.
+func attachReplies(comment *models.Comment, children map[int][]models.Comment) {
+	comment.Replies = children[comment.ID]
+	if comment.Replies == nil {
+		comment.Replies = []models.Comment{}
+	}
+	for i := range comment.Replies {
+		attachReplies(&comment.Replies[i], children)
+	}
+}
+
+// AddComment stores the comment and sets its id.
 func (repo *CommentRepository) AddComment(comment *models.Comment) error {
-	_, err := repo.DB.Exec(`
-        INSERT INTO comments (post_id, user_id, content, username) 
-        VALUES (?, ?, ?, ?)`,
-		comment.PostID, comment.UserID, comment.Content, comment.Nickname,
+	result, err := repo.DB.Exec(`
+        INSERT INTO comments (post_id, user_id, parent_id, content, username, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`,
+		comment.PostID, comment.UserID, comment.ParentID, comment.Content, comment.Nickname, time.Now().UTC(),
 	)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	comment.ID = int(id)
+	return err
+}
+
+// GetComment returns a single comment without its replies.
+func (repo *CommentRepository) GetComment(commentID int) (*models.Comment, error) {
+	row := repo.DB.QueryRow(`
+		SELECT id, post_id, user_id, parent_id, username, content, image, created_at, edited_at
+		FROM comments
+		WHERE id = ? AND hidden = 0`, commentID)
+	comment, err := scanComment(row)
+	if err != nil {
+		return nil, err
+	}
+	comment.Replies = []models.Comment{}
+	return comment, nil
+}
+
+// UpdateComment replaces the content of a comment and marks it as edited.
+func (repo *CommentRepository) UpdateComment(commentID int, content string) error {
+	_, err := repo.DB.Exec(`UPDATE comments SET content = ?, edited_at = ? WHERE id = ?`, content, time.Now().UTC(), commentID)
 	return err
 }
 
-func (repo *CommentRepository) GetLastInsertedComment(userID, postID int) (*models.Comment, error) {
+// DeleteComment removes the comment, every reply below it and their reactions.
+func (repo *CommentRepository) DeleteComment(commentID int) error {
+	return deleteThread(repo.DB, "comments", models.TargetComment, commentID)
+}
+
+// deleteThread deletes a comment and its replies, at any depth, from table.
+func deleteThread(db *sql.DB, table, targetType string, commentID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	thread := `WITH RECURSIVE thread(id) AS (
+			SELECT ? UNION ALL SELECT c.id FROM ` + table + ` c JOIN thread t ON c.parent_id = t.id
+		)`
+	_, err = tx.Exec(thread+` DELETE FROM reactions WHERE target_type = ? AND target_id IN (SELECT id FROM thread)`, commentID, targetType)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(thread+` DELETE FROM `+table+` WHERE id IN (SELECT id FROM thread)`, commentID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row rowScanner) (*models.Comment, error) {
 	var comment models.Comment
-	err := repo.DB.QueryRow(`
-		SELECT id, post_id, user_id, content, image, username 
-		FROM comments 
-		WHERE user_id = ? AND post_id = ? 
-		ORDER BY id DESC LIMIT 1`, userID, postID).
-		Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.Image, &comment.Nickname)
+	var parentID sql.NullInt64
+	var image sql.NullString
+	var createdAt, editedAt sql.NullTime
+	err := row.Scan(&comment.ID, &comment.PostID, &comment.UserID, &parentID, &comment.Nickname,
+		&comment.Content, &image, &createdAt, &editedAt)
 	if err != nil {
 		return nil, err
 	}
+	comment.Image = image.String
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		comment.ParentID = &id
+	}
+	if createdAt.Valid {
+		comment.CreatedAt = &createdAt.Time
+	}
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
 	return &comment, nil
 }
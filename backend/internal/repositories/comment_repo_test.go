@@ -0,0 +1,55 @@
+package repositories
+
+import "testing"
+
+func TestGetCommentsForPost(t *testing.T) {
+	db, _ := newTestDB(t)
+	seed := []string{
+		`INSERT INTO posts (id, user_id, content, privacy) VALUES (1, 1, 'post', 'public')`,
+		// roots 1, 2 (hidden), 3 and 9; 4 and 5 reply to 3, 6 to 5; 7 is hidden with its reply 8
+		`INSERT INTO comments (id, post_id, user_id, parent_id, content, hidden, username) VALUES
+			(1, 1, 1, NULL, 'first', 0, 'alice'), (2, 1, 2, NULL, 'hidden', 1, 'bob'), (3, 1, 2, NULL, 'second', 0, 'bob'),
+			(4, 1, 1, 3, 'reply', 0, 'alice'), (5, 1, 2, 3, 'reply', 0, 'bob'), (6, 1, 1, 5, 'nested', 0, 'alice'),
+			(7, 1, 1, 3, 'hidden reply', 1, 'alice'), (8, 1, 2, 7, 'under the hidden', 0, 'bob'), (9, 1, 1, NULL, 'third', 0, 'alice')`,
+		`INSERT INTO reactions (target_type, target_id, user_id, reaction) VALUES
+			('comment', 3, 1, 'like'), ('comment', 3, 2, 'like'), ('comment', 6, 2, 'love'), ('post', 3, 1, 'love')`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+
+	comments, total, err := NewCommentRepository(db).GetCommentsForPost(1, 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Errorf("total = %d, want the 3 visible top-level comments", total)
+	}
+	if len(comments) != 1 || comments[0].ID != 3 {
+		t.Fatalf("got %+v, want the second page of one, comment 3", comments)
+	}
+	root := comments[0]
+	if root.Reactions.Total != 2 || root.Reactions.Counts["like"] != 2 || root.Reactions.ViewerReaction != "like" {
+		t.Errorf("reactions of comment 3 = %+v, want 2 likes, one the viewer's", root.Reactions)
+	}
+	if len(root.Replies) != 2 || root.Replies[0].ID != 4 || root.Replies[1].ID != 5 {
+		t.Fatalf("replies of comment 3 = %+v, want 4 and 5 without the hidden one", root.Replies)
+	}
+	if replies := root.Replies[0].Replies; replies == nil || len(replies) != 0 {
+		t.Errorf("replies of comment 4 = %#v, want empty", replies)
+	}
+	nested := root.Replies[1].Replies
+	if len(nested) != 1 || nested[0].ID != 6 {
+		t.Fatalf("replies of comment 5 = %+v, want 6", nested)
+	}
+	if r := nested[0].Reactions; r.Total != 1 || r.Counts["love"] != 1 || r.ViewerReaction != "" {
+		t.Errorf("reactions of comment 6 = %+v, want one love of another user", r)
+	}
+
+	comments, _, err = NewCommentRepository(db).GetCommentsForPost(1, 1, 10, 3)
+	if err != nil || len(comments) != 0 {
+		t.Errorf("past the end got %+v, %v, want none", comments, err)
+	}
+}
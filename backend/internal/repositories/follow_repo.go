@@ -0,0 +1,206 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"social-network/internal/models"
+)
+
+// FollowRepository handles follow relations between users
+type FollowRepository struct {
+	DB *sql.DB
+}
+
+// NewFollowRepository creates a new instance of FollowRepository
+func NewFollowRepository(db *sql.DB) *FollowRepository {
+	return &FollowRepository{DB: db}
+}
+
+// GetFollowers returns a page of the accepted followers of userID, by
+// nickname, and their total number. Each one is marked when viewerID follows them.
+func (repo *FollowRepository) GetFollowers(userID, viewerID, limit, offset int) ([]models.NetworkUser, int, error) {
+	var total int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM followers WHERE following_id = ? AND status = 'accepted'`, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	users, err := repo.listNetwork(`
+		SELECT `+ProfileColumns("u")+`, '', `+followedByViewer+`
+		FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.following_id = ? AND f.status = 'accepted'
+		ORDER BY u.nickname ASC
+		LIMIT ? OFFSET ?`, viewerID, userID, limit, offset)
+	return users, total, err
+}
+
+// GetFollowing returns a page of the users userID follows, by nickname, and
+// their total number. Pending requests are only listed when withPending is
+// set, for the owner of the list.
+func (repo *FollowRepository) GetFollowing(userID, viewerID int, withPending bool, limit, offset int) ([]models.NetworkUser, int, error) {
+	statusFilter := ` AND f.status = 'accepted'`
+	if withPending {
+		statusFilter = ``
+	}
+
+	var total int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM followers f WHERE f.follower_id = ?`+statusFilter, userID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	users, err := repo.listNetwork(`
+		SELECT `+ProfileColumns("u")+`, f.status, `+followedByViewer+`
+		FROM followers f
+		JOIN users u ON u.id = f.following_id
+		WHERE f.follower_id = ?`+statusFilter+`
+		ORDER BY u.nickname ASC
+		LIMIT ? OFFSET ?`, viewerID, userID, limit, offset)
+	return users, total, err
+}
+
+// GetFollowCounts returns how many accepted followers userID has and how
+// many users they follow, pending requests left out.
+func (repo *FollowRepository) GetFollowCounts(userID int) (followers, following int, err error) {
+	err = repo.DB.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM followers WHERE following_id = ? AND status = 'accepted'),
+			(SELECT COUNT(*) FROM followers WHERE follower_id = ? AND status = 'accepted')`,
+		userID, userID).Scan(&followers, &following)
+	return followers, following, err
+}
+
+// SetPrivacy makes the profile of userID private or public. Going public
+// accepts every pending request to follow userID in the same transaction and
+// returns who sent them.
+func (repo *FollowRepository) SetPrivacy(userID int, private bool) ([]int, error) {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET is_private = ? WHERE id = ?`, private, userID); err != nil {
+		return nil, err
+	}
+	if private {
+		return nil, tx.Commit()
+	}
+
+	rows, err := tx.Query(`SELECT follower_id FROM followers WHERE following_id = ? AND status = 'pending'`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var requesters []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		requesters = append(requesters, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`UPDATE followers SET status = 'accepted' WHERE following_id = ? AND status = 'pending'`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return requesters, tx.Commit()
+}
+
+// ResolveRequests accepts, or deletes when accept is false, the pending
+// follow requests to userID among requestIDs. Requests that are not pending
+// requests to userID are left alone. It returns the resolved request ids
+// mapped to who sent them.
+func (repo *FollowRepository) ResolveRequests(userID int, requestIDs []int, accept bool) (map[int]int, error) {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	resolved := make(map[int]int)
+	for _, requestID := range requestIDs {
+		var followerID int
+		err := tx.QueryRow(`
+			SELECT follower_id FROM followers WHERE id = ? AND following_id = ? AND status = 'pending'`,
+			requestID, userID).Scan(&followerID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if accept {
+			_, err = tx.Exec(`UPDATE followers SET status = 'accepted' WHERE id = ?`, requestID)
+		} else {
+			_, err = tx.Exec(`DELETE FROM followers WHERE id = ?`, requestID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved[requestID] = followerID
+	}
+	return resolved, tx.Commit()
+}
+
+// PendingRequestIDs returns the ids of every pending request to follow userID.
+func (repo *FollowRepository) PendingRequestIDs(userID int) ([]int, error) {
+	rows, err := repo.DB.Query(`SELECT id FROM followers WHERE following_id = ? AND status = 'pending'`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// RemoveFollower makes followerID stop following userID.
+func (repo *FollowRepository) RemoveFollower(userID, followerID int) error {
+	result, err := repo.DB.Exec(`
+		DELETE FROM followers WHERE follower_id = ? AND following_id = ? AND status = 'accepted'`, followerID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// followedByViewer selects whether the viewer (first argument) has an
+// accepted follow on the listed user u.
+const followedByViewer = `EXISTS (
+	SELECT 1 FROM followers vf WHERE vf.follower_id = ? AND vf.following_id = u.id AND vf.status = 'accepted'
+)`
+
+func (repo *FollowRepository) listNetwork(query string, args ...any) ([]models.NetworkUser, error) {
+	rows, err := repo.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.NetworkUser{}
+	for rows.Next() {
+		var entry models.NetworkUser
+		user, err := ScanProfile(rows, &entry.Status, &entry.FollowedByViewer)
+		if err != nil {
+			return nil, err
+		}
+		entry.User = *user
+		users = append(users, entry)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,87 @@
+package repositories
+
+import "testing"
+
+func TestSetPrivacy(t *testing.T) {
+	db, _ := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO followers (follower_id, following_id, status) VALUES (2, 1, 'pending')`); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewFollowRepository(db)
+
+	if requesters, err := repo.SetPrivacy(1, true); err != nil || len(requesters) != 0 {
+		t.Fatalf("going private: accepted %v, %v, want none", requesters, err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM users WHERE id = 1 AND is_private = 1`); n != 1 {
+		t.Fatal("the profile did not go private")
+	}
+
+	// a failure to accept the requests leaves the profile private
+	if _, err := db.Exec(`CREATE TRIGGER refuse BEFORE UPDATE ON followers BEGIN SELECT RAISE(ABORT, 'refused'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetPrivacy(1, false); err == nil {
+		t.Fatal("going public succeeded although the requests could not be accepted")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM users WHERE id = 1 AND is_private = 1`); n != 1 {
+		t.Fatal("the profile went public with its requests still pending")
+	}
+
+	if _, err := db.Exec(`DROP TRIGGER refuse`); err != nil {
+		t.Fatal(err)
+	}
+	requesters, err := repo.SetPrivacy(1, false)
+	if err != nil || len(requesters) != 1 || requesters[0] != 2 {
+		t.Fatalf("going public: accepted %v, %v, want [2]", requesters, err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM users WHERE id = 1 AND is_private = 0`); n != 1 {
+		t.Error("the profile did not go public")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM followers WHERE status = 'accepted'`); n != 1 {
+		t.Error("the pending request was not accepted")
+	}
+}
+
+func TestResolveRequests(t *testing.T) {
+	db, _ := newTestDB(t)
+	seed := []string{
+		`INSERT INTO users (id, nickname, email, password, first_name, last_name, date_of_birth) VALUES
+			(3, 'carol', 'carol@x.io', '-', 'Carol', 'C', '2000-01-01')`,
+		`INSERT INTO followers (id, follower_id, following_id, status) VALUES
+			(1, 2, 1, 'pending'), (2, 3, 1, 'pending'), (3, 1, 2, 'pending'), (4, 3, 2, 'accepted')`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+	repo := NewFollowRepository(db)
+
+	// requests to somebody else, accepted ones and missing ones are left alone
+	if resolved, err := repo.ResolveRequests(1, []int{3, 4, 99}, true); err != nil || len(resolved) != 0 {
+		t.Fatalf("resolving requests alice does not own: %v, %v, want none", resolved, err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM followers WHERE id = 3 AND status = 'pending'`); n != 1 {
+		t.Fatal("the request to bob was resolved by alice")
+	}
+
+	resolved, err := repo.ResolveRequests(1, []int{1, 3}, false)
+	if err != nil || len(resolved) != 1 || resolved[1] != 2 {
+		t.Fatalf("rejecting: %v, %v, want request 1 from bob", resolved, err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM followers WHERE id IN (1, 3)`); n != 1 {
+		t.Fatal("rejecting did not delete only the request of bob")
+	}
+
+	ids, err := repo.PendingRequestIDs(1)
+	if err != nil || len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("pending requests to alice: %v, %v, want [2]", ids, err)
+	}
+	resolved, err = repo.ResolveRequests(1, ids, true)
+	if err != nil || len(resolved) != 1 || resolved[2] != 3 {
+		t.Fatalf("accepting all: %v, %v, want request 2 from carol", resolved, err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM followers WHERE id = 2 AND status = 'accepted'`); n != 1 {
+		t.Error("the request of carol was not accepted")
+	}
+}
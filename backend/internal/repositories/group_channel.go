@@ -0,0 +1,213 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"social-network/internal/models"
+	"social-network/internal/policy"
+)
+
+var (
+	ErrChannelNotFound    = errors.New("channel not found")
+	ErrChannelExists      = errors.New("the group already has a channel with this name")
+	ErrInvalidChannelName = errors.New("channel names are 1 to 32 lowercase letters, digits, - or _")
+	ErrDefaultChannel     = errors.New("the default channel cannot be archived")
+	ErrNotGroupMember     = errors.New("not an approved member of the group")
+)
+
+var channelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ChannelName normalizes a channel name as typed, e.g. "#Events", to the
+// stored form, "events".
+func ChannelName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(name), "#"))
+	if !channelNamePattern.MatchString(name) {
+		return "", ErrInvalidChannelName
+	}
+	return name, nil
+}
+
+// GroupChannelRepository manages the channels of the group chats and the
+// members of the private ones
+type GroupChannelRepository struct {
+	DB *sql.DB
+}
+
+// NewGroupChannelRepository creates a new instance of GroupChannelRepository
+func NewGroupChannelRepository(db *sql.DB) *GroupChannelRepository {
+	return &GroupChannelRepository{DB: db}
+}
+
+const groupChannelColumns = `c.id, c.group_id, c.name, c.private, c.is_default, c.creator_id, c.created_at, c.archived_at
+	FROM group_chat_channels c`
+
+func scanGroupChannel(row rowScanner) (models.GroupChannel, error) {
+	var channel models.GroupChannel
+	err := row.Scan(&channel.ID, &channel.GroupID, &channel.Name, &channel.Private, &channel.IsDefault,
+		&channel.CreatorID, &channel.CreatedAt, &channel.ArchivedAt)
+	return channel, err
+}
+
+// CreateChannel adds a channel named name (see ChannelName) to the group. The
+// creator is the first member of a private channel.
+func (repo *GroupChannelRepository) CreateChannel(groupID, creatorID int, name string, private bool) (*models.GroupChannel, error) {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO group_chat_channels (group_id, name, private, creator_id) VALUES (?, ?, ?, ?)`,
+		groupID, name, private, creatorID)
+	if isUniqueViolation(err) {
+		return nil, ErrChannelExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if private {
+		if _, err := tx.Exec(`INSERT INTO group_chat_channel_members (channel_id, user_id) VALUES (?, ?)`, id, creatorID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return repo.GetChannel(int(id))
+}
+
+// GetChannel returns a channel, ErrChannelNotFound if there is none.
+func (repo *GroupChannelRepository) GetChannel(channelID int) (*models.GroupChannel, error) {
+	return repo.channel(`c.id = ?`, channelID)
+}
+
+// DefaultChannel returns the #general channel of the group.
+func (repo *GroupChannelRepository) DefaultChannel(groupID int) (*models.GroupChannel, error) {
+	return repo.channel(`c.group_id = ? AND c.is_default = 1`, groupID)
+}
+
+func (repo *GroupChannelRepository) channel(cond string, args ...any) (*models.GroupChannel, error) {
+	channel, err := scanGroupChannel(repo.DB.QueryRow(`SELECT `+groupChannelColumns+` WHERE `+cond, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrChannelNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// ListChannels returns the channels of the group userID can read, the
+// default one first and archived ones last, with the user's unread count and
+// last message of each.
+func (repo *GroupChannelRepository) ListChannels(userID, groupID int) ([]models.GroupChannel, error) {
+	readable, args := policy.ChannelReadable("c.id", userID)
+	rows, err := repo.DB.Query(`
+		SELECT `+groupChannelColumns+`
+		WHERE c.group_id = ? AND `+readable+`
+		ORDER BY c.is_default DESC, c.archived_at IS NOT NULL, c.name`, append([]any{groupID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []models.GroupChannel{}
+	for rows.Next() {
+		channel, err := scanGroupChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	chats := NewGroupChatRepository(repo.DB)
+	for i := range channels {
+		channels[i].UnreadCount, channels[i].LastMessage, err = chats.GetChannelState(userID, channels[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+// SetArchived archives a channel, making it read only, or restores it.
+func (repo *GroupChannelRepository) SetArchived(channelID int, archived bool) (*models.GroupChannel, error) {
+	channel, err := repo.GetChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+	if channel.IsDefault {
+		return nil, ErrDefaultChannel
+	}
+
+	var archivedAt any
+	if archived {
+		archivedAt = time.Now().UTC()
+	}
+	if _, err := repo.DB.Exec(`UPDATE group_chat_channels SET archived_at = ? WHERE id = ?`, archivedAt, channelID); err != nil {
+		return nil, err
+	}
+	return repo.GetChannel(channelID)
+}
+
+// AddMember adds userID, who must be an approved member of the channel's
+// group, to a private channel. Adding a member twice does nothing.
+func (repo *GroupChannelRepository) AddMember(channel *models.GroupChannel, userID int) error {
+	member, err := policy.CanActInGroup(repo.DB, userID, channel.GroupID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrNotGroupMember
+	}
+	_, err = repo.DB.Exec(`INSERT OR IGNORE INTO group_chat_channel_members (channel_id, user_id) VALUES (?, ?)`, channel.ID, userID)
+	return err
+}
+
+// RemoveMember removes userID from a private channel and reports whether
+// they were a member.
+func (repo *GroupChannelRepository) RemoveMember(channelID, userID int) (bool, error) {
+	result, err := repo.DB.Exec(`DELETE FROM group_chat_channel_members WHERE channel_id = ? AND user_id = ?`, channelID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// GetMembers returns the members of a private channel, with their status in
+// the group.
+func (repo *GroupChannelRepository) GetMembers(channel *models.GroupChannel) ([]models.GroupMember, error) {
+	rows, err := repo.DB.Query(`
+		SELECT u.id, u.nickname, COALESCE(gmb.status, '')
+		FROM group_chat_channel_members chm
+		JOIN users u ON u.id = chm.user_id
+		LEFT JOIN group_members gmb ON gmb.id = chm.user_id AND gmb.group_id = ?
+		WHERE chm.channel_id = ?
+		ORDER BY u.nickname`, channel.GroupID, channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.GroupMember{}
+	for rows.Next() {
+		member := models.GroupMember{GroupID: channel.GroupID}
+		if err := rows.Scan(&member.ID, &member.Nickname, &member.Status); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
@@ -3,8 +3,10 @@ package repositories
 import (
 	"database/sql"
 	"log"
+	"time"
 
-	"social-network/internal/config"
+	"social-network/internal/models"
+	"social-network/internal/policy"
 )
 
 type GroupChatRepository struct {
@@ -15,13 +17,266 @@ func NewGroupChatRepository(db *sql.DB) *GroupChatRepository {
 	return &GroupChatRepository{DB: db}
 }
 
-func (repo *GroupChatRepository) SaveGroupChatMessage(groupID, senderID int, content string) error {
-	db := config.GetDB()
-	_, err := db.Exec(`
-			INSERT INTO group_messages (group_id, sender_id, content)
-			VALUES (?, ?, ?)`, groupID, senderID, content)
+// groupMessageColumns selects a group message gm with its sender's nickname
+// and the message it replies to as q, see scanGroupChatMessage.
+const groupMessageColumns = `gm.id, gm.group_id, COALESCE(gm.channel_id, 0), gm.sender_id, u.nickname, gm.content, gm.sent_at, gm.edited_at, gm.deleted_at IS NOT NULL,
+	COALESCE(gm.client_id, ''), gm.expires_at, gm.system,
+	q.id, q.sender_id, q.content, q.deleted_at IS NOT NULL OR q.hidden = 1
+	FROM group_messages gm
+	JOIN users u ON gm.sender_id = u.id
+	LEFT JOIN group_messages q ON q.id = gm.reply_to_id`
+
+func scanGroupChatMessage(row rowScanner) (models.GroupChatMessage, error) {
+	var msg models.GroupChatMessage
+	var quote quoteColumns
+	err := row.Scan(&msg.ID, &msg.GroupID, &msg.ChannelID, &msg.SenderID, &msg.Nickname, &msg.Content, &msg.SentAt, &msg.EditedAt, &msg.Deleted,
+		&msg.ClientID, &msg.ExpiresAt, &msg.System, &quote.id, &quote.senderID, &quote.content, &quote.deleted)
+	msg.ReplyTo = quote.quote()
+	return msg, err
+}
+
+// SaveGroupChatMessage stores a message in the draft's group chat channel
+// and returns it. When the sender already sent a message with the same
+// ClientID in the channel that one is returned instead and created is false.
+func (repo *GroupChatRepository) SaveGroupChatMessage(draft MessageDraft) (msg *models.GroupChatMessage, created bool, err error) {
+	if existing, err := repo.messageByClientID(draft.ChannelID, draft.SenderID, draft.ClientID); err != ErrMessageNotFound {
+		return existing, false, err
+	}
+
+	var replyTo any
+	if draft.ReplyToID != 0 {
+		var exists bool
+		err := repo.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_messages WHERE id = ? AND channel_id = ? AND hidden = 0)`,
+			draft.ReplyToID, draft.ChannelID).Scan(&exists)
+		if err != nil {
+			return nil, false, err
+		}
+		if !exists {
+			return nil, false, ErrMessageNotFound
+		}
+		replyTo = draft.ReplyToID
+	}
+
+	_, lifetime, err := NewRetentionRepository(repo.DB).group(draft.GroupID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+			INSERT INTO group_messages (group_id, channel_id, sender_id, content, reply_to_id, client_id, expires_at, system)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, draft.GroupID, draft.ChannelID, draft.SenderID, draft.Content, replyTo, nullIfEmpty(draft.ClientID),
+		expiresAt(lifetime), draft.System)
+	if isUniqueViolation(err) {
+		tx.Rollback()
+		existing, err := repo.messageByClientID(draft.ChannelID, draft.SenderID, draft.ClientID)
+		return existing, false, err
+	}
 	if err != nil {
 		log.Println("❌ Error saving message:", err)
+		return nil, false, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, false, err
+	}
+	if err := claimAttachments(tx, "group_message_id", int(id), draft.SenderID, draft.AttachmentIDs); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	msg, err = repo.GetMessage(draft.ChannelID, int(id))
+	return msg, err == nil, err
+}
+
+// messageByClientID returns senderID's message in the channel with the
+// given client id, ErrMessageNotFound if there is none or clientID is empty.
+func (repo *GroupChatRepository) messageByClientID(channelID, senderID int, clientID string) (*models.GroupChatMessage, error) {
+	if clientID == "" {
+		return nil, ErrMessageNotFound
+	}
+	var id int
+	err := repo.DB.QueryRow(`SELECT id FROM group_messages WHERE sender_id = ? AND channel_id = ? AND client_id = ?`, senderID, channelID, clientID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repo.GetMessage(channelID, id)
+}
+
+// GetMessage returns one message of a group chat channel,
+// ErrMessageNotFound if the channel has no such message.
+func (repo *GroupChatRepository) GetMessage(channelID, messageID int) (*models.GroupChatMessage, error) {
+	msg, err := scanGroupChatMessage(repo.DB.QueryRow(`SELECT `+groupMessageColumns+` WHERE gm.id = ? AND gm.channel_id = ?`, messageID, channelID))
+	if err == sql.ErrNoRows {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	messages := []models.GroupChatMessage{msg}
+	if err := repo.withAttachments(messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+func (repo *GroupChatRepository) withAttachments(messages []models.GroupChatMessage) error {
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	byMessage, err := loadAttachments(repo.DB, "group_message_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// EditMessage replaces the content of senderID's message in the channel
+// within MessageEditWindow of sending it and returns the edited message.
+func (repo *GroupChatRepository) EditMessage(channelID, senderID, messageID int, content string) (*models.GroupChatMessage, error) {
+	msg, err := repo.GetMessage(channelID, messageID)
+	if err != nil {
+		return nil, err
 	}
-	return err
+	if msg.SenderID != senderID || msg.Deleted || msg.System {
+		return nil, ErrMessageNotFound
+	}
+	if time.Since(msg.SentAt) > MessageEditWindow {
+		return nil, ErrEditWindowClosed
+	}
+
+	if _, err := repo.DB.Exec(`UPDATE group_messages SET content = ?, edited_at = ? WHERE id = ?`, content, time.Now().UTC(), messageID); err != nil {
+		return nil, err
+	}
+	return repo.GetMessage(channelID, messageID)
+}
+
+// UnsendMessage deletes the content and attachments of senderID's message in
+// the channel, leaving a tombstone, and returns it.
+func (repo *GroupChatRepository) UnsendMessage(channelID, senderID, messageID int) (*models.GroupChatMessage, error) {
+	result, err := repo.DB.Exec(`
+		UPDATE group_messages SET content = '', deleted_at = ?
+		WHERE id = ? AND channel_id = ? AND sender_id = ? AND deleted_at IS NULL AND system = 0`,
+		time.Now().UTC(), messageID, channelID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrMessageNotFound
+	}
+	if err := deleteAttachments(repo.DB, "group_message_id", messageID); err != nil {
+		return nil, err
+	}
+	return repo.GetMessage(channelID, messageID)
+}
+
+// GetMessages returns a page of a group chat channel and whether more
+// messages exist in the paging direction.
+func (repo *GroupChatRepository) GetMessages(channelID int, page HistoryPage) ([]models.GroupChatMessage, bool, error) {
+	cond, args, order := page.window("gm.id")
+	rows, err := repo.DB.Query(`
+		SELECT `+groupMessageColumns+`
+		WHERE gm.channel_id = ? AND gm.hidden = 0 AND `+cond+`
+		ORDER BY `+order, append([]any{channelID}, args...)...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	messages := []models.GroupChatMessage{}
+	for rows.Next() {
+		msg, err := scanGroupChatMessage(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	messages, hasMore := trim(page, messages)
+	if err := repo.withAttachments(messages); err != nil {
+		return nil, false, err
+	}
+	return messages, hasMore, nil
+}
+
+// GetChatState returns how many messages of the group userID has not read
+// and the group's last message as a preview, nil when the chat is empty,
+// over the channels of the group the user can read.
+func (repo *GroupChatRepository) GetChatState(userID, groupID int) (int, *models.GroupChatMessage, error) {
+	readable, args := policy.ChannelReadable("gm.channel_id", userID)
+	return repo.chatState(userID, "gm.group_id = ? AND "+readable, append([]any{groupID}, args...))
+}
+
+// GetChannelState is GetChatState for one channel, which the caller checked
+// userID can read.
+func (repo *GroupChatRepository) GetChannelState(userID, channelID int) (int, *models.GroupChatMessage, error) {
+	return repo.chatState(userID, "gm.channel_id = ?", []any{channelID})
+}
+
+// chatState counts the unread messages matching cond, unread by the read
+// pointer of each one's channel, and returns the last of them as a preview.
+func (repo *GroupChatRepository) chatState(userID int, cond string, args []any) (int, *models.GroupChatMessage, error) {
+	var unread int
+	err := repo.DB.QueryRow(`
+		SELECT COUNT(*) FROM group_messages gm
+		WHERE `+cond+` AND gm.sender_id != ? AND gm.hidden = 0
+		AND gm.id > COALESCE((SELECT last_read_id FROM group_chat_channel_reads WHERE user_id = ? AND channel_id = gm.channel_id), 0)`,
+		append(args, userID, userID)...).Scan(&unread)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	last, err := scanGroupChatMessage(repo.DB.QueryRow(`
+		SELECT `+groupMessageColumns+`
+		WHERE `+cond+` AND gm.hidden = 0
+		ORDER BY gm.id DESC LIMIT 1`, args...))
+	if err == sql.ErrNoRows {
+		return unread, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	last.Content = preview(last.Content)
+	return unread, &last, nil
+}
+
+// MarkRead moves userID's read pointer on a group chat channel up to
+// upToID, or to the latest message when upToID is 0. The pointer never
+// moves back. It returns the stored pointer.
+func (repo *GroupChatRepository) MarkRead(userID, channelID, upToID int) (int, error) {
+	var lastID int
+	err := repo.DB.QueryRow(`
+		SELECT COALESCE(MAX(id), 0) FROM group_messages WHERE channel_id = ? AND (? = 0 OR id <= ?)`,
+		channelID, upToID, upToID).Scan(&lastID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = repo.DB.Exec(`
+		INSERT INTO group_chat_channel_reads (user_id, channel_id, last_read_id, read_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, channel_id) DO UPDATE SET
+			last_read_id = MAX(last_read_id, excluded.last_read_id), read_at = excluded.read_at`,
+		userID, channelID, lastID, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	err = repo.DB.QueryRow(`SELECT last_read_id FROM group_chat_channel_reads WHERE user_id = ? AND channel_id = ?`, userID, channelID).Scan(&lastID)
+	return lastID, err
 }
@@ -0,0 +1,30 @@
+package repositories
+
+import "testing"
+
+func TestSaveGroupChatMessageClientID(t *testing.T) {
+	db, _ := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO group_chat_channels (id, group_id, name, creator_id) VALUES (2, 1, 'random', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewGroupChatRepository(db)
+	draft := MessageDraft{SenderID: 1, GroupID: 1, ChannelID: 1, Content: "hi", ClientID: "c1"}
+
+	first, created, err := repo.SaveGroupChatMessage(draft)
+	if err != nil || !created {
+		t.Fatalf("first send: created %v, %v", created, err)
+	}
+	resent, created, err := repo.SaveGroupChatMessage(draft)
+	if err != nil || created || resent.ID != first.ID {
+		t.Fatalf("resend: created %v, %v, got message %v, want %d", created, err, resent, first.ID)
+	}
+
+	draft.ChannelID = 2
+	other, created, err := repo.SaveGroupChatMessage(draft)
+	if err != nil || !created {
+		t.Fatalf("same client id in another channel: created %v, %v", created, err)
+	}
+	if other.ID == first.ID || other.ChannelID != 2 {
+		t.Errorf("got message %d of channel %d, want a new one in channel 2", other.ID, other.ChannelID)
+	}
+}
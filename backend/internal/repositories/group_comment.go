@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"social-network/internal/models"
+)
+
+// GroupCommentRepository handles comments on group posts
+type GroupCommentRepository struct {
+	DB *sql.DB
+}
+
+// NewGroupCommentRepository creates a new instance of GroupCommentRepository
+func NewGroupCommentRepository(db *sql.DB) *GroupCommentRepository {
+	return &GroupCommentRepository{DB: db}
+}
+
+// GetCommentsForPost returns a page of top-level comments of the group post,
+// oldest first, each with its reply thread, plus the total number of top-level comments.
+func (repo *GroupCommentRepository) GetCommentsForPost(postID, viewerID, limit, offset int) ([]models.GroupComment, int, error) {
+	var total int
+	err := repo.DB.QueryRow(`SELECT COUNT(*) FROM group_comments WHERE g_post_id = ? AND hidden = 0 AND parent_id IS NULL`, postID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := repo.DB.Query(threadPage("group_comments", "g_post_id",
+		`id, member_id, g_post_id, group_id, parent_id, content, image, username, created_at, edited_at`), postID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var roots []models.GroupComment
+	children := make(map[int][]models.GroupComment)
+	var ids []int
+	for rows.Next() {
+		comment, err := scanGroupComment(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		ids = append(ids, comment.ID)
+		if comment.ParentID == nil {
+			roots = append(roots, *comment)
+		} else {
+			children[*comment.ParentID] = append(children[*comment.ParentID], *comment)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	reactions, err := NewReactionRepository(repo.DB).GetReactionSummaries(models.TargetGroupComment, ids, viewerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range roots {
+		roots[i].Reactions = reactions[roots[i].ID]
+	}
+	for parentID := range children {
+		for i := range children[parentID] {
+			children[parentID][i].Reactions = reactions[children[parentID][i].ID]
+		}
+	}
+	for i := range roots {
+		attachGroupReplies(&roots[i], children)
+	}
+	return roots, total, nil
+}
+
+func attachGroupReplies(comment *models.GroupComment, children map[int][]models.GroupComment) {
+	comment.Replies = children[comment.ID]
+	if comment.Replies == nil {
+		comment.Replies = []models.GroupComment{}
+	}
+	for i := range comment.Replies {
+		attachGroupReplies(&comment.Replies[i], children)
+	}
+}
+
+// AddComment stores the comment and sets its id.
+func (repo *GroupCommentRepository) AddComment(comment *models.GroupComment) error {
+	result, err := repo.DB.Exec(`
+		INSERT INTO group_comments (member_id, g_post_id, parent_id, content, image, username, group_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		comment.MemberID, comment.GPostID, comment.ParentID, comment.Content, comment.Image, comment.Nickname,
+		comment.GroupID, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	comment.ID = int(id)
+	return err
+}
+
+// GetComment returns a single group comment without its replies.
+func (repo *GroupCommentRepository) GetComment(commentID int) (*models.GroupComment, error) {
+	row := repo.DB.QueryRow(`
+		SELECT id, member_id, g_post_id, group_id, parent_id, content, image, username, created_at, edited_at
+		FROM group_comments
+		WHERE id = ? AND hidden = 0`, commentID)
+	comment, err := scanGroupComment(row)
+	if err != nil {
+		return nil, err
+	}
+	comment.Replies = []models.GroupComment{}
+	return comment, nil
+}
+
+// UpdateComment replaces the content of a group comment and marks it as edited.
+func (repo *GroupCommentRepository) UpdateComment(commentID int, content string) error {
+	_, err := repo.DB.Exec(`UPDATE group_comments SET content = ?, edited_at = ? WHERE id = ?`, content, time.Now().UTC(), commentID)
+	return err
+}
+
+// DeleteComment removes the group comment, every reply below it and their reactions.
+func (repo *GroupCommentRepository) DeleteComment(commentID int) error {
+	return deleteThread(repo.DB, "group_comments", models.TargetGroupComment, commentID)
+}
+
+func scanGroupComment(row rowScanner) (*models.GroupComment, error) {
+	var comment models.GroupComment
+	var parentID sql.NullInt64
+	var createdAt, editedAt sql.NullTime
+	err := row.Scan(&comment.ID, &comment.MemberID, &comment.GPostID, &comment.GroupID, &parentID,
+		&comment.Content, &comment.Image, &comment.Nickname, &createdAt, &editedAt)
+	if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		comment.ParentID = &id
+	}
+	if createdAt.Valid {
+		comment.CreatedAt = &createdAt.Time
+	}
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
+	return &comment, nil
+}
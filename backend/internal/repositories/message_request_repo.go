@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"database/sql"
+	"time"
+
+	"social-network/internal/models"
+)
+
+// MessageRequestRepository keeps the direct messages strangers sent apart
+// until the receiver accepts them, see policy.CheckMessage
+type MessageRequestRepository struct {
+	DB *sql.DB
+}
+
+// NewMessageRequestRepository creates a new instance of MessageRequestRepository
+func NewMessageRequestRepository(db *sql.DB) *MessageRequestRepository {
+	return &MessageRequestRepository{DB: db}
+}
+
+// RecordRequest opens a pending request from senderID to receiverID, if there
+// is none yet. It reports whether the request is new.
+func (repo *MessageRequestRepository) RecordRequest(senderID, receiverID int) (bool, error) {
+	result, err := repo.DB.Exec(`INSERT OR IGNORE INTO message_requests (sender_id, receiver_id) VALUES (?, ?)`, senderID, receiverID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// AcceptBetween accepts any request between the two users, in either
+// direction. A message that went through without a request, such as a reply
+// or one between followers, settles the conversation.
+func (repo *MessageRequestRepository) AcceptBetween(userA, userB int) error {
+	_, err := repo.DB.Exec(`
+		UPDATE message_requests SET status = 'accepted', responded_at = ?
+		WHERE status != 'accepted'
+			AND ((sender_id = ? AND receiver_id = ?) OR (sender_id = ? AND receiver_id = ?))`,
+		time.Now().UTC(), userA, userB, userB, userA)
+	return err
+}
+
+// Respond accepts or declines the request senderID sent to receiverID. It
+// returns sql.ErrNoRows when there is no such request to answer.
+func (repo *MessageRequestRepository) Respond(receiverID, senderID int, accept bool) error {
+	status, from := "declined", "'pending'"
+	if accept {
+		status, from = "accepted", "'pending', 'declined'"
+	}
+	result, err := repo.DB.Exec(`
+		UPDATE message_requests SET status = ?, responded_at = ?
+		WHERE sender_id = ? AND receiver_id = ? AND status IN (`+from+`)`,
+		status, time.Now().UTC(), senderID, receiverID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PendingSenders returns who has a pending request to receiverID.
+func (repo *MessageRequestRepository) PendingSenders(receiverID int) (map[int]bool, error) {
+	rows, err := repo.DB.Query(`SELECT sender_id FROM message_requests WHERE receiver_id = ? AND status = 'pending'`, receiverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	senders := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		senders[id] = true
+	}
+	return senders, rows.Err()
+}
+
+// GetRequests lists the pending requests userID received, latest first, in
+// the shape of the recent chats: the sender, the last message as a preview
+// and in UnreadCount how many messages they sent.
+func (repo *MessageRequestRepository) GetRequests(userID int) ([]models.ChatSummary, error) {
+	rows, err := repo.DB.Query(`
+		SELECT u.id, u.nickname, u.first_name, u.last_name,
+			m.id, m.sender_id, m.receiver_id, m.content, m.sent_at,
+			(SELECT COUNT(*) FROM messages x WHERE x.sender_id = u.id AND x.receiver_id = ? AND x.hidden = 0)
+		FROM message_requests r
+		JOIN users u ON u.id = r.sender_id
+		JOIN messages m ON m.id = (
+			SELECT MAX(id) FROM messages WHERE sender_id = r.sender_id AND receiver_id = r.receiver_id AND hidden = 0)
+		WHERE r.receiver_id = ? AND r.status = 'pending'
+		ORDER BY m.id DESC`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []models.ChatSummary{}
+	for rows.Next() {
+		var request models.ChatSummary
+		last := &request.LastMessage
+		err := rows.Scan(&request.ID, &request.Nickname, &request.FirstName, &request.LastName,
+			&last.ID, &last.SenderID, &last.ReceiverID, &last.Content, &last.SentAt, &request.UnreadCount)
+		if err != nil {
+			return nil, err
+		}
+		last.Content = preview(last.Content)
+		request.LastMessageTime = last.SentAt
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
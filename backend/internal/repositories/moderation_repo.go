@@ -0,0 +1,294 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"social-network/internal/models"
+)
+
+// ErrNotModeratable is returned when content cannot be hidden or deleted,
+// such as a user.
+var ErrNotModeratable = errors.New("target cannot be hidden or deleted")
+
+// ModerationRepository handles reports, moderation actions and their audit trail
+type ModerationRepository struct {
+	DB *sql.DB
+}
+
+// NewModerationRepository creates a new instance of ModerationRepository
+func NewModerationRepository(db *sql.DB) *ModerationRepository {
+	return &ModerationRepository{DB: db}
+}
+
+// moderatedTables maps a reportable content type to its table.
+var moderatedTables = map[string]string{
+	models.TargetPost:         "posts",
+	models.TargetComment:      "comments",
+	models.TargetGroupPost:    "group_posts",
+	models.TargetGroupComment: "group_comments",
+	models.TargetMessage:      "messages",
+	models.TargetGroupMessage: "group_messages",
+}
+
+// IsReportableType reports whether targetType can be reported.
+func IsReportableType(targetType string) bool {
+	_, ok := moderatedTables[targetType]
+	return ok || targetType == models.TargetUser
+}
+
+// GetTargetUser returns the author of the reported content, or the user itself for user reports.
+func (repo *ModerationRepository) GetTargetUser(targetType string, targetID int) (int, error) {
+	if targetType == models.TargetUser {
+		var userID int
+		err := repo.DB.QueryRow(`SELECT id FROM users WHERE id = ?`, targetID).Scan(&userID)
+		return userID, err
+	}
+	return NewReactionRepository(repo.DB).GetTargetOwner(targetType, targetID)
+}
+
+// CreateReport files a report. Reporting the same target again reopens the earlier report.
+func (repo *ModerationRepository) CreateReport(report *models.Report) error {
+	_, err := repo.DB.Exec(`
+		INSERT INTO reports (reporter_id, target_type, target_id, target_user_id, reason)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(reporter_id, target_type, target_id)
+		DO UPDATE SET reason = excluded.reason, status = 'open', created_at = CURRENT_TIMESTAMP,
+			resolved_by = NULL, resolved_at = NULL`,
+		report.ReporterID, report.TargetType, report.TargetID, report.TargetUserID, report.Reason)
+	return err
+}
+
+// GetReports returns the reports with the given status, oldest first, with a
+// preview of the reported content.
+func (repo *ModerationRepository) GetReports(status string) ([]models.Report, error) {
+	rows, err := repo.DB.Query(`
+		SELECT r.id, r.reporter_id, ru.nickname, r.target_type, r.target_id, r.target_user_id,
+			COALESCE(tu.nickname, ''), r.reason, r.status, r.created_at,
+			(SELECT COUNT(*) FROM reports o WHERE o.target_type = r.target_type AND o.target_id = r.target_id AND o.status = 'open')
+		FROM reports r
+		JOIN users ru ON ru.id = r.reporter_id
+		LEFT JOIN users tu ON tu.id = r.target_user_id
+		WHERE r.status = ?
+		ORDER BY r.created_at ASC`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.Report
+	for rows.Next() {
+		var report models.Report
+		err := rows.Scan(&report.ID, &report.ReporterID, &report.Reporter, &report.TargetType, &report.TargetID,
+			&report.TargetUserID, &report.TargetUser, &report.Reason, &report.Status, &report.CreatedAt, &report.ReportCount)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range reports {
+		reports[i].Preview = repo.getPreview(reports[i].TargetType, reports[i].TargetID)
+	}
+	return reports, nil
+}
+
+// GetReport returns a single report.
+func (repo *ModerationRepository) GetReport(reportID int) (*models.Report, error) {
+	var report models.Report
+	err := repo.DB.QueryRow(`
+		SELECT id, reporter_id, target_type, target_id, target_user_id, reason, status, created_at
+		FROM reports WHERE id = ?`, reportID).
+		Scan(&report.ID, &report.ReporterID, &report.TargetType, &report.TargetID, &report.TargetUserID,
+			&report.Reason, &report.Status, &report.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (repo *ModerationRepository) getPreview(targetType string, targetID int) string {
+	var preview string
+	query := `SELECT nickname FROM users WHERE id = ?`
+	if table, ok := moderatedTables[targetType]; ok {
+		query = fmt.Sprintf(`SELECT content FROM %s WHERE id = ?`, table)
+	}
+	if err := repo.DB.QueryRow(query, targetID).Scan(&preview); err != nil {
+		return "[deleted]"
+	}
+	return preview
+}
+
+// CloseReports sets every open report on the target to status ("resolved" or "dismissed").
+func (repo *ModerationRepository) CloseReports(targetType string, targetID, moderatorID int, status string) error {
+	_, err := repo.DB.Exec(`
+		UPDATE reports SET status = ?, resolved_by = ?, resolved_at = ?
+		WHERE target_type = ? AND target_id = ? AND status = 'open'`,
+		status, moderatorID, time.Now().UTC(), targetType, targetID)
+	return err
+}
+
+// HideTarget hides reported content from every listing without deleting it.
+// It returns sql.ErrNoRows when there is no such content.
+func (repo *ModerationRepository) HideTarget(targetType string, targetID int) error {
+	table, ok := moderatedTables[targetType]
+	if !ok {
+		return ErrNotModeratable
+	}
+	result, err := repo.DB.Exec(fmt.Sprintf(`UPDATE %s SET hidden = 1 WHERE id = ?`, table), targetID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// postContent names the comments table of each type of post, with its post
+// column and the reaction type of its comments
+type postContent struct {
+	comments, postColumn, commentType string
+}
+
+var postContents = map[string]postContent{
+	models.TargetPost:      {"comments", "post_id", models.TargetComment},
+	models.TargetGroupPost: {"group_comments", "g_post_id", models.TargetGroupComment},
+}
+
+// DeleteTarget removes reported content with everything that hangs off it:
+// the replies of a comment, the comments and poll of a post, the
+// attachments of a message, and the reactions on all of them. It returns
+// sql.ErrNoRows when there is no such content.
+func (repo *ModerationRepository) DeleteTarget(targetType string, targetID int) error {
+	table, ok := moderatedTables[targetType]
+	if !ok {
+		return ErrNotModeratable
+	}
+	var exists bool
+	if err := repo.DB.QueryRow(fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE id = ?)`, table), targetID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	switch targetType {
+	case models.TargetComment, models.TargetGroupComment:
+		return deleteThread(repo.DB, table, targetType, targetID)
+	case models.TargetPost, models.TargetGroupPost:
+		return repo.deletePost(table, targetType, targetID)
+	}
+
+	column := "message_id"
+	if targetType == models.TargetGroupMessage {
+		column = "group_message_id"
+	}
+	if err := deleteAttachments(repo.DB, column, targetID); err != nil {
+		return err
+	}
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM reactions WHERE target_type = ? AND target_id = ?`, targetType, targetID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, table), targetID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deletePost deletes a post or group post with its comments, poll and
+// reactions in one transaction.
+func (repo *ModerationRepository) deletePost(table, targetType string, postID int) error {
+	content := postContents[targetType]
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	comments := `SELECT id FROM ` + content.comments + ` WHERE ` + content.postColumn + ` = ?`
+	poll := `SELECT id FROM polls WHERE target_type = ? AND target_id = ?`
+	deletes := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM reactions WHERE target_type = ? AND target_id IN (` + comments + `)`, []any{content.commentType, postID}},
+		{`DELETE FROM ` + content.comments + ` WHERE ` + content.postColumn + ` = ?`, []any{postID}},
+		{`DELETE FROM poll_votes WHERE poll_id IN (` + poll + `)`, []any{targetType, postID}},
+		{`DELETE FROM poll_options WHERE poll_id IN (` + poll + `)`, []any{targetType, postID}},
+		{`DELETE FROM polls WHERE target_type = ? AND target_id = ?`, []any{targetType, postID}},
+		{`DELETE FROM reactions WHERE target_type = ? AND target_id = ?`, []any{targetType, postID}},
+		{`DELETE FROM ` + table + ` WHERE id = ?`, []any{postID}},
+	}
+	for _, d := range deletes {
+		if _, err := tx.Exec(d.query, d.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SuspendUser suspends the account until the given time and logs it out everywhere.
+func (repo *ModerationRepository) SuspendUser(userID int, until time.Time) error {
+	if _, err := repo.DB.Exec(`UPDATE users SET suspended_until = ? WHERE id = ?`, until.UTC(), userID); err != nil {
+		return err
+	}
+	_, err := repo.DB.Exec(`DELETE FROM sessions WHERE userID = ?`, userID)
+	return err
+}
+
+// LogAction appends an entry to the moderation audit trail.
+func (repo *ModerationRepository) LogAction(action *models.ModerationAction) error {
+	_, err := repo.DB.Exec(`
+		INSERT INTO moderation_actions (moderator_id, action, target_type, target_id, target_user_id, report_id, note, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		action.ModeratorID, action.Action, action.TargetType, action.TargetID, action.TargetUserID,
+		action.ReportID, action.Note, time.Now().UTC())
+	return err
+}
+
+// GetActions returns the most recent entries of the audit trail.
+func (repo *ModerationRepository) GetActions(limit int) ([]models.ModerationAction, error) {
+	rows, err := repo.DB.Query(`
+		SELECT a.id, a.moderator_id, COALESCE(u.nickname, ''), a.action, a.target_type, a.target_id,
+			a.target_user_id, a.report_id, a.note, a.created_at
+		FROM moderation_actions a
+		LEFT JOIN users u ON u.id = a.moderator_id
+		ORDER BY a.id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []models.ModerationAction
+	for rows.Next() {
+		var action models.ModerationAction
+		var targetUserID, reportID sql.NullInt64
+		err := rows.Scan(&action.ID, &action.ModeratorID, &action.Moderator, &action.Action, &action.TargetType,
+			&action.TargetID, &targetUserID, &reportID, &action.Note, &action.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if targetUserID.Valid {
+			id := int(targetUserID.Int64)
+			action.TargetUserID = &id
+		}
+		if reportID.Valid {
+			id := int(reportID.Int64)
+			action.ReportID = &id
+		}
+		actions = append(actions, action)
+	}
+	return actions, rows.Err()
+}
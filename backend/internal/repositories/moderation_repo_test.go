@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"social-network/internal/models"
+)
+
+func TestDeleteTarget(t *testing.T) {
+	db, dir := newTestDB(t)
+	seed := []string{
+		`INSERT INTO posts (id, user_id, content, privacy) VALUES (1, 1, 'reported', 'public'), (2, 1, 'kept', 'public')`,
+		// 1 and its reply 2 on post 1, 3 with its reply 4 and 5 below that on post 2
+		`INSERT INTO comments (id, post_id, user_id, parent_id, content, username) VALUES
+			(1, 1, 2, NULL, 'c', 'bob'), (2, 1, 1, 1, 'c', 'alice'),
+			(3, 2, 2, NULL, 'c', 'bob'), (4, 2, 1, 3, 'c', 'alice'), (5, 2, 2, 4, 'c', 'bob'), (6, 2, 1, NULL, 'c', 'alice')`,
+		`INSERT INTO reactions (target_type, target_id, user_id, reaction) VALUES
+			('post', 1, 2, 'like'), ('comment', 2, 2, 'like'), ('comment', 5, 1, 'like'), ('comment', 6, 2, 'like'), ('post', 2, 2, 'like')`,
+		`INSERT INTO polls (id, target_type, target_id, creator_id, question) VALUES (1, 'post', 1, 1, 'q'), (2, 'post', 2, 1, 'q')`,
+		`INSERT INTO poll_options (id, poll_id, label, position) VALUES (1, 1, 'a', 0), (2, 2, 'a', 0)`,
+		`INSERT INTO poll_votes (poll_id, option_id, user_id) VALUES (1, 1, 2), (2, 2, 2)`,
+		`INSERT INTO messages (id, sender_id, receiver_id, content) VALUES (1, 1, 2, 'reported')`,
+		`INSERT INTO reactions (target_type, target_id, user_id, reaction) VALUES ('message', 1, 2, 'like')`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+	file := attach(t, db, dir, "message_id", 1)
+	repo := NewModerationRepository(db)
+
+	if err := repo.DeleteTarget(models.TargetPost, 1); err != nil {
+		t.Fatal(err)
+	}
+	for query, want := range map[string]int{
+		`SELECT COUNT(*) FROM posts`:                                                           1,
+		`SELECT COUNT(*) FROM comments WHERE post_id = 1`:                                      0,
+		`SELECT COUNT(*) FROM polls`:                                                           1,
+		`SELECT COUNT(*) FROM poll_options WHERE poll_id = 1`:                                  0,
+		`SELECT COUNT(*) FROM poll_votes WHERE poll_id = 1`:                                    0,
+		`SELECT COUNT(*) FROM reactions WHERE target_type = 'post'`:                            1,
+		`SELECT COUNT(*) FROM reactions WHERE target_id IN (1, 2) AND target_type = 'comment'`: 0,
+	} {
+		if n := count(t, db, query); n != want {
+			t.Errorf("after deleting post 1, %s = %d, want %d", query, n, want)
+		}
+	}
+
+	if err := repo.DeleteTarget(models.TargetComment, 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM comments`); n != 1 {
+		t.Errorf("%d comments left, want only 6, the thread of 3 went with it", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM reactions WHERE target_type = 'comment'`); n != 1 {
+		t.Errorf("%d comment reactions left, want the one on 6", n)
+	}
+
+	if err := repo.DeleteTarget(models.TargetMessage, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM chat_attachments`) + count(t, db, `SELECT COUNT(*) FROM reactions WHERE target_type = 'message'`); n != 0 {
+		t.Errorf("%d attachments and reactions of the message left", n)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("the attachment file of the message was not removed")
+	}
+
+	if err := repo.DeleteTarget(models.TargetPost, 1); err != sql.ErrNoRows {
+		t.Errorf("deleting a missing post: %v, want sql.ErrNoRows", err)
+	}
+	if err := repo.HideTarget(models.TargetComment, 99); err != sql.ErrNoRows {
+		t.Errorf("hiding a missing comment: %v, want sql.ErrNoRows", err)
+	}
+	if err := repo.DeleteTarget(models.TargetUser, 1); err != ErrNotModeratable {
+		t.Errorf("deleting a user: %v, want ErrNotModeratable", err)
+	}
+}
@@ -0,0 +1,308 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-network/internal/models"
+)
+
+var (
+	ErrPollClosed        = errors.New("poll is closed")
+	ErrInvalidPollOption = errors.New("invalid poll option")
+)
+
+// PollRepository handles polls attached to posts and group posts
+type PollRepository struct {
+	DB *sql.DB
+}
+
+// NewPollRepository creates a new instance of PollRepository
+func NewPollRepository(db *sql.DB) *PollRepository {
+	return &PollRepository{DB: db}
+}
+
+// CreatePoll stores the poll and its options in one transaction and returns the poll id.
+func (repo *PollRepository) CreatePoll(poll *models.Poll, labels []string) (int, error) {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var closesAt any
+	if poll.ClosesAt != nil {
+		closesAt = poll.ClosesAt.UTC()
+	}
+	result, err := tx.Exec(`
+		INSERT INTO polls (target_type, target_id, creator_id, question, multiple_choice, anonymous, closes_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		poll.TargetType, poll.TargetID, poll.CreatorID, poll.Question, poll.MultipleChoice, poll.Anonymous, closesAt, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	pollID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, label := range labels {
+		_, err := tx.Exec(`INSERT INTO poll_options (poll_id, label, position) VALUES (?, ?, ?)`, pollID, label, i)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int(pollID), tx.Commit()
+}
+
+// pollColumns are the columns scanned by scanPoll.
+const pollColumns = `id, target_type, target_id, creator_id, question, multiple_choice, anonymous, closes_at, closed, created_at`
+
+func scanPoll(row rowScanner) (*models.Poll, error) {
+	var poll models.Poll
+	var closesAt sql.NullTime
+	err := row.Scan(&poll.ID, &poll.TargetType, &poll.TargetID, &poll.CreatorID, &poll.Question,
+		&poll.MultipleChoice, &poll.Anonymous, &closesAt, &poll.Closed, &poll.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if closesAt.Valid {
+		poll.ClosesAt = &closesAt.Time
+	}
+	return &poll, nil
+}
+
+// GetPoll returns a poll with its results as seen by viewerID.
+func (repo *PollRepository) GetPoll(pollID, viewerID int) (*models.Poll, error) {
+	poll, err := scanPoll(repo.DB.QueryRow(`SELECT `+pollColumns+` FROM polls WHERE id = ?`, pollID))
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.loadResults([]*models.Poll{poll}, viewerID); err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// GetPollByTarget returns the poll attached to a post or group post, or nil if it has none.
+func (repo *PollRepository) GetPollByTarget(targetType string, targetID, viewerID int) (*models.Poll, error) {
+	polls, err := repo.GetPollsByTargets(targetType, []int{targetID}, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return polls[targetID], nil
+}
+
+// GetPollsByTargets returns the polls attached to many posts or group posts
+// of one type, by target id, with a fixed number of queries. Targets without
+// a poll are left out.
+func (repo *PollRepository) GetPollsByTargets(targetType string, targetIDs []int, viewerID int) (map[int]*models.Poll, error) {
+	polls := make(map[int]*models.Poll)
+	if len(targetIDs) == 0 {
+		return polls, nil
+	}
+	args := []any{targetType}
+	for _, id := range targetIDs {
+		args = append(args, id)
+	}
+	rows, err := repo.DB.Query(`SELECT `+pollColumns+` FROM polls
+		WHERE target_type = ? AND target_id IN (`+placeholders(len(targetIDs))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*models.Poll
+	for rows.Next() {
+		poll, err := scanPoll(rows)
+		if err != nil {
+			return nil, err
+		}
+		polls[poll.TargetID] = poll
+		list = append(list, poll)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return polls, repo.loadResults(list, viewerID)
+}
+
+// loadResults fills the options, vote counts and viewer's votes of polls, and
+// the voters of those that are not anonymous.
+func (repo *PollRepository) loadResults(polls []*models.Poll, viewerID int) error {
+	if len(polls) == 0 {
+		return nil
+	}
+	byID := make(map[int]*models.Poll, len(polls))
+	ids := make([]any, 0, len(polls))
+	for _, poll := range polls {
+		poll.Options = nil
+		poll.TotalVotes = 0
+		poll.ViewerVotes = []int{}
+		byID[poll.ID] = poll
+		ids = append(ids, poll.ID)
+	}
+	in := `(` + placeholders(len(ids)) + `)`
+
+	rows, err := repo.DB.Query(`
+		SELECT o.poll_id, o.id, o.label, COUNT(v.user_id)
+		FROM poll_options o
+		LEFT JOIN poll_votes v ON v.option_id = o.id
+		WHERE o.poll_id IN `+in+`
+		GROUP BY o.id
+		ORDER BY o.poll_id, o.position ASC`, ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pollID int
+		var option models.PollOption
+		if err := rows.Scan(&pollID, &option.ID, &option.Label, &option.Votes); err != nil {
+			return err
+		}
+		byID[pollID].Options = append(byID[pollID].Options, option)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	totalRows, err := repo.DB.Query(`
+		SELECT poll_id, COUNT(DISTINCT user_id) FROM poll_votes
+		WHERE poll_id IN `+in+` GROUP BY poll_id`, ids...)
+	if err != nil {
+		return err
+	}
+	defer totalRows.Close()
+	for totalRows.Next() {
+		var pollID, total int
+		if err := totalRows.Scan(&pollID, &total); err != nil {
+			return err
+		}
+		byID[pollID].TotalVotes = total
+	}
+	if err := totalRows.Err(); err != nil {
+		return err
+	}
+
+	voteRows, err := repo.DB.Query(`
+		SELECT poll_id, option_id FROM poll_votes
+		WHERE user_id = ? AND poll_id IN `+in, append([]any{viewerID}, ids...)...)
+	if err != nil {
+		return err
+	}
+	defer voteRows.Close()
+	for voteRows.Next() {
+		var pollID, optionID int
+		if err := voteRows.Scan(&pollID, &optionID); err != nil {
+			return err
+		}
+		byID[pollID].ViewerVotes = append(byID[pollID].ViewerVotes, optionID)
+	}
+	if err := voteRows.Err(); err != nil {
+		return err
+	}
+
+	options := make(map[int]*models.PollOption)
+	for _, poll := range polls {
+		for i := range poll.Options {
+			options[poll.Options[i].ID] = &poll.Options[i]
+		}
+	}
+	voterRows, err := repo.DB.Query(`
+		SELECT v.option_id, u.nickname FROM poll_votes v
+		JOIN polls p ON p.id = v.poll_id
+		JOIN users u ON u.id = v.user_id
+		WHERE p.anonymous = 0 AND v.poll_id IN `+in+`
+		ORDER BY v.created_at ASC`, ids...)
+	if err != nil {
+		return err
+	}
+	defer voterRows.Close()
+	for voterRows.Next() {
+		var optionID int
+		var nickname string
+		if err := voterRows.Scan(&optionID, &nickname); err != nil {
+			return err
+		}
+		if option := options[optionID]; option != nil {
+			option.Voters = append(option.Voters, nickname)
+		}
+	}
+	return voterRows.Err()
+}
+
+// Vote replaces the user's previous choices on the poll with optionIDs.
+// An empty optionIDs simply retracts the vote.
+func (repo *PollRepository) Vote(pollID, userID int, optionIDs []int) error {
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var multipleChoice, closed bool
+	var closesAt sql.NullTime
+	err = tx.QueryRow(`SELECT multiple_choice, closed, closes_at FROM polls WHERE id = ?`, pollID).
+		Scan(&multipleChoice, &closed, &closesAt)
+	if err != nil {
+		return err
+	}
+	if closed || (closesAt.Valid && !closesAt.Time.After(time.Now())) {
+		return ErrPollClosed
+	}
+	if !multipleChoice && len(optionIDs) > 1 {
+		return ErrInvalidPollOption
+	}
+
+	if _, err := tx.Exec(`DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?`, pollID, userID); err != nil {
+		return err
+	}
+	for _, optionID := range optionIDs {
+		var belongs bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM poll_options WHERE id = ? AND poll_id = ?)`, optionID, pollID).Scan(&belongs)
+		if err != nil {
+			return err
+		}
+		if !belongs {
+			return ErrInvalidPollOption
+		}
+		_, err = tx.Exec(`INSERT OR IGNORE INTO poll_votes (poll_id, option_id, user_id) VALUES (?, ?, ?)`, pollID, optionID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClosePoll marks the poll as closed and reports whether it was still open.
+func (repo *PollRepository) ClosePoll(pollID int) (bool, error) {
+	result, err := repo.DB.Exec(`UPDATE polls SET closed = 1 WHERE id = ? AND closed = 0`, pollID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetExpiredPollIDs returns open polls whose close time has passed.
+func (repo *PollRepository) GetExpiredPollIDs(now time.Time) ([]int, error) {
+	rows, err := repo.DB.Query(`
+		SELECT id FROM polls
+		WHERE closed = 0 AND closes_at IS NOT NULL AND closes_at <= ?`, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"social-network/internal/models"
+)
+
+func TestVote(t *testing.T) {
+	db, _ := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO posts (id, user_id, content, privacy) VALUES (1, 1, 'p', 'public'), (2, 1, 'q', 'public')`); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewPollRepository(db)
+	single, err := repo.CreatePoll(&models.Poll{TargetType: models.TargetPost, TargetID: 1, CreatorID: 1, Question: "one?"}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiple, err := repo.CreatePoll(&models.Poll{TargetType: models.TargetPost, TargetID: 2, CreatorID: 1, Question: "many?",
+		MultipleChoice: true, Anonymous: true}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := func(pollID int) []int {
+		poll, err := repo.GetPoll(pollID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []int{poll.Options[0].ID, poll.Options[1].ID}
+	}
+	a, b := options(single)[0], options(single)[1]
+	otherA, otherB := options(multiple)[0], options(multiple)[1]
+
+	if err := repo.Vote(single, 2, []int{a, b}); err != ErrInvalidPollOption {
+		t.Errorf("two choices on a single choice poll: %v, want ErrInvalidPollOption", err)
+	}
+	if err := repo.Vote(single, 2, []int{otherA}); err != ErrInvalidPollOption {
+		t.Errorf("an option of another poll: %v, want ErrInvalidPollOption", err)
+	}
+	if err := repo.Vote(single, 2, []int{a}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Vote(single, 2, []int{b}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Vote(multiple, 2, []int{otherA, otherB}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Vote(multiple, 1, []int{otherB}); err != nil {
+		t.Fatal(err)
+	}
+
+	poll, err := repo.GetPoll(single, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.TotalVotes != 1 || poll.Options[0].Votes != 0 || !reflect.DeepEqual(poll.ViewerVotes, []int{b}) ||
+		!reflect.DeepEqual(poll.Options[1].Voters, []string{"bob"}) {
+		t.Errorf("voting again did not replace the vote: %+v", poll)
+	}
+	poll, err = repo.GetPoll(multiple, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.TotalVotes != 2 || poll.Options[1].Votes != 2 || !reflect.DeepEqual(poll.ViewerVotes, []int{otherB}) {
+		t.Errorf("multiple choice results: %+v", poll)
+	}
+	for _, option := range poll.Options {
+		if option.Voters != nil {
+			t.Errorf("the voters of an anonymous poll are shown: %v", option.Voters)
+		}
+	}
+
+	if err := repo.Vote(single, 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	if poll, _ := repo.GetPoll(single, 2); poll.TotalVotes != 0 {
+		t.Error("an empty vote did not retract the vote")
+	}
+}
+
+func TestClosePoll(t *testing.T) {
+	db, _ := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO posts (id, user_id, content, privacy) VALUES (1, 1, 'p', 'public'), (2, 1, 'q', 'public')`); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewPollRepository(db)
+	manual, err := repo.CreatePoll(&models.Poll{TargetType: models.TargetPost, TargetID: 1, CreatorID: 1, Question: "?"}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closesAt := time.Now().Add(time.Hour)
+	timed, err := repo.CreatePoll(&models.Poll{TargetType: models.TargetPost, TargetID: 2, CreatorID: 1, Question: "?", ClosesAt: &closesAt}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, err := repo.ClosePoll(manual); err != nil || !changed {
+		t.Fatalf("closing an open poll: %v, %v, want it changed", changed, err)
+	}
+	if changed, err := repo.ClosePoll(manual); err != nil || changed {
+		t.Fatalf("closing a closed poll: %v, %v, want it unchanged", changed, err)
+	}
+	poll, err := repo.GetPoll(manual, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Vote(manual, 2, []int{poll.Options[0].ID}); err != ErrPollClosed {
+		t.Errorf("voting on a closed poll: %v, want ErrPollClosed", err)
+	}
+
+	if ids, err := repo.GetExpiredPollIDs(time.Now()); err != nil || len(ids) != 0 {
+		t.Fatalf("expired polls before the close time: %v, %v, want none", ids, err)
+	}
+	ids, err := repo.GetExpiredPollIDs(closesAt.Add(time.Minute))
+	if err != nil || !reflect.DeepEqual(ids, []int{timed}) {
+		t.Fatalf("expired polls after the close time: %v, %v, want [%d]", ids, err, timed)
+	}
+	// a poll past its close time takes no votes, even before the closer runs
+	if _, err := db.Exec(`UPDATE polls SET closes_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Minute), timed); err != nil {
+		t.Fatal(err)
+	}
+	poll, err = repo.GetPoll(timed, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Vote(timed, 2, []int{poll.Options[0].ID}); err != ErrPollClosed {
+		t.Errorf("voting past the close time: %v, want ErrPollClosed", err)
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"log"
 	"time"
 
-	"social-network/internal/config"
 	"social-network/internal/models"
+	"social-network/internal/policy"
 )
 
 type PostRepository struct {
@@ -29,51 +29,44 @@ func (r *PostRepository) CreatePost(post *models.Post) (*models.Post, error) {
 	return &newPost, nil
 }
 
-func GetLikeCount(postID int) (int, error) {
-	db := config.GetDB()
-	var likeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE post_id = ? AND is_like = true", postID).Scan(&likeCount)
+// loadReactions fills the reaction breakdown of the posts along with the
+// legacy like/dislike counters the feed still renders, and their polls, with
+// one batch of queries for the whole listing.
+func (repo *PostRepository) loadReactions(posts []models.Post, viewerID int) error {
+	ids := make([]int, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+	summaries, err := NewReactionRepository(repo.DB).GetReactionSummaries(models.TargetPost, ids, viewerID)
 	if err != nil {
-		log.Println("error counting likes", err)
-		return 0, err
+		return err
 	}
-	return likeCount, nil
-}
-
-func GetDislikeCount(postID int) (int, error) {
-	db := config.GetDB()
-	var dislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE post_id = ? AND is_like = false", postID).Scan(&dislikeCount)
+	polls, err := NewPollRepository(repo.DB).GetPollsByTargets(models.TargetPost, ids, viewerID)
 	if err != nil {
-		log.Println("error counting dislikes", err)
-		return 0, err
+		return err
 	}
-	return dislikeCount, nil
+	for i := range posts {
+		posts[i].Reactions = summaries[posts[i].ID]
+		posts[i].LikeCount = posts[i].Reactions.Counts["like"]
+		posts[i].DisLikeCount = posts[i].Reactions.Counts["dislike"]
+		posts[i].Poll = polls[posts[i].ID]
+	}
+	return nil
 }
 
 func (repo *PostRepository) GetFeedPosts(userID int) ([]models.Post, error) {
 	var posts []models.Post
-	/*✅ This will now:
-	  ✔ Show public posts from non-private users
-	  ✔ Show public posts from private users only if followed
-	  ✔ Show follower-only posts to accepted followers
-	  ✔ Show selected posts only to the users selected by the creator
-	  ✔ Show the creator's own posts in their feed*/
+	// the feed shows every post the user may see (see policy.VisiblePosts)
+	// except those of the users they muted
+	visible, visibleArgs := policy.VisiblePosts("p", userID)
+	notMuted, notMutedArgs := policy.NotMuted("p.user_id", userID)
 	query := `
 		SELECT p.id, p.user_id, p.content, p.image, p.username, p.privacy, p.created_at 
 		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN followers f ON f.follower_id = ? AND f.following_id = p.user_id AND f.status = 'accepted'
-		LEFT JOIN posts_visibility pv ON pv.post_creator = p.user_id AND pv.user_id = ?
-		WHERE 
-			(p.privacy = 'public' AND u.is_private = 0)
-			OR (p.privacy = 'public' AND u.is_private = 1 AND f.follower_id IS NOT NULL)
-			OR (p.privacy = 'followers' AND f.follower_id IS NOT NULL)
-			OR (p.privacy = 'selected' AND pv.user_id IS NOT NULL)
-			OR (p.user_id = ?)
+		WHERE ` + visible + ` AND ` + notMuted + `
 		ORDER BY p.created_at DESC`
 
-	rows, err := repo.DB.Query(query, userID, userID, userID)
+	rows, err := repo.DB.Query(query, append(visibleArgs, notMutedArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -86,17 +79,6 @@ func (repo *PostRepository) GetFeedPosts(userID int) ([]models.Post, error) {
 			return nil, err
 		}
 
-		likeCount, err := GetLikeCount(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		dis, err := GetDislikeCount(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.LikeCount = likeCount
-		post.DisLikeCount = dis
-
 		posts = append(posts, post)
 	}
 
@@ -104,34 +86,16 @@ func (repo *PostRepository) GetFeedPosts(userID int) ([]models.Post, error) {
 		return nil, err
 	}
 
-	return posts, nil
+	return posts, repo.loadReactions(posts, userID)
 }
 
 func (repo *PostRepository) GetUserPosts(userID int, viewerID int) ([]models.Post, error) {
-	// rows, err := repo.DB.Query(`
-	// 	SELECT *
-	// 	FROM posts 
-	// 	WHERE user_id = ? 
-	// 	AND (privacy = 'public' OR 
-	// 	    (privacy = 'followers' AND user_id IN 
-	// 	        (SELECT following_id FROM followers WHERE follower_id = ? AND status = 'accepted')) 
-	// 	    OR user_id = ?
-	// 		OR ) 
-	// 	ORDER BY created_at DESC`, userID, viewerID, viewerID)
+	visible, visibleArgs := policy.VisiblePosts("p", viewerID)
 	rows, err := repo.DB.Query(`
-    SELECT * 
+    SELECT p.id, p.user_id, p.content, p.image, p.username, p.privacy, p.created_at
     FROM posts p
-    WHERE 
-        p.user_id = ? 
-        AND ( 
-		(p.privacy = 'public') 
-        OR (p.privacy = 'followers' AND p.user_id IN 
-            (SELECT following_id FROM followers WHERE follower_id = ? AND status = 'accepted'))
-        OR (p.privacy = 'selected' AND EXISTS 
-            (SELECT 1 FROM posts_visibility pv WHERE post_creator = ? AND pv.user_id = ?)) 
-		OR (user_id = ? )
-		)
-    ORDER BY p.created_at DESC`, userID, viewerID, userID, viewerID , viewerID)
+    WHERE p.user_id = ? AND `+visible+`
+    ORDER BY p.created_at DESC`, append([]any{userID}, visibleArgs...)...)
 	if err != nil {
 		log.Println("Error fetching posts:", err)
 		return nil, err
@@ -146,19 +110,12 @@ func (repo *PostRepository) GetUserPosts(userID int, viewerID int) ([]models.Pos
 			log.Println("Error scanning post:", err)
 			return nil, err
 		}
-		likeCount, err := GetLikeCount(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		dis, err := GetDislikeCount(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.LikeCount = likeCount
-		post.DisLikeCount = dis
 
 		posts = append(posts, post)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return posts, nil
+	return posts, repo.loadReactions(posts, viewerID)
 }
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetUserPostsLoadsReactionsAndPolls(t *testing.T) {
+	db, _ := newTestDB(t)
+	seed := []string{
+		`INSERT INTO posts (id, user_id, username, content, privacy) VALUES (1, 1, 'alice', 'a', 'public'), (2, 1, 'alice', 'b', 'public'), (3, 1, 'alice', 'c', 'public')`,
+		`INSERT INTO reactions (target_type, target_id, user_id, reaction) VALUES
+			('post', 1, 2, 'like'), ('post', 1, 1, 'love'), ('post', 2, 1, 'dislike'), ('group_post', 3, 2, 'like')`,
+		`INSERT INTO polls (id, target_type, target_id, creator_id, question, anonymous) VALUES
+			(1, 'post', 2, 1, 'open?', 0), (2, 'post', 3, 1, 'secret?', 1), (3, 'group_post', 1, 1, 'elsewhere', 0)`,
+		`INSERT INTO poll_options (id, poll_id, label, position) VALUES (1, 1, 'yes', 0), (2, 1, 'no', 1), (3, 2, 'yes', 0)`,
+		`INSERT INTO poll_votes (poll_id, option_id, user_id, created_at) VALUES (1, 1, 2, '2024-01-01'), (1, 2, 1, '2024-01-02'), (2, 3, 2, '2024-01-01')`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+
+	posts, err := NewPostRepository(db).GetUserPosts(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 3 {
+		t.Fatalf("%d posts, want 3", len(posts))
+	}
+	for _, post := range posts {
+		switch post.ID {
+		case 1:
+			if post.LikeCount != 1 || post.Reactions.Total != 2 || post.Reactions.ViewerReaction != "like" || post.Poll != nil {
+				t.Errorf("post 1: %+v", post)
+			}
+		case 2:
+			if post.DisLikeCount != 1 || post.Reactions.ViewerReaction != "" || post.Poll == nil {
+				t.Fatalf("post 2: %+v", post)
+			}
+			poll := post.Poll
+			if poll.TotalVotes != 2 || !reflect.DeepEqual(poll.ViewerVotes, []int{1}) || len(poll.Options) != 2 ||
+				!reflect.DeepEqual(poll.Options[0].Voters, []string{"bob"}) || !reflect.DeepEqual(poll.Options[1].Voters, []string{"alice"}) {
+				t.Errorf("poll of post 2: %+v", poll)
+			}
+		case 3:
+			if post.Reactions.Total != 0 || post.Poll == nil || post.Poll.Question != "secret?" {
+				t.Fatalf("post 3: %+v", post)
+			}
+			if post.Poll.Options[0].Votes != 1 || post.Poll.Options[0].Voters != nil {
+				t.Errorf("anonymous poll of post 3: %+v", post.Poll.Options)
+			}
+		}
+	}
+}
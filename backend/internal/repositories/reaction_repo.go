@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+
+	"social-network/internal/models"
+)
+
+// ReactionRepository handles reactions for every reactable target
+// (posts, group posts, comments and chat messages).
+type ReactionRepository struct {
+	DB *sql.DB
+}
+
+// NewReactionRepository creates a new instance of ReactionRepository
+func NewReactionRepository(db *sql.DB) *ReactionRepository {
+	return &ReactionRepository{DB: db}
+}
+
+// targetOwnerQueries maps a target type to the query returning its author.
+var targetOwnerQueries = map[string]string{
+	models.TargetPost:         `SELECT user_id FROM posts WHERE id = ?`,
+	models.TargetGroupPost:    `SELECT member_id FROM group_posts WHERE id = ?`,
+	models.TargetComment:      `SELECT user_id FROM comments WHERE id = ?`,
+	models.TargetGroupComment: `SELECT member_id FROM group_comments WHERE id = ?`,
+	models.TargetMessage:      `SELECT sender_id FROM messages WHERE id = ?`,
+	models.TargetGroupMessage: `SELECT sender_id FROM group_messages WHERE id = ?`,
+}
+
+// IsValidTargetType reports whether targetType can be reacted to.
+func IsValidTargetType(targetType string) bool {
+	_, ok := targetOwnerQueries[targetType]
+	return ok
+}
+
+// GetTargetOwner returns the author of the target, or sql.ErrNoRows if it doesn't exist.
+func (repo *ReactionRepository) GetTargetOwner(targetType string, targetID int) (int, error) {
+	query, ok := targetOwnerQueries[targetType]
+	if !ok {
+		return 0, fmt.Errorf("unknown reaction target type %q", targetType)
+	}
+	var ownerID int
+	err := repo.DB.QueryRow(query, targetID).Scan(&ownerID)
+	return ownerID, err
+}
+
+// ToggleReaction applies a reaction the same way the old like buttons did:
+// reacting again with the same reaction removes it, a different one replaces it.
+// It returns the user's reaction after the toggle ("" if removed).
+func (repo *ReactionRepository) ToggleReaction(targetType string, targetID, userID int, reaction string) (string, error) {
+	var existing string
+	err := repo.DB.QueryRow(`
+		SELECT reaction FROM reactions
+		WHERE target_type = ? AND target_id = ? AND user_id = ?`, targetType, targetID, userID).Scan(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	if existing == reaction {
+		_, err = repo.DB.Exec(`
+			DELETE FROM reactions
+			WHERE target_type = ? AND target_id = ? AND user_id = ?`, targetType, targetID, userID)
+		return "", err
+	}
+
+	_, err = repo.DB.Exec(`
+		INSERT INTO reactions (target_type, target_id, user_id, reaction)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(target_type, target_id, user_id)
+		DO UPDATE SET reaction = excluded.reaction, created_at = CURRENT_TIMESTAMP`,
+		targetType, targetID, userID, reaction)
+	if err != nil {
+		return "", err
+	}
+	return reaction, nil
+}
+
+// GetReactionSummary returns the per-reaction counts of a target and the viewer's own reaction.
+func (repo *ReactionRepository) GetReactionSummary(targetType string, targetID, viewerID int) (models.ReactionSummary, error) {
+	summary := models.ReactionSummary{Counts: make(map[string]int)}
+
+	rows, err := repo.DB.Query(`
+		SELECT reaction, COUNT(*)
+		FROM reactions
+		WHERE target_type = ? AND target_id = ?
+		GROUP BY reaction`, targetType, targetID)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reaction string
+		var count int
+		if err := rows.Scan(&reaction, &count); err != nil {
+			return summary, err
+		}
+		summary.Counts[reaction] = count
+		summary.Total += count
+	}
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	err = repo.DB.QueryRow(`
+		SELECT reaction FROM reactions
+		WHERE target_type = ? AND target_id = ? AND user_id = ?`, targetType, targetID, viewerID).Scan(&summary.ViewerReaction)
+	if err != nil && err != sql.ErrNoRows {
+		return summary, err
+	}
+	return summary, nil
+}
+
+// GetReactionSummaries returns the summaries of many targets of one type in a
+// single query, by target id. Every id gets one, empty when nobody reacted.
+func (repo *ReactionRepository) GetReactionSummaries(targetType string, targetIDs []int, viewerID int) (map[int]models.ReactionSummary, error) {
+	summaries := make(map[int]models.ReactionSummary, len(targetIDs))
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+	args := []any{viewerID, targetType}
+	for _, id := range targetIDs {
+		summaries[id] = models.ReactionSummary{Counts: make(map[string]int)}
+		args = append(args, id)
+	}
+
+	rows, err := repo.DB.Query(`
+		SELECT target_id, reaction, COUNT(*), MAX(user_id = ?)
+		FROM reactions
+		WHERE target_type = ? AND target_id IN (`+placeholders(len(targetIDs))+`)
+		GROUP BY target_id, reaction`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var targetID, count int
+		var reaction string
+		var viewers bool
+		if err := rows.Scan(&targetID, &reaction, &count, &viewers); err != nil {
+			return nil, err
+		}
+		summary := summaries[targetID]
+		summary.Counts[reaction] = count
+		summary.Total += count
+		if viewers {
+			summary.ViewerReaction = reaction
+		}
+		summaries[targetID] = summary
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"social-network/internal/models"
+)
+
+var ErrInvalidLifetime = errors.New("message lifetime must be off, 24h, 7d or 90d")
+
+// MessageLifetimes are the disappearing message timers a conversation, a
+// group chat or the site's maximum can be set to. off keeps messages.
+var MessageLifetimes = map[string]time.Duration{
+	"off": 0,
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+// ParseLifetime returns the duration of a lifetime name, see MessageLifetimes.
+func ParseLifetime(name string) (time.Duration, error) {
+	lifetime, ok := MessageLifetimes[name]
+	if !ok {
+		return 0, ErrInvalidLifetime
+	}
+	return lifetime, nil
+}
+
+// LifetimeName is the inverse of ParseLifetime.
+func LifetimeName(lifetime time.Duration) string {
+	for name, d := range MessageLifetimes {
+		if d == lifetime {
+			return name
+		}
+	}
+	return lifetime.String()
+}
+
+// shortestLifetime returns the shorter of two lifetimes, 0 meaning forever.
+func shortestLifetime(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// maxLifetimeSetting is the site_settings row of the longest any chat
+// message is kept, in seconds
+const maxLifetimeSetting = "max_message_lifetime"
+
+// expiredBatch is how many expired messages DeleteExpired removes per query
+const expiredBatch = 500
+
+// expiringMessage is a chat table the reaper deletes from, with the
+// chat_attachments column and the reaction and report target type pointing
+// at its rows
+type expiringMessage struct {
+	table, attachmentColumn, targetType string
+}
+
+var expiringMessages = []expiringMessage{
+	{"messages", "message_id", models.TargetMessage},
+	{"group_messages", "group_message_id", models.TargetGroupMessage},
+}
+
+// RetentionRepository manages the disappearing message timers and deletes
+// the messages whose time is up.
+type RetentionRepository struct {
+	DB *sql.DB
+}
+
+// NewRetentionRepository creates a new instance of RetentionRepository
+func NewRetentionRepository(db *sql.DB) *RetentionRepository {
+	return &RetentionRepository{DB: db}
+}
+
+// MaxLifetime returns the site's maximum message lifetime, 0 for none.
+func (repo *RetentionRepository) MaxLifetime() (time.Duration, error) {
+	var seconds int64
+	err := repo.DB.QueryRow(`SELECT CAST(value AS INTEGER) FROM site_settings WHERE name = ?`, maxLifetimeSetting).Scan(&seconds)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return time.Duration(seconds) * time.Second, err
+}
+
+// SetMaxLifetime sets the site's maximum message lifetime. It applies to
+// messages already sent as well.
+func (repo *RetentionRepository) SetMaxLifetime(adminID int, lifetime time.Duration) error {
+	_, err := repo.DB.Exec(`
+		INSERT INTO site_settings (name, value, updated_by) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			value = excluded.value, updated_by = excluded.updated_by, updated_at = CURRENT_TIMESTAMP`,
+		maxLifetimeSetting, fmt.Sprint(int64(lifetime/time.Second)), adminID)
+	return err
+}
+
+// ConversationRetention returns the timer of the conversation between two users.
+func (repo *RetentionRepository) ConversationRetention(user1, user2 int) (*models.MessageRetention, error) {
+	retention, _, err := repo.conversation(user1, user2)
+	return retention, err
+}
+
+// SetConversationLifetime sets the timer of the conversation between two
+// users. It applies to the messages sent from now on.
+func (repo *RetentionRepository) SetConversationLifetime(setBy, peerID int, lifetime time.Duration) error {
+	user, peer := setBy, peerID
+	if peer < user {
+		user, peer = peer, user
+	}
+	_, err := repo.DB.Exec(`
+		INSERT INTO conversation_retention (user_id, peer_id, lifetime, set_by) VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, peer_id) DO UPDATE SET
+			lifetime = excluded.lifetime, set_by = excluded.set_by, updated_at = CURRENT_TIMESTAMP`,
+		user, peer, int64(lifetime/time.Second), setBy)
+	return err
+}
+
+// GroupRetention returns the timer of a group's chat, all its channels.
+func (repo *RetentionRepository) GroupRetention(groupID int) (*models.MessageRetention, error) {
+	retention, _, err := repo.group(groupID)
+	return retention, err
+}
+
+// SetGroupLifetime sets the timer of a group's chat. It applies to the
+// messages sent from now on.
+func (repo *RetentionRepository) SetGroupLifetime(setBy, groupID int, lifetime time.Duration) error {
+	_, err := repo.DB.Exec(`
+		INSERT INTO group_chat_retention (group_id, lifetime, set_by) VALUES (?, ?, ?)
+		ON CONFLICT (group_id) DO UPDATE SET
+			lifetime = excluded.lifetime, set_by = excluded.set_by, updated_at = CURRENT_TIMESTAMP`,
+		groupID, int64(lifetime/time.Second), setBy)
+	return err
+}
+
+func (repo *RetentionRepository) conversation(user1, user2 int) (*models.MessageRetention, time.Duration, error) {
+	if user2 < user1 {
+		user1, user2 = user2, user1
+	}
+	return repo.retention(`SELECT lifetime, set_by, updated_at FROM conversation_retention WHERE user_id = ? AND peer_id = ?`, user1, user2)
+}
+
+func (repo *RetentionRepository) group(groupID int) (*models.MessageRetention, time.Duration, error) {
+	return repo.retention(`SELECT lifetime, set_by, updated_at FROM group_chat_retention WHERE group_id = ?`, groupID)
+}
+
+// retention reads a timer row, off when there is none, and also returns its
+// effective lifetime.
+func (repo *RetentionRepository) retention(query string, args ...any) (*models.MessageRetention, time.Duration, error) {
+	retention := &models.MessageRetention{}
+	var seconds int64
+	err := repo.DB.QueryRow(query, args...).Scan(&seconds, &retention.SetBy, &retention.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, 0, err
+	}
+	max, err := repo.MaxLifetime()
+	if err != nil {
+		return nil, 0, err
+	}
+	lifetime := time.Duration(seconds) * time.Second
+	effective := shortestLifetime(lifetime, max)
+	retention.Lifetime, retention.MaxLifetime, retention.Effective = LifetimeName(lifetime), LifetimeName(max), LifetimeName(effective)
+	return retention, effective, nil
+}
+
+// expiresAt is the expires_at of a message sent now that lives for
+// lifetime, NULL when it does not expire.
+func expiresAt(lifetime time.Duration) any {
+	if lifetime == 0 {
+		return nil
+	}
+	return time.Now().UTC().Add(lifetime)
+}
+
+// DeleteExpired deletes the direct and group messages whose time is up, or
+// that are older than the site's maximum lifetime, with their attachments,
+// reactions and reports, and returns how many it deleted.
+func (repo *RetentionRepository) DeleteExpired() (int, error) {
+	max, err := repo.MaxLifetime()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, messages := range expiringMessages {
+		n, err := repo.deleteExpired(messages, max)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteExpired deletes the expired messages of one table in batches.
+func (repo *RetentionRepository) deleteExpired(messages expiringMessage, max time.Duration) (int, error) {
+	cond := `expires_at IS NOT NULL AND julianday(expires_at) <= julianday('now')`
+	args := []any{}
+	if max > 0 {
+		cond = `(` + cond + `) OR julianday(sent_at) <= julianday('now', ?)`
+		args = append(args, fmt.Sprintf("-%d seconds", int64(max/time.Second)))
+	}
+
+	deleted := 0
+	for {
+		ids, err := queryIDs(repo.DB, `SELECT id FROM `+messages.table+` WHERE `+cond+` LIMIT ?`, append(args, expiredBatch)...)
+		if err != nil || len(ids) == 0 {
+			return deleted, err
+		}
+		if err := repo.deleteMessages(messages, ids); err != nil {
+			return deleted, err
+		}
+		deleted += len(ids)
+		if len(ids) < expiredBatch {
+			return deleted, nil
+		}
+	}
+}
+
+// deleteMessages deletes messages and what points at them, the attachment
+// files once the rows are gone.
+func (repo *RetentionRepository) deleteMessages(messages expiringMessage, ids []int) error {
+	byMessage, err := loadAttachments(repo.DB, messages.attachmentColumn, ids)
+	if err != nil {
+		return err
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	in := `(` + placeholders(len(ids)) + `)`
+
+	tx, err := repo.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	targetArgs := append([]any{messages.targetType}, args...)
+	deletes := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM chat_attachments WHERE ` + messages.attachmentColumn + ` IN ` + in, args},
+		{`DELETE FROM reactions WHERE target_type = ? AND target_id IN ` + in, targetArgs},
+		{`DELETE FROM reports WHERE target_type = ? AND target_id IN ` + in, targetArgs},
+		{`DELETE FROM ` + messages.table + ` WHERE id IN ` + in, args},
+	}
+	for _, d := range deletes {
+		if _, err := tx.Exec(d.query, d.args...); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, attachments := range byMessage {
+		for _, a := range attachments {
+			removeAttachmentFiles(a)
+		}
+	}
+	return nil
+}
+
+func queryIDs(db *sql.DB, query string, args ...any) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
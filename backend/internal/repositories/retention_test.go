@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+func TestShortestLifetime(t *testing.T) {
+	tests := []struct {
+		a, b, want time.Duration
+	}{
+		{0, 0, 0},
+		{0, day, day},
+		{day, 0, day},
+		{day, 7 * day, day},
+		{90 * day, 7 * day, 7 * day},
+		{7 * day, 7 * day, 7 * day},
+	}
+	for _, tt := range tests {
+		if got := shortestLifetime(tt.a, tt.b); got != tt.want {
+			t.Errorf("shortestLifetime(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLifetimeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+	}{
+		{"off", 0},
+		{"24h", day},
+		{"7d", 7 * day},
+		{"90d", 90 * day},
+	}
+	for _, tt := range tests {
+		if got := LifetimeName(tt.lifetime); got != tt.name {
+			t.Errorf("LifetimeName(%v) = %q, want %q", tt.lifetime, got, tt.name)
+		}
+		if got, err := ParseLifetime(tt.name); err != nil || got != tt.lifetime {
+			t.Errorf("ParseLifetime(%q) = %v, %v, want %v", tt.name, got, err, tt.lifetime)
+		}
+	}
+	if got := LifetimeName(time.Hour); got != "1h0m0s" {
+		t.Errorf("LifetimeName(1h) = %q, want the duration", got)
+	}
+	for _, name := range []string{"", "1d", "30d", "OFF"} {
+		if _, err := ParseLifetime(name); err != ErrInvalidLifetime {
+			t.Errorf("ParseLifetime(%q) error = %v, want ErrInvalidLifetime", name, err)
+		}
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	db, dir := newTestDB(t)
+	past, future := time.Now().UTC().Add(-time.Minute), time.Now().UTC().Add(time.Hour)
+	old := time.Now().UTC().Add(-30 * day)
+
+	// 1 expired, 2 expires later, 3 never expires but is a month old
+	_, err := db.Exec(`INSERT INTO messages (id, sender_id, receiver_id, content, sent_at, expires_at) VALUES
+		(1, 1, 2, 'gone', ?, ?), (2, 1, 2, 'later', ?, ?), (3, 2, 1, 'kept', ?, NULL)`,
+		old, past, old, future, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO group_messages (id, group_id, channel_id, sender_id, content, sent_at, expires_at) VALUES
+		(1, 1, 1, 1, 'gone', ?, ?), (2, 1, 1, 2, 'kept', ?, NULL)`, old, past, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO reactions (target_type, target_id, user_id, reaction) VALUES
+		('message', 1, 2, 'like'), ('message', 3, 1, 'like'), ('group_message', 1, 2, 'like'), ('post', 1, 2, 'like')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO reports (reporter_id, target_type, target_id, target_user_id, reason) VALUES
+		(2, 'group_message', 1, 1, 'spam'), (1, 'group_message', 2, 2, 'spam')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goneFile := attach(t, db, dir, "message_id", 1)
+	keptFile := attach(t, db, dir, "message_id", 3)
+	goneGroupFile := attach(t, db, dir, "group_message_id", 1)
+
+	repo := NewRetentionRepository(db)
+	deleted, err := repo.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted %d messages, want 2", deleted)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM messages WHERE id IN (2, 3)`); n != 2 {
+		t.Errorf("%d of the unexpired direct messages are left, want 2", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM group_messages`); n != 1 {
+		t.Errorf("%d group messages left, want 1", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM chat_attachments`); n != 1 {
+		t.Errorf("%d attachments left, want the one of the kept message", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM reactions`); n != 2 {
+		t.Errorf("%d reactions left, want those on the kept message and the post", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM reports WHERE target_id = 2`); n != 1 || count(t, db, `SELECT COUNT(*) FROM reports`) != 1 {
+		t.Errorf("want only the report on the kept group message left")
+	}
+	for _, path := range []string{goneFile, goneGroupFile} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("attachment file %s was not removed", path)
+		}
+	}
+	if _, err := os.Stat(keptFile); err != nil {
+		t.Errorf("attachment file of a kept message: %v", err)
+	}
+
+	// the site's maximum also applies to the messages already sent
+	if err := repo.SetMaxLifetime(1, 7*day); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err = repo.DeleteExpired()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Errorf("deleted %d messages older than the maximum, want 3", deleted)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM messages`) + count(t, db, `SELECT COUNT(*) FROM group_messages`); n != 0 {
+		t.Errorf("%d messages older than the maximum left", n)
+	}
+	if _, err := os.Stat(keptFile); !os.IsNotExist(err) {
+		t.Errorf("attachment file %s was not removed", keptFile)
+	}
+}
+
+func TestRetentionTimers(t *testing.T) {
+	db, _ := newTestDB(t)
+	repo := NewRetentionRepository(db)
+
+	retention, err := repo.ConversationRetention(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retention.Lifetime != "off" || retention.Effective != "off" {
+		t.Errorf("unset timer = %+v, want off", retention)
+	}
+
+	if err := repo.SetConversationLifetime(2, 1, 90*day); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SetMaxLifetime(1, 7*day); err != nil {
+		t.Fatal(err)
+	}
+	retention, err = repo.ConversationRetention(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retention.Lifetime != "90d" || retention.MaxLifetime != "7d" || retention.Effective != "7d" || retention.SetBy != 2 {
+		t.Errorf("capped timer = %+v, want 90d capped to 7d, set by 2", retention)
+	}
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"social-network/internal/models"
+	"social-network/internal/policy"
+)
+
+// SuggestionRepository ranks users to follow from the social graph
+type SuggestionRepository struct {
+	DB *sql.DB
+}
+
+// NewSuggestionRepository creates a new instance of SuggestionRepository
+func NewSuggestionRepository(db *sql.DB) *SuggestionRepository {
+	return &SuggestionRepository{DB: db}
+}
+
+// GetSuggestions returns a page of users userID may want to follow, best first.
+//
+// Candidates are ranked by mutual follows (people userID follows who follow
+// them), shared groups, shared events and posts from the last 30 days. Users
+// already followed or requested, users with a pending request to userID,
+// dismissed and blocked users are left out, and so are private users with
+// nothing in common with userID.
+func (repo *SuggestionRepository) GetSuggestions(userID, limit, offset int) ([]models.FollowSuggestion, error) {
+	notBlocked, notBlockedArgs := policy.NotBlocked("u.id", userID)
+	args := []any{userID, userID, userID, userID, userID, userID, userID}
+	args = append(args, notBlockedArgs...)
+	args = append(args, limit, offset)
+
+	rows, err := repo.DB.Query(`
+		SELECT * FROM (
+			SELECT `+ProfileColumns("u")+`,
+				(SELECT COUNT(*) FROM followers a
+					JOIN followers b ON b.follower_id = a.following_id AND b.status = 'accepted'
+					WHERE a.follower_id = ? AND a.status = 'accepted' AND b.following_id = u.id) AS mutual_followers,
+				(SELECT COUNT(*) FROM group_members ga
+					JOIN group_members gb ON gb.group_id = ga.group_id AND gb.status = 'approved'
+					WHERE ga.id = ? AND ga.status = 'approved' AND gb.id = u.id) AS shared_groups,
+				(SELECT COUNT(*) FROM group_event_attendees ea
+					JOIN group_event_attendees eb ON eb.event_id = ea.event_id AND eb.status = 'going'
+					WHERE ea.member_id = ? AND ea.status = 'going' AND eb.member_id = u.id) AS shared_events,
+				(SELECT COUNT(*) FROM posts p
+					WHERE p.user_id = u.id AND p.hidden = 0 AND p.created_at >= datetime('now', '-30 days')) AS recent_posts
+			FROM users u
+			WHERE u.id != ?
+				AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = ? AND f.following_id = u.id)
+				AND NOT EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = u.id AND f.following_id = ? AND f.status = 'pending')
+				AND NOT EXISTS (SELECT 1 FROM suggestion_dismissals d WHERE d.user_id = ? AND d.dismissed_id = u.id)
+				AND `+notBlocked+`
+		)
+		WHERE is_private = 0 OR mutual_followers + shared_groups + shared_events > 0
+		ORDER BY 3 * mutual_followers + 2 * shared_groups + 2 * shared_events + MIN(recent_posts, 5) DESC, nickname ASC
+		LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []models.FollowSuggestion{}
+	for rows.Next() {
+		var s models.FollowSuggestion
+		user, err := ScanProfile(rows, &s.MutualFollowers, &s.SharedGroups, &s.SharedEvents, &s.RecentPosts)
+		if err != nil {
+			return nil, err
+		}
+		s.User = *user
+		s.Reason = suggestionReason(s)
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
+// DismissSuggestion stops suggesting dismissedID to userID.
+func (repo *SuggestionRepository) DismissSuggestion(userID, dismissedID int) error {
+	_, err := repo.DB.Exec(`INSERT OR IGNORE INTO suggestion_dismissals (user_id, dismissed_id) VALUES (?, ?)`, userID, dismissedID)
+	return err
+}
+
+// suggestionReason explains a suggestion with its two strongest signals.
+func suggestionReason(s models.FollowSuggestion) string {
+	var reasons []string
+	if s.MutualFollowers > 0 {
+		reasons = append(reasons, plural(s.MutualFollowers, "mutual follower"))
+	}
+	if s.SharedGroups > 0 {
+		reasons = append(reasons, plural(s.SharedGroups, "shared group"))
+	}
+	if s.SharedEvents > 0 {
+		reasons = append(reasons, plural(s.SharedEvents, "shared event"))
+	}
+	switch {
+	case len(reasons) > 0:
+		return strings.Join(reasons[:min(len(reasons), 2)], ", ")
+	case s.RecentPosts > 0:
+		return "Recently active"
+	default:
+		return "New to you"
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
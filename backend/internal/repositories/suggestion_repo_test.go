@@ -0,0 +1,66 @@
+package repositories
+
+import "testing"
+
+func TestGetSuggestions(t *testing.T) {
+	db, _ := newTestDB(t)
+	seed := []string{
+		`INSERT INTO users (id, nickname, email, password, first_name, last_name, date_of_birth, is_private) VALUES
+			(3, 'carol', 'carol@x.io', '-', 'Carol', 'C', '2000-01-01', 0),
+			(4, 'dave', 'dave@x.io', '-', 'Dave', 'D', '2000-01-01', 0),
+			(5, 'erin', 'erin@x.io', '-', 'Erin', 'E', '2000-01-01', 1),
+			(6, 'frank', 'frank@x.io', '-', 'Frank', 'F', '2000-01-01', 1),
+			(7, 'gina', 'gina@x.io', '-', 'Gina', 'G', '2000-01-01', 0),
+			(8, 'hank', 'hank@x.io', '-', 'Hank', 'H', '2000-01-01', 0),
+			(9, 'ivan', 'ivan@x.io', '-', 'Ivan', 'I', '2000-01-01', 0),
+			(10, 'judy', 'judy@x.io', '-', 'Judy', 'J', '2000-01-01', 0)`,
+		// alice follows bob and ivan, who both follow frank
+		`INSERT INTO followers (follower_id, following_id, status) VALUES
+			(1, 2, 'accepted'), (1, 9, 'accepted'), (2, 6, 'accepted'), (9, 6, 'accepted'), (10, 1, 'pending')`,
+		// carol shares the group and an event with alice
+		`INSERT INTO group_members (id, group_id, username, status) VALUES (3, 1, 'carol', 'approved')`,
+		`INSERT INTO group_event_attendees (member_id, group_id, event_id, status) VALUES (1, 1, 1, 'going'), (3, 1, 1, 'going')`,
+		// dave posts a lot, erin too but is private with nothing in common
+		`INSERT INTO posts (user_id, content, privacy) VALUES
+			(4, 'p', 'public'), (4, 'p', 'public'), (4, 'p', 'public'), (4, 'p', 'public'),
+			(4, 'p', 'public'), (4, 'p', 'public'), (4, 'p', 'public'), (5, 'p', 'public')`,
+		`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (1, 7)`,
+		`INSERT INTO suggestion_dismissals (user_id, dismissed_id) VALUES (1, 8)`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+	repo := NewSuggestionRepository(db)
+
+	suggestions, err := repo.GetSuggestions(1, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// frank 3*2, dave min(7, 5), carol 2*1 + 2*1; bob and ivan are followed,
+	// judy asked to follow alice, gina is blocked, hank dismissed and erin private
+	want := []struct{ nickname, reason string }{
+		{"frank", "2 mutual followers"},
+		{"dave", "Recently active"},
+		{"carol", "1 shared group, 1 shared event"},
+	}
+	if len(suggestions) != len(want) {
+		t.Fatalf("%d suggestions %+v, want %d", len(suggestions), suggestions, len(want))
+	}
+	for i, w := range want {
+		if suggestions[i].User.Nickname != w.nickname || suggestions[i].Reason != w.reason {
+			t.Errorf("suggestion %d: %s (%s), want %s (%s)", i, suggestions[i].User.Nickname, suggestions[i].Reason, w.nickname, w.reason)
+		}
+	}
+
+	if page, err := repo.GetSuggestions(1, 1, 1); err != nil || len(page) != 1 || page[0].User.Nickname != "dave" {
+		t.Fatalf("second page of one: %+v, %v, want dave", page, err)
+	}
+	if err := repo.DismissSuggestion(1, 6); err != nil {
+		t.Fatal(err)
+	}
+	if suggestions, err := repo.GetSuggestions(1, 10, 0); err != nil || len(suggestions) != 2 || suggestions[0].User.Nickname != "dave" {
+		t.Fatalf("after dismissing frank: %+v, %v", suggestions, err)
+	}
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"social-network/internal/config"
+)
+
+// newTestDB builds a database from the migrations with two users, alice (1)
+// and bob (2), both members of group 1, and a dir for attachment files.
+func newTestDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := config.ApplyMigrations(db, "../../migrations"); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := []string{
+		`INSERT INTO users (id, nickname, email, password, first_name, last_name, date_of_birth) VALUES
+			(1, 'alice', 'alice@x.io', '-', 'Alice', 'A', '2000-01-01'),
+			(2, 'bob', 'bob@x.io', '-', 'Bob', 'B', '2000-01-01')`,
+		`INSERT INTO groups (id, group_name, creator_id) VALUES (1, 'club', 1)`,
+		`INSERT INTO group_members (id, group_id, username, status) VALUES (1, 1, 'alice', 'approved'), (2, 1, 'bob', 'approved')`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("seeding: %v\n%s", err, query)
+		}
+	}
+	return db, dir
+}
+
+// attach adds an attachment, backed by a file, to a direct (column
+// message_id) or group (group_message_id) message and returns the file.
+func attach(t *testing.T, db *sql.DB, dir, column string, messageID int) string {
+	t.Helper()
+	path := filepath.Join(dir, column+"-"+time.Now().Format("150405.000000000"))
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`INSERT INTO chat_attachments (uploader_id, `+column+`, file_name, mime_type, size, path)
+		VALUES (1, ?, 'x.txt', 'text/plain', 1, ?)`, messageID, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// count runs a COUNT query.
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
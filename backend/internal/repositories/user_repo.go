@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"social-network/internal/models"
+	"social-network/internal/policy"
 )
 
 // UserRepository handles database operations for users
@@ -47,11 +48,14 @@ func (repo *UserRepository) CreateUser(user *models.User) error {
 func (repo *UserRepository) GetUserByEmailOrNickname(identifier string) (*models.User, string, error) {
 	var user models.User
 	var storedPassword string
+	var suspendedUntil sql.NullTime
 
 	err := repo.DB.QueryRow(`
-		SELECT * FROM users WHERE email = ? OR nickname = ?`, identifier, identifier).
+		SELECT id, nickname, email, password, age, gender, first_name, last_name, date_of_birth, is_private, role, suspended_until
+		FROM users WHERE email = ? OR nickname = ?`, identifier, identifier).
 		Scan(&user.ID, &user.Nickname, &user.Email, &storedPassword,
-			&user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Birthdate, &user.IsPrivate)
+			&user.Age, &user.Gender, &user.FirstName, &user.LastName, &user.Birthdate, &user.IsPrivate,
+			&user.Role, &suspendedUntil)
 		// fmt.Println()
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -61,19 +65,36 @@ func (repo *UserRepository) GetUserByEmailOrNickname(identifier string) (*models
 		log.Println("❌ Error querying user:", err)
 		return nil, "", err
 	}
+	if suspendedUntil.Valid {
+		user.SuspendedUntil = &suspendedUntil.Time
+	}
 	fmt.Println("user from helper func", user)
 	return &user, storedPassword, nil
 }
 
+// ProfileColumns lists the users columns read by ScanProfile, alias is the
+// users table alias in the query.
+func ProfileColumns(alias string) string {
+	return fmt.Sprintf(`%[1]s.id, %[1]s.nickname, %[1]s.email, %[1]s.age, %[1]s.gender, %[1]s.first_name, %[1]s.last_name,
+		%[1]s.date_of_birth, %[1]s.is_private, %[1]s.email_visibility, %[1]s.birthdate_visibility,
+		%[1]s.gender_visibility, %[1]s.name_visibility`, alias)
+}
+
+// ScanProfile reads a row selected with ProfileColumns. Extra destinations
+// receive the columns selected after them.
+func ScanProfile(row rowScanner, extra ...any) (*models.User, error) {
+	user := models.User{FieldPrivacy: &models.ProfilePrivacy{}}
+	dest := []any{&user.ID, &user.Nickname, &user.Email, &user.Age, &user.Gender, &user.FirstName, &user.LastName,
+		&user.Birthdate, &user.IsPrivate, &user.FieldPrivacy.Email, &user.FieldPrivacy.Birthdate,
+		&user.FieldPrivacy.Gender, &user.FieldPrivacy.Name}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (repo *UserRepository) GetUserDataById(userID int) (*models.User, error) {
-	var user models.User
-	err := repo.DB.QueryRow(`
-		SELECT id, nickname, email, age, gender, first_name, last_name, date_of_birth , is_private
-		FROM users WHERE id = ? `, userID).
-		Scan(&user.ID, &user.Nickname, &user.Email,
-			&user.Age, &user.Gender, &user.FirstName, &user.LastName,
-			&user.Birthdate, &user.IsPrivate)
-		// fmt.Println()
+	user, err := ScanProfile(repo.DB.QueryRow(`SELECT `+ProfileColumns("u")+` FROM users u WHERE u.id = ?`, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Println("user " + strconv.Itoa(userID) + " doesnt exist")
@@ -82,18 +103,19 @@ func (repo *UserRepository) GetUserDataById(userID int) (*models.User, error) {
 		log.Println("❌ Error querying user:", err)
 		return nil, err
 	}
-	// fmt.Println("user from helper func", user)
-	return &user, nil
+	return user, nil
 }
 
 func (repo *UserRepository) GetUsersNotFollowed(userID int) ([]models.User, error) {
+	notBlocked, notBlockedArgs := policy.NotBlocked("u.id", userID)
 	rows, err := repo.DB.Query(`
-        SELECT id, nickname, first_name, last_name, email, age, gender, date_of_birth, is_private 
-        FROM users 
-        WHERE id NOT IN (
+        SELECT `+ProfileColumns("u")+`
+        FROM users u
+        WHERE u.id NOT IN (
             SELECT following_id FROM followers WHERE follower_id = ?
-        ) AND id != ? 
-        ORDER BY nickname ASC`, userID, userID)
+        ) AND u.id != ? 
+        AND `+notBlocked+`
+        ORDER BY u.nickname ASC`, append([]any{userID, userID}, notBlockedArgs...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -101,13 +123,46 @@ func (repo *UserRepository) GetUsersNotFollowed(userID int) ([]models.User, erro
 
 	var users []models.User
 	for rows.Next() {
-		var user models.User
-		err := rows.Scan(&user.ID, &user.Nickname, &user.FirstName, &user.LastName, &user.Email, &user.Age, &user.Gender, &user.Birthdate, &user.IsPrivate)
+		user, err := ScanProfile(rows)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, user)
+		users = append(users, *user)
 	}
 
 	return users, nil
 }
+
+// UpdateProfilePrivacy stores who may see each profile field.
+func (repo *UserRepository) UpdateProfilePrivacy(userID int, privacy models.ProfilePrivacy) error {
+	_, err := repo.DB.Exec(`
+		UPDATE users SET email_visibility = ?, birthdate_visibility = ?, gender_visibility = ?, name_visibility = ?
+		WHERE id = ?`, privacy.Email, privacy.Birthdate, privacy.Gender, privacy.Name, userID)
+	return err
+}
+
+// PromoteAdmins gives the admin role to the comma separated nicknames,
+// used to bootstrap the first site admins from the SITE_ADMINS env variable.
+func (repo *UserRepository) PromoteAdmins(nicknames string) {
+	for _, nickname := range strings.Split(nicknames, ",") {
+		nickname = strings.TrimSpace(nickname)
+		if nickname == "" {
+			continue
+		}
+		if _, err := repo.DB.Exec(`UPDATE users SET role = ? WHERE nickname = ?`, models.RoleAdmin, nickname); err != nil {
+			log.Printf("❌ Failed to promote %s to admin: %v", nickname, err)
+		}
+	}
+}
+
+// SetRole changes the site role of a user.
+func (repo *UserRepository) SetRole(userID int, role string) error {
+	result, err := repo.DB.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"social-network/internal/pubsub"
+
+	"github.com/gorilla/websocket"
+)
+
+// disconnectTopic is the pub/sub topic on which instances are told to close
+// the sockets of a user
+const disconnectTopic = "disconnect_user"
+
+// ConnectionRegistry knows how to close every socket of a user: the direct
+// and group chat sockets, the notification sockets and the gateway sessions.
+// Once UsePubSub is called, Disconnect reaches the sockets on every instance.
+type ConnectionRegistry struct {
+	mu      sync.Mutex
+	closers map[int]map[int]func() // by user, then by registration
+	lastID  int
+	bus     pubsub.PubSub
+}
+
+// UserConnections is shared by every socket endpoint.
+var UserConnections = &ConnectionRegistry{closers: make(map[int]map[int]func())}
+
+// UsePubSub sends the disconnections through bus from now on, so that the
+// sockets on other instances are closed too.
+func (c *ConnectionRegistry) UsePubSub(bus pubsub.PubSub) error {
+	err := bus.Subscribe(disconnectTopic, func(data []byte) {
+		var message struct {
+			UserID int `json:"user_id"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			log.Println("❌ Invalid disconnection from pub/sub:", err)
+			return
+		}
+		c.closeLocal(message.UserID)
+	})
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.bus = bus
+	c.mu.Unlock()
+	return nil
+}
+
+// Track registers close as the way to end a socket of userID. The returned
+// function forgets it again, to be called once the socket is closed.
+func (c *ConnectionRegistry) Track(userID int, close func()) (untrack func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastID++
+	id := c.lastID
+	if c.closers[userID] == nil {
+		c.closers[userID] = make(map[int]func())
+	}
+	c.closers[userID][id] = close
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.closers[userID], id)
+		if len(c.closers[userID]) == 0 {
+			delete(c.closers, userID)
+		}
+	}
+}
+
+// TrackConn is Track for a plain socket, which is closed with a policy
+// violation frame.
+func (c *ConnectionRegistry) TrackConn(userID int, conn *websocket.Conn) (untrack func()) {
+	return c.Track(userID, func() {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "logged out"), time.Now().Add(writeWait))
+		conn.Close()
+	})
+}
+
+// Disconnect closes every socket of userID, on every instance. The sockets
+// clean up after themselves as they do when the client leaves.
+func (c *ConnectionRegistry) Disconnect(userID int) {
+	c.mu.Lock()
+	bus := c.bus
+	c.mu.Unlock()
+	if bus == nil {
+		c.closeLocal(userID)
+		return
+	}
+	if err := bus.Publish(disconnectTopic, []byte(`{"user_id":`+strconv.Itoa(userID)+`}`)); err != nil {
+		log.Printf("❌ Failed to publish the disconnection of User %d: %v", userID, err)
+		c.closeLocal(userID)
+	}
+}
+
+func (c *ConnectionRegistry) closeLocal(userID int) {
+	c.mu.Lock()
+	closers := make([]func(), 0, len(c.closers[userID]))
+	for _, close := range c.closers[userID] {
+		closers = append(closers, close)
+	}
+	c.mu.Unlock()
+
+	for _, close := range closers {
+		close()
+	}
+	if len(closers) > 0 {
+		log.Printf("⚠️ Closed %d sockets of User %d", len(closers), userID)
+	}
+}
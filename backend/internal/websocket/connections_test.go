@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-network/internal/pubsub"
+	"social-network/internal/websocket/wstest"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestDisconnectClosesEverySocket closes a gateway session and a notification
+// socket of a suspended user, and leaves those of another user open.
+func TestDisconnectClosesEverySocket(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	alice := wstest.Login(t, db, 1, "alice")
+	bob := wstest.Login(t, db, 2, "bob")
+
+	gateway := NewGateway()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", gateway.ServeWs)
+	mux.HandleFunc("/ws/notifications", func(w http.ResponseWriter, r *http.Request) {
+		userID := 1
+		if r.URL.Query().Get("bob") != "" {
+			userID = 2
+		}
+		conn, err := Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		go NotificationManager.Listen(userID, NotificationManager.RegisterClient(userID, conn))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dial := func(path string, header http.Header) *websocket.Conn {
+		t.Helper()
+		conn, err := wstest.Dial(server, path, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	aliceSession, aliceNotifications := dial("/ws", alice), dial("/ws/notifications", nil)
+	bobSession := dial("/ws", bob)
+	readEnvelope(t, aliceSession)
+	readEnvelope(t, bobSession)
+	for connections(NotificationManager, 1) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	UserConnections.Disconnect(1)
+	for _, conn := range []*websocket.Conn{aliceSession, aliceNotifications} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			_, _, err := conn.ReadMessage()
+			if err == nil {
+				continue
+			}
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+				t.Fatalf("read error %v, want a policy violation close", err)
+			}
+			break
+		}
+	}
+
+	bobSession.WriteJSON(Envelope{Version: ProtocolVersion, Type: "ping", ID: "1"})
+	if pong := readEnvelope(t, bobSession); pong.Type != "pong" {
+		t.Fatalf("got %+v from the other user's session, want a pong", pong)
+	}
+}
+
+// TestDisconnectAcrossInstances closes a socket tracked by another instance.
+func TestDisconnectAcrossInstances(t *testing.T) {
+	bus := pubsub.NewMemory()
+	here := &ConnectionRegistry{closers: make(map[int]map[int]func())}
+	there := &ConnectionRegistry{closers: make(map[int]map[int]func())}
+	for _, registry := range []*ConnectionRegistry{here, there} {
+		if err := registry.UsePubSub(bus); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed := make(chan int, 2)
+	there.Track(1, func() { closed <- 1 })
+	untrack := there.Track(2, func() { closed <- 2 })
+	untrack()
+	here.Disconnect(1)
+	here.Disconnect(2)
+	select {
+	case userID := <-closed:
+		if userID != 1 {
+			t.Fatalf("closed a socket of User %d after it was untracked", userID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the other instance did not close the socket")
+	}
+	select {
+	case userID := <-closed:
+		t.Fatalf("closed a socket of User %d after it was untracked", userID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,400 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/internal/middlewars"
+
+	"github.com/gorilla/websocket"
+)
+
+// ProtocolVersion is the version of the /ws envelope. A client sending
+// another version gets an unsupported_version error.
+const ProtocolVersion = 1
+
+const (
+	// maxEnvelopeSize bounds one frame read from a /ws client
+	maxEnvelopeSize = 8 << 10
+	// sessionBuffer is how many frames a session queues before it is
+	// considered too slow and disconnected
+	sessionBuffer = 256
+)
+
+var (
+	// ErrNotAllowed is returned by Channel.Subscribe when the user may not join
+	ErrNotAllowed = errors.New("not allowed")
+	// ErrSessionClosed is returned by Session.Push once the session has ended
+	ErrSessionClosed = errors.New("session closed")
+	// ErrHubStopped is returned by Channel.Subscribe once the hub shut down
+	ErrHubStopped     = errors.New("hub stopped")
+	errUnknownChannel = errors.New("unknown channel")
+)
+
+// Upgrader is shared by every socket endpoint.
+var Upgrader = websocket.Upgrader{
+	CheckOrigin:     checkOrigin,
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// checkOrigin lets the frontend of config.AllowedOrigin and pages served by
+// this server open sockets. Clients that send no Origin are not browsers and
+// carry no third party's cookies.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == config.AllowedOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// Envelope is every frame on /ws, in both directions. Type is a control type
+// (subscribe, ping, ...) or a channel name, in which case Payload is that
+// channel's own event. ID is chosen by the client and echoed on the reply to
+// that frame.
+type Envelope struct {
+	Version int             `json:"version"`
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Channel is a hub mounted on the gateway. topic selects e.g. the group of
+// the group chat and is 0 for channels of the user themselves.
+type Channel interface {
+	Subscribe(s *Session, topic int) (Subscription, error)
+}
+
+// TopicResolver is implemented by a Channel whose topic is not the group_id
+// of the frames: it reads the topic from their payload itself.
+type TopicResolver interface {
+	Topic(payload []byte) (int, error)
+}
+
+// Subscription is a session's membership of a channel. Handle receives the
+// payloads the client sends to it and Close ends it; both are only called
+// from the session's read loop.
+type Subscription interface {
+	Handle(payload []byte)
+	Close()
+}
+
+// Gateway multiplexes the chat, group chat and notification hubs over one
+// authenticated connection per tab.
+type Gateway struct {
+	channels  map[string]Channel
+	onConnect []string // channels every session joins when it connects
+}
+
+func NewGateway() *Gateway {
+	return &Gateway{channels: make(map[string]Channel)}
+}
+
+// Mount makes channel available as name. With onConnect set every session
+// is subscribed to it (topic 0) as soon as it connects.
+func (g *Gateway) Mount(name string, channel Channel, onConnect bool) {
+	g.channels[name] = channel
+	if onConnect {
+		g.onConnect = append(g.onConnect, name)
+	}
+}
+
+// ServeWs upgrades an authenticated request to a gateway session.
+func (g *Gateway) ServeWs(w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	conn, err := Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("❌ WebSocket Upgrade Failed:", err)
+		return
+	}
+
+	s := &Session{
+		UserID:        userID,
+		conn:          conn,
+		gateway:       g,
+		send:          make(chan sessionFrame, sessionBuffer),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]Subscription),
+	}
+	log.Printf("✅ User %d connected to the gateway", userID)
+
+	go s.writePump()
+	s.reply("welcome", "", map[string]any{
+		"user_id":   userID,
+		"channels":  g.onConnect,
+		"heartbeat": int(pingPeriod / time.Second),
+	})
+	for _, name := range g.onConnect {
+		if err := s.subscribe(name, 0); err != nil {
+			log.Printf("❌ Failed to subscribe User %d to %s: %v", userID, name, err)
+		}
+	}
+	untrack := UserConnections.Track(userID, func() { s.Kick(websocket.ClosePolicyViolation, "logged out") })
+	go func() {
+		defer untrack()
+		s.readPump()
+	}()
+}
+
+// Session is one /ws connection. Hubs push to it with Push from any
+// goroutine.
+type Session struct {
+	UserID int
+
+	conn    *websocket.Conn
+	gateway *Gateway
+	send    chan sessionFrame
+	done    chan struct{}
+
+	closeOnce   sync.Once
+	closeCode   int
+	closeReason string
+
+	subscriptions map[string]Subscription // by channel and topic, read loop only
+}
+
+type sessionFrame struct {
+	data    []byte
+	written func()
+}
+
+// ephemeralEvents are dropped rather than queued when a session falls
+// behind, a newer one follows soon.
+var ephemeralEvents = map[string]bool{"typing_start": true, "typing_stop": true, "presence": true}
+
+// Push queues an event of channel for the client. written, if not nil, runs
+// once the frame is on the wire. A session that cannot keep up first loses
+// its ephemeral events, then is disconnected so the client reconnects and
+// catches up.
+func (s *Session) Push(channel string, payload []byte, written func()) error {
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+
+	if len(s.send) >= cap(s.send)/2 {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(payload, &event) == nil && ephemeralEvents[event.Type] {
+			return nil
+		}
+	}
+
+	data, err := json.Marshal(Envelope{Version: ProtocolVersion, Type: channel, Payload: payload})
+	if err != nil {
+		return err
+	}
+	select {
+	case s.send <- sessionFrame{data: data, written: written}:
+		return nil
+	default:
+		log.Printf("⚠️ Gateway session of User %d is falling behind, disconnecting", s.UserID)
+		s.Kick(websocket.CloseTryAgainLater, "falling behind")
+		return ErrSessionClosed
+	}
+}
+
+// Kick ends the session with a close frame carrying code and reason.
+func (s *Session) Kick(code int, reason string) {
+	s.closeOnce.Do(func() {
+		s.closeCode, s.closeReason = code, reason
+		close(s.done)
+	})
+}
+
+// reply sends a control frame to the client, dropping it if the session is
+// not keeping up.
+func (s *Session) reply(msgType, id string, payload any) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	data, _ := json.Marshal(Envelope{Version: ProtocolVersion, Type: msgType, ID: id, Payload: raw})
+	select {
+	case s.send <- sessionFrame{data: data}:
+	default:
+	}
+}
+
+func (s *Session) sendError(id, reason string) {
+	s.reply("error", id, map[string]string{"error": reason})
+}
+
+func (s *Session) readPump() {
+	defer func() {
+		for key, sub := range s.subscriptions {
+			sub.Close()
+			delete(s.subscriptions, key)
+		}
+		s.Kick(websocket.CloseNormalClosure, "")
+		s.conn.Close()
+		log.Printf("⚠️ User %d left the gateway", s.UserID)
+	}()
+
+	s.conn.SetReadLimit(maxEnvelopeSize)
+	s.conn.SetReadDeadline(time.Now().Add(pongWait))
+	s.conn.SetPongHandler(func(string) error { s.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+
+	for {
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("❌ Gateway read error for User %d: %v", s.UserID, err)
+			}
+			return
+		}
+		// any frame proves the client is alive, not only pongs
+		s.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var envelope Envelope
+		if err := json.Unmarshal(message, &envelope); err != nil || envelope.Type == "" {
+			s.sendError("", "invalid_envelope")
+			continue
+		}
+		if envelope.Version != 0 && envelope.Version != ProtocolVersion {
+			s.sendError(envelope.ID, "unsupported_version")
+			continue
+		}
+		s.handle(envelope)
+	}
+}
+
+// handle runs one frame from the client.
+func (s *Session) handle(envelope Envelope) {
+	var target struct {
+		Channel   string `json:"channel"`
+		GroupID   int    `json:"group_id"`
+		ChannelID int    `json:"channel_id,omitempty"` // of a group chat
+	}
+	if len(envelope.Payload) > 0 {
+		if err := json.Unmarshal(envelope.Payload, &target); err != nil {
+			s.sendError(envelope.ID, "invalid_payload")
+			return
+		}
+	}
+	if envelope.Type == "ping" {
+		s.reply("pong", envelope.ID, map[string]any{"time": time.Now().UTC()})
+		return
+	}
+
+	name := envelope.Type
+	if name == "subscribe" || name == "unsubscribe" {
+		name = target.Channel
+	}
+	topic := target.GroupID
+	if resolver, ok := s.gateway.channels[name].(TopicResolver); ok {
+		var err error
+		if topic, err = resolver.Topic(envelope.Payload); err != nil {
+			s.sendError(envelope.ID, subscribeError(err))
+			return
+		}
+		target.ChannelID = topic
+	}
+
+	switch envelope.Type {
+	case "subscribe":
+		if err := s.subscribe(target.Channel, topic); err != nil {
+			s.sendError(envelope.ID, subscribeError(err))
+			return
+		}
+		s.reply("subscribed", envelope.ID, target)
+	case "unsubscribe":
+		key := subscriptionKey(target.Channel, topic)
+		if sub, ok := s.subscriptions[key]; ok {
+			sub.Close()
+			delete(s.subscriptions, key)
+		}
+		s.reply("unsubscribed", envelope.ID, target)
+	default:
+		if _, ok := s.gateway.channels[envelope.Type]; !ok {
+			s.sendError(envelope.ID, "unknown_type")
+			return
+		}
+		sub, ok := s.subscriptions[subscriptionKey(envelope.Type, topic)]
+		if !ok {
+			s.sendError(envelope.ID, "not_subscribed")
+			return
+		}
+		sub.Handle(envelope.Payload)
+	}
+}
+
+// subscribe joins a channel, doing nothing if the session is already in it.
+func (s *Session) subscribe(name string, topic int) error {
+	channel, ok := s.gateway.channels[name]
+	if !ok {
+		return errUnknownChannel
+	}
+	key := subscriptionKey(name, topic)
+	if _, ok := s.subscriptions[key]; ok {
+		return nil
+	}
+	sub, err := channel.Subscribe(s, topic)
+	if err != nil {
+		return err
+	}
+	s.subscriptions[key] = sub
+	return nil
+}
+
+func subscribeError(err error) string {
+	switch err {
+	case errUnknownChannel:
+		return "unknown_channel"
+	case ErrNotAllowed:
+		return "not_allowed"
+	default:
+		log.Println("❌ Gateway subscription failed:", err)
+		return "subscribe_failed"
+	}
+}
+
+func subscriptionKey(channel string, topic int) string {
+	return fmt.Sprintf("%s:%d", channel, topic)
+}
+
+func (s *Session) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		s.conn.Close()
+	}()
+	for {
+		select {
+		case frame := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := s.conn.WriteMessage(websocket.TextMessage, frame.data); err != nil {
+				s.Kick(websocket.CloseAbnormalClosure, "")
+				return
+			}
+			if frame.written != nil {
+				frame.written()
+			}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := s.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				s.Kick(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-s.done:
+			s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(s.closeCode, s.closeReason), time.Now().Add(writeWait))
+			return
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/internal/config"
+	"social-network/internal/websocket/wstest"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoChannel pushes back what its subscribers send, floods them on
+// {"type":"flood"} and refuses topic 99.
+type echoChannel struct {
+	closed  chan int      // the topic of every subscription closed
+	refused chan struct{} // a flood stopped, the session refused a frame
+}
+
+type echoSubscription struct {
+	session *Session
+	topic   int
+	channel *echoChannel
+}
+
+func (c *echoChannel) Subscribe(s *Session, topic int) (Subscription, error) {
+	if topic == 99 {
+		return nil, ErrNotAllowed
+	}
+	return &echoSubscription{session: s, topic: topic, channel: c}, nil
+}
+
+func (e *echoSubscription) Handle(payload []byte) {
+	var event struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(payload, &event)
+	if event.Type != "flood" {
+		e.session.Push("echo", payload, nil)
+		return
+	}
+	// until the session gives up on a client that does not read
+	big := []byte(`{"type":"message","content":"` + strings.Repeat("x", 64<<10) + `"}`)
+	for i := 0; i < 1<<16; i++ {
+		if e.session.Push("echo", big, nil) != nil {
+			close(e.channel.refused)
+			return
+		}
+	}
+}
+
+func (e *echoSubscription) Close() {
+	e.channel.closed <- e.topic
+}
+
+// startGateway serves a gateway with the echo channel mounted and returns
+// the header of a logged in user.
+func startGateway(t *testing.T) (*httptest.Server, *echoChannel, http.Header) {
+	t.Helper()
+	db := wstest.UseDB(t, "../../migrations")
+	header := wstest.Login(t, db, 1, "alice")
+
+	echo := &echoChannel{closed: make(chan int, 8), refused: make(chan struct{})}
+	gateway := NewGateway()
+	gateway.Mount("echo", echo, false)
+	server := httptest.NewServer(http.HandlerFunc(gateway.ServeWs))
+	t.Cleanup(server.Close)
+	return server, echo, header
+}
+
+// dialGateway connects and reads the welcome frame.
+func dialGateway(t *testing.T, server *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, err := wstest.Dial(server, "/", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if welcome := readEnvelope(t, conn); welcome.Type != "welcome" || welcome.Version != ProtocolVersion {
+		t.Fatalf("first frame = %+v, want a version %d welcome", welcome, ProtocolVersion)
+	}
+	return conn
+}
+
+func readEnvelope(t *testing.T, conn *websocket.Conn) Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var envelope Envelope
+	if err := conn.ReadJSON(&envelope); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return envelope
+}
+
+// expectError reads a frame and checks it is the error reason for id.
+func expectError(t *testing.T, conn *websocket.Conn, id, reason string) {
+	t.Helper()
+	envelope := readEnvelope(t, conn)
+	var payload struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(envelope.Payload, &payload)
+	if envelope.Type != "error" || envelope.ID != id || payload.Error != reason {
+		t.Fatalf("got %s %q %s, want error %q %s", envelope.Type, envelope.ID, envelope.Payload, id, reason)
+	}
+}
+
+func send(t *testing.T, conn *websocket.Conn, envelope Envelope) {
+	t.Helper()
+	if err := conn.WriteJSON(envelope); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGatewayEnvelope(t *testing.T) {
+	server, _, header := startGateway(t)
+
+	if _, err := wstest.Dial(server, "/", nil); err == nil {
+		t.Fatal("connected without a session")
+	}
+	conn := dialGateway(t, server, header)
+
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "ping", ID: "1"})
+	if pong := readEnvelope(t, conn); pong.Type != "pong" || pong.ID != "1" || pong.Version != ProtocolVersion {
+		t.Fatalf("got %+v, want pong 1", pong)
+	}
+	// clients from before versioning send none
+	send(t, conn, Envelope{Type: "ping", ID: "2"})
+	if pong := readEnvelope(t, conn); pong.Type != "pong" || pong.ID != "2" {
+		t.Fatalf("got %+v, want pong 2", pong)
+	}
+
+	send(t, conn, Envelope{Version: ProtocolVersion + 1, Type: "ping", ID: "3"})
+	expectError(t, conn, "3", "unsupported_version")
+	conn.WriteMessage(websocket.TextMessage, []byte(`not json`))
+	expectError(t, conn, "", "invalid_envelope")
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "nothing", ID: "4"})
+	expectError(t, conn, "4", "unknown_type")
+}
+
+func TestGatewaySubscriptions(t *testing.T) {
+	server, echo, header := startGateway(t)
+	conn := dialGateway(t, server, header)
+
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "echo", ID: "1", Payload: []byte(`{"group_id":7}`)})
+	expectError(t, conn, "1", "not_subscribed")
+
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "subscribe", ID: "2", Payload: []byte(`{"channel":"echo","group_id":7}`)})
+	if subscribed := readEnvelope(t, conn); subscribed.Type != "subscribed" || subscribed.ID != "2" {
+		t.Fatalf("got %+v, want subscribed 2", subscribed)
+	}
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "echo", Payload: []byte(`{"group_id":7,"content":"hi"}`)})
+	if echoed := readEnvelope(t, conn); echoed.Type != "echo" || !strings.Contains(string(echoed.Payload), `"hi"`) {
+		t.Fatalf("got %+v, want the echo of hi", echoed)
+	}
+	// frames are routed by topic
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "echo", ID: "3", Payload: []byte(`{"group_id":8}`)})
+	expectError(t, conn, "3", "not_subscribed")
+
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "subscribe", ID: "4", Payload: []byte(`{"channel":"echo","group_id":99}`)})
+	expectError(t, conn, "4", "not_allowed")
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "subscribe", ID: "5", Payload: []byte(`{"channel":"nothing"}`)})
+	expectError(t, conn, "5", "unknown_channel")
+
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "unsubscribe", ID: "6", Payload: []byte(`{"channel":"echo","group_id":7}`)})
+	if unsubscribed := readEnvelope(t, conn); unsubscribed.Type != "unsubscribed" || unsubscribed.ID != "6" {
+		t.Fatalf("got %+v, want unsubscribed 6", unsubscribed)
+	}
+	if topic := <-echo.closed; topic != 7 {
+		t.Fatalf("closed the subscription of topic %d, want 7", topic)
+	}
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "echo", ID: "7", Payload: []byte(`{"group_id":7}`)})
+	expectError(t, conn, "7", "not_subscribed")
+
+	// the subscriptions left are closed with the session
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "subscribe", Payload: []byte(`{"channel":"echo","group_id":9}`)})
+	readEnvelope(t, conn)
+	conn.Close()
+	select {
+	case topic := <-echo.closed:
+		if topic != 9 {
+			t.Fatalf("closed the subscription of topic %d, want 9", topic)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the subscription was not closed with the session")
+	}
+}
+
+// TestGatewayKicksSlowConsumer floods a client that does not read until the
+// session's buffer is full, and expects it disconnected with a try again
+// later close.
+func TestGatewayKicksSlowConsumer(t *testing.T) {
+	server, echo, header := startGateway(t)
+	conn := dialGateway(t, server, header)
+
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "subscribe", Payload: []byte(`{"channel":"echo"}`)})
+	readEnvelope(t, conn)
+	send(t, conn, Envelope{Version: ProtocolVersion, Type: "echo", Payload: []byte(`{"type":"flood"}`)})
+	select {
+	case <-echo.refused:
+	case <-time.After(30 * time.Second):
+		t.Fatal("the session kept queueing for a client that does not read")
+	}
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseTryAgainLater {
+			t.Fatalf("read error %v, want a try again later close", err)
+		}
+		return
+	}
+}
+
+func TestSessionDropsEphemeralEvents(t *testing.T) {
+	s := &Session{UserID: 1, send: make(chan sessionFrame, 4), done: make(chan struct{})}
+	typing := []byte(`{"type":"typing_start"}`)
+	message := []byte(`{"type":"message"}`)
+
+	s.Push("chat", typing, nil)
+	s.Push("chat", message, nil)
+	if len(s.send) != 2 {
+		t.Fatalf("queued %d frames below half the buffer, want 2", len(s.send))
+	}
+	// at half the buffer, typing and presence are dropped, the rest queued
+	if err := s.Push("chat", typing, nil); err != nil || len(s.send) != 2 {
+		t.Fatalf("typing at half the buffer: %v, %d queued, want dropped", err, len(s.send))
+	}
+	if err := s.Push("chat", []byte(`{"type":"presence"}`), nil); err != nil || len(s.send) != 2 {
+		t.Fatalf("presence at half the buffer: %v, %d queued, want dropped", err, len(s.send))
+	}
+	s.Push("chat", message, nil)
+	s.Push("chat", message, nil)
+	if len(s.send) != 4 {
+		t.Fatalf("queued %d frames, want 4", len(s.send))
+	}
+
+	if err := s.Push("chat", message, nil); err != ErrSessionClosed {
+		t.Fatalf("push on a full buffer: %v, want ErrSessionClosed", err)
+	}
+	if s.closeCode != websocket.CloseTryAgainLater {
+		t.Fatalf("kicked with close code %d, want %d", s.closeCode, websocket.CloseTryAgainLater)
+	}
+	if err := s.Push("chat", message, nil); err != ErrSessionClosed {
+		t.Fatalf("push after the kick: %v, want ErrSessionClosed", err)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	server, _, header := startGateway(t)
+
+	for origin, allowed := range map[string]bool{
+		"":                     true,
+		config.AllowedOrigin:   true,
+		server.URL:             true, // a page served by the server itself
+		"http://evil.example":  false,
+		"null":                 false,
+		"http://localhost:666": false,
+	} {
+		h := header.Clone()
+		if origin != "" {
+			h.Set("Origin", origin)
+		}
+		conn, err := wstest.Dial(server, "/", h)
+		if conn != nil {
+			conn.Close()
+		}
+		if (err == nil) != allowed {
+			t.Errorf("origin %q: dial error %v, want allowed %v", origin, err, allowed)
+		}
+	}
+}
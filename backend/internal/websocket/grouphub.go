@@ -2,14 +2,21 @@ package websocket
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"social-network/internal/config"
 	"social-network/internal/middlewars"
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/pubsub"
 	"social-network/internal/repositories"
 
 	"github.com/gorilla/websocket"
@@ -20,6 +27,10 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512
+	// typingInterval rate-limits typing events of one connection
+	typingInterval = time.Second
+	// maxClientIDLength bounds the client generated message ids
+	maxClientIDLength = 64
 )
 
 var (
@@ -27,87 +38,349 @@ var (
 	space   = []byte{' '}
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // ✅ Allows all frontend origins (e.g., localhost:5173)
-	},
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-}
-
 type GroupHub struct {
-	clients    map[int]map[*Client]bool // ✅ Tracks connections by groupID
-	broadcast  chan GroupMessage        // ✅ Channel for group messages
+	clients    map[int]map[*Client]bool // ✅ Tracks connections by channel of the group chats, Run only
 	register   chan *Client
 	unregister chan *Client
+	events     chan groupEvent // ✅ Channel for messages and typed events such as read receipts, from any instance
+	quit       chan struct{}   // closed by Stop
+	stopOnce   sync.Once
+	bus        pubsub.PubSub
+}
+
+// groupTopic is the pub/sub topic of the group chat hubs of all instances
+const groupTopic = "group"
+
+// groupEvent is what the hub sends to a channel, as it travels on the bus.
+type groupEvent struct {
+	ChannelID int             `json:"channel_id"`
+	Payload   json.RawMessage `json:"payload"`
+	// Evict disconnects this user from the channel, after sending them the
+	// event, instead of sending it to the whole channel
+	Evict int `json:"evict,omitempty"`
+	// Presence is the user whose presence the event carries, it only goes to
+	// the connections of users allowed to see it
+	Presence int `json:"presence,omitempty"`
+
+	to *Client // only this local connection, instead of the whole channel
 }
 
 type GroupMessage struct {
+	Type           string `json:"type,omitempty"` // typing_start, typing_stop, edit or unsend, empty for a chat message
+	ID             int    `json:"id,omitempty"`
 	GroupID        int    `json:"group_id"`
+	ChannelID      int    `json:"channel_id"`
 	SenderID       int    `json:"sender_id"`
 	Content        string `json:"content"`
 	SentAt         string `json:"sent_at"`
 	SenderNickname string `json:"sender_nickname"`
+
+	ReplyTo     *models.MessageQuote    `json:"reply_to,omitempty"`
+	Attachments []models.ChatAttachment `json:"attachments,omitempty"`
+	ExpiresAt   *time.Time              `json:"expires_at,omitempty"` // a disappearing message is deleted then
+
+	MessageID     int   `json:"message_id,omitempty"`     // in: the message to edit or unsend
+	ReplyToID     int   `json:"reply_to_id,omitempty"`    // in: the message a new one quotes
+	AttachmentIDs []int `json:"attachment_ids,omitempty"` // in: uploads to send with a new message
+	// generated by the client, a resend with the same id is stored and broadcast once
+	ClientID string `json:"client_id,omitempty"`
 }
 
-// ✅ Create New Group Hub
-func NewGroupHub() *GroupHub {
-	return &GroupHub{
+// ✅ Create New Group Hub, whose events go through bus to every instance
+func NewGroupHub(bus pubsub.PubSub) (*GroupHub, error) {
+	h := &GroupHub{
 		clients:    make(map[int]map[*Client]bool),
-		broadcast:  make(chan GroupMessage),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		events:     make(chan groupEvent),
+		quit:       make(chan struct{}),
+		bus:        bus,
+	}
+	err := bus.Subscribe(groupTopic, func(data []byte) {
+		var event groupEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			log.Println("❌ Invalid group chat event from pub/sub:", err)
+			return
+		}
+		h.submit(event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Publish pushes an event to everyone connected to a channel of a group
+// chat, on any instance.
+func (h *GroupHub) Publish(channelID int, event any) {
+	h.publish(groupEvent{ChannelID: channelID}, event)
+}
+
+// Evict disconnects userID from a channel they may no longer read, on any
+// instance, sending them event first.
+func (h *GroupHub) Evict(channelID, userID int, event any) {
+	h.publish(groupEvent{ChannelID: channelID, Evict: userID}, event)
+}
+
+func (h *GroupHub) publish(message groupEvent, event any) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Println("❌ Error encoding group chat event:", err)
+		return
+	}
+	message.Payload = payload
+	data, _ := json.Marshal(message)
+	if err := h.bus.Publish(groupTopic, data); err != nil {
+		log.Printf("❌ Failed to publish to Channel %d: %v", message.ChannelID, err)
 	}
 }
 
-// ✅ GroupHub: Manages clients and broadcasts messages
+// Topic tells the gateway which channel a frame is about: its channel_id, or
+// the default channel of its group_id.
+func (h *GroupHub) Topic(payload []byte) (int, error) {
+	var target struct {
+		GroupID   int `json:"group_id"`
+		ChannelID int `json:"channel_id"`
+	}
+	if err := json.Unmarshal(payload, &target); err != nil {
+		return 0, err
+	}
+	if target.ChannelID != 0 {
+		return target.ChannelID, nil
+	}
+	channel, err := repositories.NewGroupChannelRepository(config.GetDB()).DefaultChannel(target.GroupID)
+	if err == repositories.ErrChannelNotFound {
+		return 0, ErrNotAllowed
+	}
+	if err != nil {
+		return 0, err
+	}
+	return channel.ID, nil
+}
+
+// ✅ GroupHub: Manages clients and broadcasts messages. Only Run reads or
+// changes clients and sends on or closes their send channels; it returns once
+// Stop is called, after closing every connection.
 func (h *GroupHub) Run() {
 	for {
 		select {
 		case client := <-h.register:
-			if _, ok := h.clients[client.groupID]; !ok {
-				h.clients[client.groupID] = make(map[*Client]bool)
+			if _, ok := h.clients[client.channelID]; !ok {
+				h.clients[client.channelID] = make(map[*Client]bool)
 			}
-			h.clients[client.groupID][client] = true
+			h.clients[client.channelID][client] = true
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client.groupID]; ok {
-				delete(h.clients[client.groupID], client)
-				close(client.send)
-				if len(h.clients[client.groupID]) == 0 {
-					delete(h.clients, client.groupID) // Remove empty groups
+			h.removeClient(client)
+
+		case event := <-h.events:
+			if event.to != nil {
+				if h.clients[event.to.channelID][event.to] {
+					h.deliver(event.to, event.Payload)
+				}
+				continue
+			}
+			if event.Presence != 0 {
+				viewers := make([]*Client, 0, len(h.clients[event.ChannelID]))
+				for client := range h.clients[event.ChannelID] {
+					viewers = append(viewers, client)
+				}
+				go h.announcePresence(event, viewers)
+				continue
+			}
+			for client := range h.clients[event.ChannelID] {
+				if event.Evict == 0 {
+					h.deliver(client, event.Payload)
+				} else if client.userID == event.Evict {
+					client.evicted.Store(true)
+					h.deliver(client, event.Payload)
+					h.removeClient(client)
 				}
 			}
 
-		case message := <-h.broadcast:
-			if clients, ok := h.clients[message.GroupID]; ok {
-				formattedMessage, _ := json.Marshal(message)
+		case <-h.quit:
+			for _, clients := range h.clients {
 				for client := range clients {
-					select {
-					case client.send <- formattedMessage:
-					default:
-						close(client.send)
-						delete(h.clients[message.GroupID], client)
-					}
+					h.removeClient(client)
 				}
 			}
+			return
 		}
 	}
 }
 
-var groupName string
+// deliver queues an event on one connection, dropping the connection if it
+// is not keeping up.
+func (h *GroupHub) deliver(client *Client, payload []byte) {
+	select {
+	case client.send <- payload:
+	default:
+		h.removeClient(client)
+	}
+}
+
+// removeClient forgets one connection and closes its send channel, once.
+func (h *GroupHub) removeClient(client *Client) {
+	clients, ok := h.clients[client.channelID]
+	if !ok || !clients[client] {
+		return
+	}
+	delete(clients, client)
+	close(client.send)
+	if len(clients) == 0 {
+		delete(h.clients, client.channelID) // Remove empty channels
+	}
+}
+
+// Stop shuts the hub down. What is sent to it afterwards is dropped.
+func (h *GroupHub) Stop() {
+	h.stopOnce.Do(func() { close(h.quit) })
+}
+
+func (h *GroupHub) stopped() bool {
+	select {
+	case <-h.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// join registers a connection, unless the hub is stopped.
+func (h *GroupHub) join(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.quit:
+		return false
+	}
+}
+
+func (h *GroupHub) drop(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.quit:
+	}
+}
+
+// submit hands an event to Run for delivery.
+func (h *GroupHub) submit(event groupEvent) {
+	select {
+	case h.events <- event:
+	case <-h.quit:
+	}
+}
 
 type Client struct {
-	userID  int
-	groupID int
-	hub     *GroupHub
-	conn    *websocket.Conn
-	send    chan []byte
+	userID    int
+	groupID   int
+	channelID int
+	hub       *GroupHub
+	conn      *websocket.Conn // nil for a gateway subscription
+	send      chan []byte
+	limiter   *EventLimiter
+	// unsubscribed is set by Close before leaving, so that the gateway
+	// forwarder can tell an unsubscribe from the hub dropping a slow client
+	unsubscribed atomic.Bool
+	evicted      atomic.Bool // set by Run when the user lost access to the channel
+}
+
+// Subscribe joins a gateway session to a channel of a group chat, which the
+// user must be able to read. The client is a Subscription itself.
+func (h *GroupHub) Subscribe(s *Session, channelID int) (Subscription, error) {
+	db := config.GetDB()
+	if allowed, err := policy.CanReadChannel(db, s.UserID, channelID); err != nil {
+		return nil, err
+	} else if !allowed {
+		return nil, ErrNotAllowed
+	}
+	channel, err := repositories.NewGroupChannelRepository(db).GetChannel(channelID)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{userID: s.UserID, groupID: channel.GroupID, channelID: channelID, hub: h, send: make(chan []byte, 256), limiter: NewEventLimiter(typingInterval)}
+	if !h.join(client) {
+		return nil, ErrHubStopped
+	}
+	if UserPresence.Connect(s.UserID, false) {
+		h.publishPresence(client)
+	}
+	log.Printf("✅ User %d joined Channel %d of Group %d via the gateway", s.UserID, channelID, channel.GroupID)
+
+	go func() {
+		for payload := range client.send {
+			s.Push("group", payload, nil)
+		}
+		switch {
+		case client.unsubscribed.Load(), client.evicted.Load():
+		case h.stopped():
+			s.Kick(websocket.CloseGoingAway, "shutting down")
+		default:
+			s.Kick(websocket.CloseTryAgainLater, "falling behind")
+		}
+	}()
+	return client, nil
+}
+
+// Handle runs a frame the client sent through the gateway.
+func (c *Client) Handle(payload []byte) {
+	c.handle(payload)
+}
+
+// Close leaves the group chat.
+func (c *Client) Close() {
+	c.unsubscribed.Store(true)
+	c.leave()
+}
+
+func (c *Client) leave() {
+	c.hub.drop(c)
+	if UserPresence.Disconnect(c.userID, false) {
+		c.hub.publishPresence(c)
+	}
+}
+
+// publishPresence tells those in the client's channel who may see it that
+// its user came online or went offline, unless they hide their presence.
+func (h *GroupHub) publishPresence(c *Client) {
+	if show, err := ShowsPresence(config.GetDB(), c.userID); err != nil || !show {
+		return
+	}
+	presence := UserPresence.Get(c.userID)
+	h.publish(groupEvent{ChannelID: c.channelID, Presence: c.userID}, map[string]any{
+		"type":       "presence",
+		"group_id":   c.groupID,
+		"channel_id": c.channelID,
+		"user_id":    c.userID,
+		"status":     presence.Status,
+		"last_seen":  presence.LastSeen,
+	})
+}
+
+// announcePresence sends a presence event to the viewers, connections of
+// this instance, whose user may see it under PresenceVisible.
+func (h *GroupHub) announcePresence(event groupEvent, viewers []*Client) {
+	db := config.GetDB()
+	visible := make(map[int]bool)
+	for _, client := range viewers {
+		allowed, checked := visible[client.userID]
+		if !checked {
+			var err error
+			if allowed, err = PresenceVisible(db, client.userID, event.Presence); err != nil {
+				log.Printf("❌ Error checking presence of User %d for User %d: %v", event.Presence, client.userID, err)
+			}
+			visible[client.userID] = allowed
+		}
+		if allowed {
+			h.submit(groupEvent{to: client, Payload: event.Payload})
+		}
+	}
 }
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.leave()
 		c.conn.Close()
 	}()
 
@@ -115,129 +388,243 @@ func (c *Client) readPump() {
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
-	db := config.GetDB()
-	repo := repositories.NewGroupChatRepository(db)
-
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			break
 		}
-		message = bytes.TrimSpace(message)
+		c.handle(bytes.TrimSpace(message))
+	}
+}
 
-		var msg GroupMessage
-		if err := json.Unmarshal(message, &msg); err != nil {
-			continue
-		}
-		msg.SenderID = c.userID
-		msg.SentAt = time.Now().Format(time.RFC3339)
+// handle runs one frame from the client, whichever socket it came through.
+func (c *Client) handle(message []byte) {
+	db := config.GetDB()
+	repo := repositories.NewGroupChatRepository(db)
 
-		// ✅ Save message to database
-		if err := repo.SaveGroupChatMessage(msg.GroupID, msg.SenderID, msg.Content); err != nil {
-			log.Println("❌ Failed to store message:", err)
-			continue
+	var msg GroupMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return
+	}
+	if msg.Type == "typing_start" || msg.Type == "typing_stop" {
+		if !c.limiter.Allow(msg.Type) {
+			return
 		}
+		if c.postError(db) != "" {
+			return
+		}
+		c.hub.Publish(c.channelID, map[string]any{
+			"type":       msg.Type,
+			"group_id":   c.groupID,
+			"channel_id": c.channelID,
+			"sender_id":  c.userID,
+		})
+		return
+	}
+	if msg.Type == "edit" || msg.Type == "unsend" {
+		c.changeMessage(repo, msg.Type, msg.MessageID, msg.Content)
+		return
+	}
+	msg.Type = ""
+	msg.GroupID, msg.ChannelID = c.groupID, c.channelID
+	msg.SenderID = c.userID
+	msg.SentAt = time.Now().Format(time.RFC3339)
+
+	if reason := c.postError(db); reason != "" {
+		log.Printf("🚫 User %d is not allowed to post in Channel %d", c.userID, c.channelID)
+		c.sendError(reason, 0)
+		return
+	}
 
-		query := `SELECT group_name FROM groups WHERE id = ?`
-		db.QueryRow(query, msg.GroupID).Scan(&groupName)
-		notifMsg := msg.SenderNickname + " sent a message to: " + groupName
-		SendNotification(c.userID, "message", notifMsg)
-
-		// ✅ Broadcast message
-		c.hub.broadcast <- msg
+	if len(msg.ClientID) > maxClientIDLength {
+		c.sendError("invalid_client_id", 0)
+		return
 	}
-}
 
-func ServeGroupChatWs(hub *GroupHub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// ✅ Save message to database
+	saved, created, err := repo.SaveGroupChatMessage(repositories.MessageDraft{
+		SenderID:      msg.SenderID,
+		GroupID:       msg.GroupID,
+		ChannelID:     msg.ChannelID,
+		Content:       msg.Content,
+		ReplyToID:     msg.ReplyToID,
+		AttachmentIDs: msg.AttachmentIDs,
+		ClientID:      msg.ClientID,
+	})
+	if err == repositories.ErrMessageNotFound {
+		c.sendError("reply_not_found", msg.ReplyToID)
+		return
+	}
+	if err == repositories.ErrAttachmentNotFound {
+		c.sendError("attachment_not_found", 0)
+		return
+	}
 	if err != nil {
-		log.Println("❌ WebSocket Upgrade Failed:", err)
+		log.Println("❌ Failed to store message:", err)
 		return
 	}
+	c.reply(map[string]any{
+		"type":       "ack",
+		"group_id":   saved.GroupID,
+		"channel_id": saved.ChannelID,
+		"client_id":  saved.ClientID,
+		"id":         saved.ID,
+		"sent_at":    saved.SentAt,
+	})
+	if !created {
+		return // a resend, the first attempt was already broadcast
+	}
+	msg.ID, msg.ReplyTo, msg.Attachments, msg.ExpiresAt = saved.ID, saved.ReplyTo, saved.Attachments, saved.ExpiresAt
+	msg.MessageID, msg.ReplyToID, msg.AttachmentIDs = 0, 0, nil
 
-	// ✅ Extract user_id and group_id from query parameters
-	userIDStr := r.URL.Query().Get("user_id")
-	groupIDStr := r.URL.Query().Get("group_id")
+	var groupName, channelName string
+	query := `SELECT g.group_name, ch.name FROM group_chat_channels ch JOIN groups g ON g.id = ch.group_id WHERE ch.id = ?`
+	db.QueryRow(query, msg.ChannelID).Scan(&groupName, &channelName)
+	notifMsg := msg.SenderNickname + " sent a message to: " + groupName + " #" + channelName
+	SendNotification(c.userID, "message", notifMsg)
 
-	userID, err := strconv.Atoi(userIDStr)
-	groupID, err2 := strconv.Atoi(groupIDStr)
+	// ✅ Broadcast message
+	c.hub.Publish(msg.ChannelID, msg)
+}
 
-	if err != nil || err2 != nil || userID == 0 || groupID == 0 {
-		log.Println("❌ Invalid WebSocket parameters")
-		conn.Close()
+// postError tells why the client may not write in its channel, "" if it may.
+func (c *Client) postError(db *sql.DB) string {
+	allowed, err := policy.CanPostInChannel(db, c.userID, c.channelID)
+	if err != nil {
+		log.Println("❌ Failed to check channel permission:", err)
+		return "not_allowed"
+	}
+	if allowed {
+		return ""
+	}
+	if readable, _ := policy.CanReadChannel(db, c.userID, c.channelID); readable {
+		return "channel_archived"
+	}
+	return "not_allowed"
+}
+
+// changeMessage edits or unsends one of the client's messages in its
+// channel and publishes the changed message as a message_edited or
+// message_unsent event.
+func (c *Client) changeMessage(repo *repositories.GroupChatRepository, action string, messageID int, content string) {
+	if reason := c.postError(repo.DB); reason != "" {
+		c.sendError(reason, messageID)
 		return
 	}
 
-	// ✅ Create client and register it to the hub
-	client := &Client{userID: userID, groupID: groupID, hub: hub, conn: conn, send: make(chan []byte, 256)}
-	hub.register <- client
+	var changed *models.GroupChatMessage
+	var err error
+	if action == "edit" {
+		if strings.TrimSpace(content) == "" {
+			c.sendError("empty_content", messageID)
+			return
+		}
+		changed, err = repo.EditMessage(c.channelID, c.userID, messageID, content)
+	} else {
+		changed, err = repo.UnsendMessage(c.channelID, c.userID, messageID)
+	}
+	switch {
+	case err == repositories.ErrMessageNotFound:
+		c.sendError("message_not_found", messageID)
+		return
+	case err == repositories.ErrEditWindowClosed:
+		c.sendError("edit_window_closed", messageID)
+		return
+	case err != nil:
+		log.Printf("❌ Failed to %s group message %d: %v", action, messageID, err)
+		return
+	}
 
-	log.Printf("✅ User %d joined Group %d via WebSocket", userID, groupID)
+	event := map[string]any{"type": "message_edited", "group_id": c.groupID, "channel_id": c.channelID, "message": changed}
+	if action == "unsend" {
+		event["type"] = "message_unsent"
+	}
+	c.hub.Publish(c.channelID, event)
+}
 
-	// ✅ Start read and write pumps
-	go client.readPump()
-	go client.writePump()
+// sendError tells the client why its request about messageID failed.
+func (c *Client) sendError(reason string, messageID int) {
+	c.reply(map[string]any{
+		"type":       "error",
+		"error":      reason,
+		"group_id":   c.groupID,
+		"channel_id": c.channelID,
+		"message_id": messageID,
+	})
+}
+
+// reply sends an event to this connection only, through Run as the hub may
+// be closing the connection meanwhile.
+func (c *Client) reply(event any) {
+	payload, _ := json.Marshal(event)
+	c.hub.submit(groupEvent{to: c, Payload: payload})
 }
 
-func GetGroupChatHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	user := middlewars.GetUserbySession(w, r)
-	if user.ID == 0 {
+// ServeGroupChatWs connects the session user to a channel of a group chat:
+// group_id, and channel_id for a channel other than the group's default one.
+func ServeGroupChatWs(hub *GroupHub, w http.ResponseWriter, r *http.Request) {
+	userID := middlewars.GetUserIDFromSession(w, r)
+	if userID == 0 {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-
-	groupIDStr := r.URL.Query().Get("group_id")
-	groupID, err := strconv.Atoi(groupIDStr)
+	groupID, err := strconv.Atoi(r.URL.Query().Get("group_id"))
 	if err != nil || groupID == 0 {
 		http.Error(w, "Invalid group ID", http.StatusBadRequest)
 		return
 	}
 
 	db := config.GetDB()
-
-	// ✅ Check if user is a member of the group
-	var isMember bool
-	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_members WHERE user_id = ? AND group_id = ?)`, user.ID, groupID).Scan(&isMember)
-	if err != nil || !isMember {
-		http.Error(w, "Unauthorized: You are not in this group", http.StatusForbidden)
+	channels := repositories.NewGroupChannelRepository(db)
+	var channel *models.GroupChannel
+	if channelID, _ := strconv.Atoi(r.URL.Query().Get("channel_id")); channelID != 0 {
+		channel, err = channels.GetChannel(channelID)
+	} else {
+		channel, err = channels.DefaultChannel(groupID)
+	}
+	if err == nil && channel.GroupID != groupID {
+		err = repositories.ErrChannelNotFound
+	}
+	if err == repositories.ErrChannelNotFound {
+		http.Error(w, "Channel not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("❌ User %d cannot join the chat of Group %d: %v", userID, groupID, err)
+		http.Error(w, "Failed to retrieve channel", http.StatusInternalServerError)
+		return
+	}
+	if allowed, err := policy.CanReadChannel(db, userID, channel.ID); err != nil || !allowed {
+		log.Printf("❌ User %d cannot join Channel %d of Group %d: %v", userID, channel.ID, groupID, err)
+		http.Error(w, "You cannot access this channel", http.StatusForbidden)
 		return
 	}
 
-	// ✅ Fetch chat history
-	rows, err := db.Query(`
-		SELECT gm.id, gm.sender_id, u.nickname, gm.content, gm.sent_at
-		FROM group_messages gm
-		JOIN users u ON gm.sender_id = u.id
-		WHERE gm.group_id = ?
-		ORDER BY gm.sent_at ASC`, groupID)
+	conn, err := Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		http.Error(w, "Failed to retrieve chat history", http.StatusInternalServerError)
+		log.Println("❌ WebSocket Upgrade Failed:", err)
 		return
 	}
-	defer rows.Close()
 
-	var messages []map[string]any
-	for rows.Next() {
-		var msg struct {
-			ID       int    `json:"id"`
-			SenderID int    `json:"sender_id"`
-			Nickname string `json:"nickname"`
-			Content  string `json:"content"`
-			SentAt   string `json:"sent_at"`
-		}
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.Nickname, &msg.Content, &msg.SentAt); err != nil {
-			continue
-		}
-		messages = append(messages, map[string]any{
-			"id":        msg.ID,
-			"sender_id": msg.SenderID,
-			"nickname":  msg.Nickname,
-			"content":   msg.Content,
-			"sent_at":   msg.SentAt,
-		})
+	// ✅ Create client and register it to the hub
+	client := &Client{userID: userID, groupID: groupID, channelID: channel.ID, hub: hub, conn: conn, send: make(chan []byte, 256), limiter: NewEventLimiter(typingInterval)}
+	if !hub.join(client) {
+		conn.Close()
+		return
 	}
+	if UserPresence.Connect(userID, false) {
+		hub.publishPresence(client)
+	}
+
+	log.Printf("✅ User %d joined Channel %d of Group %d via WebSocket", userID, channel.ID, groupID)
 
-	json.NewEncoder(w).Encode(messages)
+	// ✅ Start read and write pumps
+	untrack := UserConnections.TrackConn(userID, conn)
+	go func() {
+		defer untrack()
+		client.readPump()
+	}()
+	go client.writePump()
 }
 
 // ✅ Write Messages to WebSocket
@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"social-network/internal/pubsub"
+	"social-network/internal/websocket/wstest"
+
+	"github.com/gorilla/websocket"
+)
+
+// startGroupHub runs a hub on an in-memory bus until the test ends.
+func startGroupHub(t *testing.T) *GroupHub {
+	t.Helper()
+	hub, err := NewGroupHub(pubsub.NewMemory())
+	if err != nil {
+		t.Fatalf("new group hub: %v", err)
+	}
+	wstest.Start(t, hub)
+	return hub
+}
+
+// TestGroupHubChurn joins and leaves channels, some clients too slow to keep
+// up so that the hub drops them before they leave, while events are
+// broadcast. Run it with -race.
+func TestGroupHubChurn(t *testing.T) {
+	hub := startGroupHub(t)
+
+	wstest.Churn(25, 50, func(worker, round int) {
+		if worker >= 20 {
+			hub.Publish(round%3+1, map[string]any{"type": "message", "content": "churn"})
+			return
+		}
+		userID := worker + 1
+		client := &Client{userID: userID, groupID: 1, channelID: round%3 + 1, hub: hub, send: make(chan []byte, 2)}
+		if !hub.join(client) {
+			t.Error("join refused by a running hub")
+			return
+		}
+		if round%2 == 0 {
+			go func() {
+				for range client.send {
+				}
+			}()
+		}
+		client.reply(map[string]any{"type": "ack"})
+		hub.Publish(client.channelID, map[string]any{"type": "typing_start", "sender_id": userID})
+		hub.drop(client)
+	})
+}
+
+// TestGroupHubChurnOverSockets connects members to a group chat and leaves
+// again, through /ws/groupchat and through gateway subscriptions, while they
+// type, and expects everyone offline once all sockets are closed.
+func TestGroupHubChurnOverSockets(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	hub := startGroupHub(t)
+	gateway := NewGateway()
+	gateway.Mount("group", hub, false)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/groupchat", func(w http.ResponseWriter, r *http.Request) { ServeGroupChatWs(hub, w, r) })
+	mux.HandleFunc("/ws", gateway.ServeWs)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	const members = 4
+	headers := make([]http.Header, members)
+	if _, err := db.Exec(`INSERT INTO users (id, nickname, email, password, first_name, last_name, date_of_birth)
+		VALUES (100, 'owner', 'owner@x.io', '-', 'O', 'L', '2000-01-01')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO groups (id, group_name, creator_id) VALUES (1, 'club', 100)`); err != nil {
+		t.Fatal(err)
+	}
+	for i := range headers {
+		userID := i + 1
+		headers[i] = wstest.Login(t, db, userID, fmt.Sprintf("member%d", userID))
+		if _, err := db.Exec(`INSERT INTO group_members (id, group_id, username, status) VALUES (?, 1, ?, 'approved')`,
+			userID, fmt.Sprintf("member%d", userID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	typing := []byte(`{"type":"typing_start"}`)
+	wstest.Churn(members, 10, func(worker, round int) {
+		if round%2 == 0 {
+			conn, err := wstest.Dial(server, "/ws/groupchat?group_id=1", headers[worker])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, typing)
+			conn.Close()
+			return
+		}
+
+		conn, err := wstest.Dial(server, "/ws", headers[worker])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(Envelope{Version: ProtocolVersion, Type: "subscribe", Payload: []byte(`{"channel":"group","group_id":1}`)})
+		conn.WriteJSON(Envelope{Version: ProtocolVersion, Type: "group", Payload: []byte(`{"group_id":1,"type":"typing_start"}`)})
+		if round%4 == 1 {
+			conn.WriteJSON(Envelope{Version: ProtocolVersion, Type: "unsubscribe", Payload: []byte(`{"channel":"group","group_id":1}`)})
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			var envelope Envelope
+			if err := conn.ReadJSON(&envelope); err != nil {
+				t.Errorf("member %d: %v", worker+1, err)
+				return
+			}
+			if envelope.Type == "subscribed" {
+				return
+			}
+		}
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for userID := 1; userID <= members; userID++ {
+		for UserPresence.Get(userID).Status != PresenceOffline {
+			if time.Now().After(deadline) {
+				t.Fatalf("member %d is still %s after closing every socket", userID, UserPresence.Get(userID).Status)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestGroupHubStop(t *testing.T) {
+	hub := startGroupHub(t)
+	client := &Client{userID: 1, groupID: 1, channelID: 1, hub: hub, send: make(chan []byte, 4)}
+	hub.join(client)
+
+	hub.Stop()
+	select {
+	case _, ok := <-client.send:
+		for ok {
+			_, ok = <-client.send
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the connection was not closed on stop")
+	}
+
+	// nothing blocks on a stopped hub
+	if hub.join(&Client{userID: 2, groupID: 1, channelID: 1, hub: hub, send: make(chan []byte, 1)}) {
+		t.Fatal("a stopped hub accepted a connection")
+	}
+	hub.Publish(1, map[string]any{"type": "message"})
+	client.reply(map[string]any{"type": "ack"})
+	hub.drop(client)
+}
@@ -1,55 +1,256 @@
 package websocket
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"time"
 
 	"social-network/internal/config"
 	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/pubsub"
 
 	"github.com/gorilla/websocket"
 )
 
 var NotificationManager = &WebSocketNotificationManager{
-	Clients: make(map[int]*WebSocketConn),
+	Clients: make(map[int]map[*WebSocketConn]bool),
 }
 
 type WebSocketNotificationManager struct {
-	Clients map[int]*WebSocketConn
+	Clients map[int]map[*WebSocketConn]bool // every open connection of a user
 	Mutex   sync.Mutex
+	bus     pubsub.PubSub // nil until UsePubSub, then notifications reach every instance
 }
+
+// notificationsTopic is the pub/sub topic of the notification managers of all instances
+const notificationsTopic = "notifications"
+
+// notificationMessage is a notification as it travels on the bus, UserID 0
+// sends it to everyone in its Audience. Nothing is sent to every user.
+type notificationMessage struct {
+	UserID   int             `json:"user_id"`
+	Audience *audience       `json:"audience,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// audience limits an update to the users who may access its target under
+// policy.CanAccessTarget, or to the members of GroupID.
+type audience struct {
+	TargetType string `json:"target_type,omitempty"`
+	TargetID   int    `json:"target_id,omitempty"`
+	GroupID    int    `json:"group_id,omitempty"`
+}
+
+func (a *audience) allows(db *sql.DB, userID int) bool {
+	var allowed bool
+	var err error
+	if a.GroupID != 0 {
+		allowed, err = policy.CanActInGroup(db, userID, a.GroupID)
+	} else {
+		allowed, err = policy.CanAccessTarget(db, userID, a.TargetType, a.TargetID)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("❌ Error checking the audience %+v for User %d: %v", *a, userID, err)
+	}
+	return err == nil && allowed
+}
+
+// UsePubSub sends the notifications through bus from now on, so that users
+// connected to other instances get them too.
+func (wm *WebSocketNotificationManager) UsePubSub(bus pubsub.PubSub) error {
+	err := bus.Subscribe(notificationsTopic, func(data []byte) {
+		var message notificationMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			log.Println("❌ Invalid notification from pub/sub:", err)
+			return
+		}
+		wm.deliver(message)
+	})
+	if err != nil {
+		return err
+	}
+	wm.Mutex.Lock()
+	wm.bus = bus
+	wm.Mutex.Unlock()
+	return nil
+}
+
+// publish sends v to the connections of userID on every instance.
+func (wm *WebSocketNotificationManager) publish(userID int, v any, what string) {
+	wm.send(notificationMessage{UserID: userID}, v, what)
+}
+
+// publishTo sends v to the connected users of every instance in an audience.
+func (wm *WebSocketNotificationManager) publishTo(to audience, v any, what string) {
+	wm.send(notificationMessage{Audience: &to}, v, what)
+}
+
+func (wm *WebSocketNotificationManager) send(message notificationMessage, v any, what string) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("❌ Error encoding %s: %v", what, err)
+		return
+	}
+	message.Payload = payload
+	wm.Mutex.Lock()
+	bus := wm.bus
+	wm.Mutex.Unlock()
+	if bus == nil {
+		wm.deliver(message)
+		return
+	}
+	data, _ := json.Marshal(message)
+	if err := bus.Publish(notificationsTopic, data); err != nil {
+		log.Printf("❌ Failed to publish %s: %v", what, err)
+	}
+}
+
+// deliver writes a message to the local connections of its user, or of the
+// users in its audience. The audience is checked without holding wm.Mutex.
+func (wm *WebSocketNotificationManager) deliver(message notificationMessage) {
+	if message.UserID != 0 {
+		wm.Mutex.Lock()
+		wm.writeUser(message.UserID, message.Payload)
+		wm.Mutex.Unlock()
+		return
+	}
+	if message.Audience == nil {
+		log.Println("❌ Dropped a notification without recipients")
+		return
+	}
+
+	wm.Mutex.Lock()
+	userIDs := make([]int, 0, len(wm.Clients))
+	for userID := range wm.Clients {
+		userIDs = append(userIDs, userID)
+	}
+	wm.Mutex.Unlock()
+
+	db := config.GetDB()
+	for _, userID := range userIDs {
+		if !message.Audience.allows(db, userID) {
+			continue
+		}
+		wm.Mutex.Lock()
+		wm.writeUser(userID, message.Payload)
+		wm.Mutex.Unlock()
+	}
+}
+
+// notificationBuffer is how many notifications a connection queues before it
+// is considered too slow and dropped
+const notificationBuffer = 64
+
+var errFallingBehind = errors.New("falling behind")
+
 type WebSocketConn struct {
-	Conn  *websocket.Conn
-	Mutex sync.Mutex
+	Conn    *websocket.Conn
+	send    chan []byte // drained by writePump, closed when the connection is removed
+	session *Session    // set instead of Conn for a gateway subscription
+}
+
+// write queues payload for the connection's own socket or its gateway
+// session. It never blocks, a connection that cannot keep up gets an error.
+func (c *WebSocketConn) write(payload []byte) error {
+	if c.session != nil {
+		return c.session.Push("notifications", payload, nil)
+	}
+	select {
+	case c.send <- payload:
+		return nil
+	default:
+		return errFallingBehind
+	}
 }
 
-func BroadcastPostUpdate(postID, likes, dislikes int) {
-	NotificationManager.Mutex.Lock()
-	defer NotificationManager.Mutex.Unlock()
+// writePump writes the queued notifications and the pings of a socket until
+// the connection is removed or a write fails.
+func (c *WebSocketConn) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Conn.Close()
+	}()
+	for {
+		select {
+		case payload, ok := <-c.send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.Conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
 
+func BroadcastPostUpdate(postID int, reactions models.ReactionSummary) {
 	notification := map[string]any{
-		"type":     "post_update",
-		"post_id":  postID,
-		"likes":    likes,
-		"dislikes": dislikes,
+		"type":      "post_update",
+		"post_id":   postID,
+		"likes":     reactions.Counts["like"],
+		"dislikes":  reactions.Counts["dislike"],
+		"reactions": reactions.Counts,
+		"total":     reactions.Total,
 	}
 
-	for _, client := range NotificationManager.Clients {
-		client.Mutex.Lock()
-		err := client.Conn.WriteJSON(notification)
-		client.Mutex.Unlock()
+	NotificationManager.publishTo(audience{TargetType: models.TargetPost, TargetID: postID}, notification, "post update")
+}
 
-		if err != nil {
-			log.Printf("❌ Failed to send post update: %v", err)
-			client.Conn.Close()
-		}
+// BroadcastReactionUpdate pushes the reaction breakdown of any reactable target.
+// When recipients are given only they receive it (e.g. the two sides of a chat),
+// otherwise every connected user who may access the target does.
+func BroadcastReactionUpdate(targetType string, targetID int, reactions models.ReactionSummary, recipients ...int) {
+	notification := map[string]any{
+		"type":        "reaction_update",
+		"target_type": targetType,
+		"target_id":   targetID,
+		"reactions":   reactions.Counts,
+		"total":       reactions.Total,
+	}
+
+	if len(recipients) == 0 {
+		NotificationManager.publishTo(audience{TargetType: targetType, TargetID: targetID}, notification, "reaction update")
+		return
+	}
+	for _, userID := range recipients {
+		NotificationManager.publish(userID, notification, "reaction update")
 	}
 }
 
-func BroadcastGroupPostUpdate(groupID, memberID, postID int, authorName, content, createdAt string) {
-	NotificationManager.Mutex.Lock()
-	defer NotificationManager.Mutex.Unlock()
+// BroadcastPollUpdate pushes live poll results to those who can see the
+// poll's post. Only the counts are sent, the voter lists and the viewer's own
+// choices are fetched over HTTP.
+func BroadcastPollUpdate(poll *models.Poll) {
+	counts := make(map[int]int, len(poll.Options))
+	for _, option := range poll.Options {
+		counts[option.ID] = option.Votes
+	}
+	notification := map[string]any{
+		"type":        "poll_update",
+		"poll_id":     poll.ID,
+		"target_type": poll.TargetType,
+		"target_id":   poll.TargetID,
+		"votes":       counts,
+		"total_votes": poll.TotalVotes,
+		"closed":      poll.Closed,
+	}
+
+	NotificationManager.publishTo(audience{TargetType: poll.TargetType, TargetID: poll.TargetID}, notification, "poll update")
+}
 
+func BroadcastGroupPostUpdate(groupID, memberID, postID int, authorName, content, createdAt string) {
 	notification := map[string]any{
 		"type":       "group_post_update",
 		"group_id":   groupID,
@@ -61,21 +262,9 @@ func BroadcastGroupPostUpdate(groupID, memberID, postID int, authorName, content
 	}
 	// models.GroupPost
 
-	for _, client := range NotificationManager.Clients {
-		client.Mutex.Lock()
-		err := client.Conn.WriteJSON(notification)
-		client.Mutex.Unlock()
-
-		if err != nil {
-			log.Printf("❌ Failed to send group post update: %v", err)
-			client.Conn.Close()
-		}
-	}
+	NotificationManager.publishTo(audience{GroupID: groupID}, notification, "group post update")
 }
 func BroadcastGroupEvents(groupID int) {
-	NotificationManager.Mutex.Lock()
-	defer NotificationManager.Mutex.Unlock()
-
 	notification := map[string]any{
 		"type":     "new_group_event",
 		"group_id": groupID,
@@ -86,16 +275,7 @@ func BroadcastGroupEvents(groupID int) {
 	}
 	// models.GroupPost
 
-	for _, client := range NotificationManager.Clients {
-		client.Mutex.Lock()
-		err := client.Conn.WriteJSON(notification)
-		client.Mutex.Unlock()
-
-		if err != nil {
-			log.Printf("❌ Failed to send group post update: %v", err)
-			client.Conn.Close()
-		}
-	}
+	NotificationManager.publishTo(audience{GroupID: groupID}, notification, "group event update")
 }
 
 func SendNotification(userID int, notifType, message string) {
@@ -108,26 +288,24 @@ func SendNotification(userID int, notifType, message string) {
 		IsRead:  false,
 	}
 
-	// Get WebSocket client
-	NotificationManager.Mutex.Lock()
-	client, exists := NotificationManager.Clients[userID]
-	NotificationManager.Mutex.Unlock()
-
-	if exists && client != nil {
-		client.Mutex.Lock()
-		err := client.Conn.WriteJSON(notification)
-		client.Mutex.Unlock()
+	// Send to every connection of the user, on any instance
+	NotificationManager.publish(userID, notification, "notification")
+	storeNotification(notification) // Store if user is offline
+}
 
-		if err != nil {
-			log.Printf("❌ Error sending WebSocket notification: %v", err)
-			NotificationManager.RemoveClient(userID) // Remove broken connection
-		} else {
-			log.Printf("📨 Sent real-time notification to User %d", userID)
-		}
-	} else {
-		log.Printf("📌 User %d is offline. Notification stored.", userID)
+// SendNotificationFrom sends a notification triggered by another user's action.
+// Nothing is sent when either of the two has blocked the other, or when that
+// cannot be checked.
+func SendNotificationFrom(fromID, userID int, notifType, message string) {
+	blocked, err := policy.IsBlocked(config.GetDB(), fromID, userID)
+	if err != nil {
+		log.Printf("❌ Error checking blocks before notifying User %d: %v", userID, err)
+		return
 	}
-	storeNotification(notification) // Store if user is offline
+	if blocked {
+		return
+	}
+	SendNotification(userID, notifType, message)
 }
 
 func storeNotification(notification models.Notification) {
@@ -141,29 +319,95 @@ func storeNotification(notification models.Notification) {
 	}
 }
 
+// writeUser queues payload on every connection of userID. Connections that
+// fall behind are closed and forgotten. The caller holds wm.Mutex.
+func (wm *WebSocketNotificationManager) writeUser(userID int, payload []byte) {
+	for client := range wm.Clients[userID] {
+		if err := client.write(payload); err != nil {
+			log.Printf("❌ Failed to write to User %d: %v", userID, err)
+			wm.removeConn(userID, client)
+		}
+	}
+}
+
 // ✅ Remove a Disconnected WebSocket Client
-func (wm *WebSocketNotificationManager) RemoveClient(userID int) {
+func (wm *WebSocketNotificationManager) RemoveClient(userID int, client *WebSocketConn) {
 	wm.Mutex.Lock()
 	defer wm.Mutex.Unlock()
+	wm.removeConn(userID, client)
+}
 
-	if client, exists := wm.Clients[userID]; exists {
-		client.Conn.Close()
+func (wm *WebSocketNotificationManager) removeConn(userID int, client *WebSocketConn) {
+	if !wm.Clients[userID][client] {
+		return
+	}
+	if client.send != nil {
+		close(client.send)
+	}
+	delete(wm.Clients[userID], client)
+	if len(wm.Clients[userID]) == 0 {
 		delete(wm.Clients, userID)
-		log.Printf("⚠️ User %d disconnected from notifications.", userID)
 	}
+	log.Printf("⚠️ A connection of User %d left notifications.", userID)
 }
 
-func (wm *WebSocketNotificationManager) RegisterClient(userID int, conn *websocket.Conn) {
+// RegisterClient adds a connection of userID. Earlier connections (other tabs
+// or devices) stay open and keep receiving notifications.
+func (wm *WebSocketNotificationManager) RegisterClient(userID int, conn *websocket.Conn) *WebSocketConn {
 	wm.Mutex.Lock()
 	defer wm.Mutex.Unlock()
 
-	// ✅ Close previous connection if user reconnects
-	if oldClient, exists := wm.Clients[userID]; exists {
-		log.Printf("⚠️ Closing old connection for User %d.", userID)
-		oldClient.Conn.Close()
-		delete(wm.Clients, userID)
+	if _, exists := wm.Clients[userID]; !exists {
+		wm.Clients[userID] = make(map[*WebSocketConn]bool)
+	}
+	client := &WebSocketConn{Conn: conn, send: make(chan []byte, notificationBuffer)}
+	wm.Clients[userID][client] = true
+	go client.writePump()
+	log.Printf("✅ User %d connected for real-time notifications (%d connections).", userID, len(wm.Clients[userID]))
+	return client
+}
+
+// Listen reads from the connection until it closes, then removes it. Clients
+// send nothing but control frames, anything else is ignored. The connection
+// is pinged by its writePump, and dropped when the pongs stop.
+func (wm *WebSocketNotificationManager) Listen(userID int, client *WebSocketConn) {
+	untrack := UserConnections.TrackConn(userID, client.Conn)
+	defer func() {
+		untrack()
+		wm.RemoveClient(userID, client)
+	}()
+
+	client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.Conn.SetPongHandler(func(string) error { client.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	for {
+		if _, _, err := client.Conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// Subscribe registers a gateway session for the user's notifications.
+func (wm *WebSocketNotificationManager) Subscribe(s *Session, _ int) (Subscription, error) {
+	wm.Mutex.Lock()
+	defer wm.Mutex.Unlock()
+
+	if _, exists := wm.Clients[s.UserID]; !exists {
+		wm.Clients[s.UserID] = make(map[*WebSocketConn]bool)
 	}
+	client := &WebSocketConn{session: s}
+	wm.Clients[s.UserID][client] = true
+	return notificationSubscription{manager: wm, userID: s.UserID, client: client}, nil
+}
+
+type notificationSubscription struct {
+	manager *WebSocketNotificationManager
+	userID  int
+	client  *WebSocketConn
+}
+
+// Handle ignores the frame, the channel only sends.
+func (n notificationSubscription) Handle([]byte) {}
 
-	wm.Clients[userID] = &WebSocketConn{Conn: conn}
-	log.Printf("✅ User %d connected for real-time notifications.", userID)
+func (n notificationSubscription) Close() {
+	n.manager.RemoveClient(n.userID, n.client)
 }
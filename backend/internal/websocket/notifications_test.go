@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"social-network/internal/websocket/wstest"
+
+	"github.com/gorilla/websocket"
+)
+
+// startNotifications serves the sockets of a fresh manager for User 1.
+func startNotifications(t *testing.T) (*WebSocketNotificationManager, *httptest.Server) {
+	t.Helper()
+	wm := &WebSocketNotificationManager{Clients: make(map[int]map[*WebSocketConn]bool)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		go wm.Listen(1, wm.RegisterClient(1, conn))
+	}))
+	t.Cleanup(server.Close)
+	return wm, server
+}
+
+func connections(wm *WebSocketNotificationManager, userID int) int {
+	wm.Mutex.Lock()
+	defer wm.Mutex.Unlock()
+	return len(wm.Clients[userID])
+}
+
+func dialNotifications(t *testing.T, wm *WebSocketNotificationManager, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, err := wstest.Dial(server, "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	for connections(wm, 1) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+func TestNotificationDelivered(t *testing.T) {
+	wm, server := startNotifications(t)
+	conn := dialNotifications(t, wm, server)
+
+	wm.deliver(notificationMessage{UserID: 1, Payload: []byte(`{"type":"follow_request"}`)})
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil || string(data) != `{"type":"follow_request"}` {
+		t.Fatalf("read %s, %v, want the notification", data, err)
+	}
+}
+
+// TestNotificationDropsSlowConnection floods a connection that does not read
+// and expects delivery never to block on it, and the connection dropped.
+func TestNotificationDropsSlowConnection(t *testing.T) {
+	wm, server := startNotifications(t)
+	dialNotifications(t, wm, server)
+
+	big := []byte(`{"type":"notification","content":"` + strings.Repeat("x", 64<<10) + `"}`)
+	start := time.Now()
+	for i := 0; i < 1<<12 && connections(wm, 1) > 0; i++ {
+		wm.deliver(notificationMessage{UserID: 1, Payload: big})
+	}
+	if connections(wm, 1) > 0 {
+		t.Fatal("kept queueing for a connection that does not read")
+	}
+	if elapsed := time.Since(start); elapsed > writeWait/2 {
+		t.Fatalf("delivery took %v, it blocked on the slow connection", elapsed)
+	}
+}
@@ -0,0 +1,372 @@
+package websocket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"social-network/internal/models"
+	"social-network/internal/policy"
+	"social-network/internal/pubsub"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Presence statuses, see models.Presence
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+// PresenceTracker keeps who is connected to the chat sockets. Each instance
+// counts its own sockets and, once UsePubSub is called, shares the counts on
+// the bus when they change and every presenceHeartbeat; a user is online
+// while they have a socket on any instance. The state of an instance not
+// heard of for presenceExpiry is dropped. Nothing is persisted: after a
+// restart of every instance everyone is offline and has no last seen.
+type PresenceTracker struct {
+	mu       sync.Mutex
+	conns    map[int]int // open chat sockets per user on this instance
+	direct   map[int]int // the direct chat ones among them
+	away     map[int]bool
+	lastSeen map[int]time.Time
+	remote   map[int]map[string]remotePresence // the other instances' counts, by user then instance
+
+	instance string
+	bus      pubsub.PubSub
+	shareMu  sync.Mutex // orders what is shared, so the last state published is the newest
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// presenceState is the presence of users on one instance, as it travels on
+// the bus. Full is set for the heartbeat, which lists every connected user
+// of the instance.
+type presenceState struct {
+	Instance string         `json:"instance"`
+	Users    []userPresence `json:"users"`
+	Full     bool           `json:"full,omitempty"`
+}
+
+type userPresence struct {
+	UserID   int        `json:"user_id"`
+	Conns    int        `json:"conns"`
+	Direct   int        `json:"direct"`
+	Away     bool       `json:"away,omitempty"`
+	LastSeen *time.Time `json:"last_seen,omitempty"` // when the user left the instance
+}
+
+type remotePresence struct {
+	userPresence
+	heard time.Time
+}
+
+const (
+	// presenceTopic is the pub/sub topic of the presence trackers of all instances
+	presenceTopic     = "presence_state"
+	presenceHeartbeat = 30 * time.Second
+	presenceExpiry    = 3 * presenceHeartbeat
+)
+
+// UserPresence is shared by the direct and group chat hubs.
+var UserPresence = NewPresenceTracker()
+
+func NewPresenceTracker() *PresenceTracker {
+	return &PresenceTracker{
+		conns:    make(map[int]int),
+		direct:   make(map[int]int),
+		away:     make(map[int]bool),
+		lastSeen: make(map[int]time.Time),
+		remote:   make(map[int]map[string]remotePresence),
+		instance: uuid.NewV4().String(),
+		quit:     make(chan struct{}),
+	}
+}
+
+// UsePubSub shares the presence with the other instances through bus from
+// now on, until Stop.
+func (p *PresenceTracker) UsePubSub(bus pubsub.PubSub) error {
+	err := bus.Subscribe(presenceTopic, func(data []byte) {
+		var state presenceState
+		if err := json.Unmarshal(data, &state); err != nil {
+			log.Println("❌ Invalid presence state from pub/sub:", err)
+			return
+		}
+		p.merge(state)
+	})
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.bus = bus
+	p.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(presenceHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.share()
+			case <-p.quit:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends the heartbeat.
+func (p *PresenceTracker) Stop() {
+	p.stopOnce.Do(func() { close(p.quit) })
+}
+
+// Connect counts a new socket of userID, a direct chat one or a group chat
+// one, and reports whether they just came online.
+func (p *PresenceTracker) Connect(userID int, direct bool) bool {
+	p.mu.Lock()
+	online := p.connected(userID)
+	p.conns[userID]++
+	if direct {
+		p.direct[userID]++
+	}
+	p.mu.Unlock()
+	p.share(userID)
+	return !online
+}
+
+// Disconnect drops a socket of userID and reports whether they just went
+// offline, on every instance.
+func (p *PresenceTracker) Disconnect(userID int, direct bool) bool {
+	p.mu.Lock()
+	if p.conns[userID] == 0 {
+		p.mu.Unlock()
+		return false
+	}
+	p.conns[userID]--
+	if direct && p.direct[userID] > 0 {
+		p.direct[userID]--
+	}
+	if p.direct[userID] == 0 {
+		delete(p.direct, userID)
+	}
+	if p.conns[userID] > 0 {
+		p.mu.Unlock()
+		p.share(userID)
+		return false
+	}
+	delete(p.conns, userID)
+	delete(p.away, userID)
+	p.lastSeen[userID] = time.Now().UTC()
+	offline := !p.connected(userID)
+	p.mu.Unlock()
+	p.share(userID)
+	return offline
+}
+
+// SetAway marks a connected user away or back online and reports whether it changed.
+func (p *PresenceTracker) SetAway(userID int, away bool) bool {
+	p.mu.Lock()
+	if p.conns[userID] == 0 || p.away[userID] == away {
+		p.mu.Unlock()
+		return false
+	}
+	if away {
+		p.away[userID] = true
+	} else {
+		delete(p.away, userID)
+	}
+	p.mu.Unlock()
+	p.share(userID)
+	return true
+}
+
+// Get returns the current presence of userID: online if they are connected
+// and not away on some instance, away if they are away on every instance
+// they are connected to.
+func (p *PresenceTracker) Get(userID int) models.Presence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	presence := models.Presence{UserID: userID, Status: PresenceOffline}
+	states := p.states(userID)
+	for _, state := range states {
+		if state.Conns > 0 && !state.Away {
+			presence.Status = PresenceOnline
+			return presence
+		}
+		if state.Conns > 0 {
+			presence.Status = PresenceAway
+		}
+	}
+	if presence.Status == PresenceOffline {
+		if seen, ok := p.lastSeen[userID]; ok {
+			presence.LastSeen = &seen
+		}
+	}
+	return presence
+}
+
+// Chatting reports whether userID has a direct chat socket on any instance.
+func (p *PresenceTracker) Chatting(userID int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, state := range p.states(userID) {
+		if state.Direct > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// connected reports whether userID has a socket on any instance. The caller
+// holds p.mu.
+func (p *PresenceTracker) connected(userID int) bool {
+	for _, state := range p.states(userID) {
+		if state.Conns > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// states returns the presence of userID on this instance and on those heard
+// of lately. The caller holds p.mu.
+func (p *PresenceTracker) states(userID int) []userPresence {
+	states := []userPresence{p.local(userID)}
+	for instance, state := range p.remote[userID] {
+		if time.Since(state.heard) > presenceExpiry {
+			delete(p.remote[userID], instance)
+			continue
+		}
+		states = append(states, state.userPresence)
+	}
+	if len(p.remote[userID]) == 0 {
+		delete(p.remote, userID)
+	}
+	return states
+}
+
+// local returns the presence of userID on this instance. The caller holds p.mu.
+func (p *PresenceTracker) local(userID int) userPresence {
+	state := userPresence{UserID: userID, Conns: p.conns[userID], Direct: p.direct[userID], Away: p.away[userID]}
+	if seen, ok := p.lastSeen[userID]; ok && state.Conns == 0 {
+		state.LastSeen = &seen
+	}
+	return state
+}
+
+// share publishes the presence on this instance of userIDs, of every
+// connected user when none is given.
+func (p *PresenceTracker) share(userIDs ...int) {
+	p.shareMu.Lock()
+	defer p.shareMu.Unlock()
+	p.mu.Lock()
+	bus := p.bus
+	state := presenceState{Instance: p.instance, Full: len(userIDs) == 0}
+	if state.Full {
+		for userID := range p.conns {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	for _, userID := range userIDs {
+		state.Users = append(state.Users, p.local(userID))
+	}
+	p.mu.Unlock()
+	if bus == nil {
+		return
+	}
+	data, _ := json.Marshal(state)
+	if err := bus.Publish(presenceTopic, data); err != nil {
+		log.Println("❌ Failed to publish presence state:", err)
+	}
+}
+
+// merge records the presence state of another instance.
+func (p *PresenceTracker) merge(state presenceState) {
+	if state.Instance == p.instance {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	listed := make(map[int]bool, len(state.Users))
+	for _, user := range state.Users {
+		listed[user.UserID] = true
+		if user.LastSeen != nil && user.LastSeen.After(p.lastSeen[user.UserID]) {
+			p.lastSeen[user.UserID] = *user.LastSeen
+		}
+		if user.Conns == 0 {
+			delete(p.remote[user.UserID], state.Instance)
+			continue
+		}
+		if p.remote[user.UserID] == nil {
+			p.remote[user.UserID] = make(map[string]remotePresence)
+		}
+		p.remote[user.UserID][state.Instance] = remotePresence{userPresence: user, heard: now}
+	}
+	if !state.Full {
+		return
+	}
+	// the heartbeat lists every user still connected to the instance
+	for userID, instances := range p.remote {
+		if _, ok := instances[state.Instance]; ok && !listed[userID] {
+			delete(instances, state.Instance)
+		}
+	}
+}
+
+// PresenceFor returns the presence of userID as viewerID may see it. Users
+// who hide their presence, or whom viewerID may not message, always look
+// offline with no last seen.
+func PresenceFor(db *sql.DB, viewerID, userID int) (models.Presence, error) {
+	if visible, err := PresenceVisible(db, viewerID, userID); err != nil || !visible {
+		return models.Presence{UserID: userID, Status: PresenceOffline}, err
+	}
+	return UserPresence.Get(userID), nil
+}
+
+// PresenceVisible reports whether viewerID may see the presence of userID:
+// userID shows it and viewerID may message them.
+func PresenceVisible(db *sql.DB, viewerID, userID int) (bool, error) {
+	if viewerID == userID {
+		return true, nil
+	}
+	if visible, err := ShowsPresence(db, userID); err != nil || !visible {
+		return false, err
+	}
+	return policy.CanMessage(db, viewerID, userID)
+}
+
+// ShowsPresence reports whether userID lets others see their presence.
+func ShowsPresence(db *sql.DB, userID int) (bool, error) {
+	var show bool
+	err := db.QueryRow(`SELECT show_presence FROM users WHERE id = ?`, userID).Scan(&show)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return show, err
+}
+
+// EventLimiter lets an event through at most once per interval per key. It
+// belongs to one connection's read loop and is not safe for concurrent use.
+type EventLimiter struct {
+	interval time.Duration
+	last     map[string]time.Time
+}
+
+func NewEventLimiter(interval time.Duration) *EventLimiter {
+	return &EventLimiter{interval: interval, last: make(map[string]time.Time)}
+}
+
+// Allow reports whether the event may go through now.
+func (l *EventLimiter) Allow(key string) bool {
+	now := time.Now()
+	if last, ok := l.last[key]; ok && now.Sub(last) < l.interval {
+		return false
+	}
+	l.last[key] = now
+	return true
+}
@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"social-network/internal/pubsub"
+	"social-network/internal/websocket/wstest"
+)
+
+// startTrackers returns the presence trackers of two instances sharing a bus.
+func startTrackers(t *testing.T) (*PresenceTracker, *PresenceTracker) {
+	t.Helper()
+	bus := pubsub.NewMemory()
+	a, b := NewPresenceTracker(), NewPresenceTracker()
+	for _, tracker := range []*PresenceTracker{a, b} {
+		if err := tracker.UsePubSub(bus); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(tracker.Stop)
+	}
+	return a, b
+}
+
+func TestPresenceAcrossInstances(t *testing.T) {
+	a, b := startTrackers(t)
+
+	if !a.Connect(1, false) {
+		t.Fatal("first socket: not reported online")
+	}
+	if b.Connect(1, true) {
+		t.Fatal("second socket, on another instance: reported online again")
+	}
+	if !a.Chatting(1) {
+		t.Error("the direct chat socket on the other instance is not seen")
+	}
+
+	// the last tab on a closes, the user is still on b
+	if a.Disconnect(1, false) {
+		t.Fatal("reported offline while connected to the other instance")
+	}
+	if got := a.Get(1).Status; got != PresenceOnline {
+		t.Errorf("status on a = %s, want online", got)
+	}
+
+	b.SetAway(1, true)
+	if got := a.Get(1).Status; got != PresenceAway {
+		t.Errorf("status on a = %s, want away", got)
+	}
+
+	if !b.Disconnect(1, true) {
+		t.Fatal("last socket: not reported offline")
+	}
+	presence := a.Get(1)
+	if presence.Status != PresenceOffline || presence.LastSeen == nil {
+		t.Errorf("presence on a = %+v, want offline with a last seen", presence)
+	}
+	if a.Chatting(1) {
+		t.Error("still chatting after the last socket closed")
+	}
+}
+
+func TestPresenceOfVanishedInstance(t *testing.T) {
+	a, _ := startTrackers(t)
+
+	a.merge(presenceState{Instance: "other", Users: []userPresence{{UserID: 2, Conns: 1}}})
+	if got := a.Get(2).Status; got != PresenceOnline {
+		t.Fatalf("status = %s, want online", got)
+	}
+	// the heartbeat lists the users still connected
+	a.merge(presenceState{Instance: "other", Full: true})
+	if got := a.Get(2).Status; got != PresenceOffline {
+		t.Errorf("status after a heartbeat without the user = %s, want offline", got)
+	}
+
+	// an instance not heard of for presenceExpiry is forgotten
+	a.merge(presenceState{Instance: "other", Users: []userPresence{{UserID: 2, Conns: 1, Direct: 1}}})
+	a.mu.Lock()
+	state := a.remote[2]["other"]
+	state.heard = time.Now().Add(-presenceExpiry - time.Second)
+	a.remote[2]["other"] = state
+	a.mu.Unlock()
+	if got := a.Get(2).Status; got != PresenceOffline || a.Chatting(2) {
+		t.Errorf("status of a user of an expired instance = %s, want offline", got)
+	}
+}
+
+// TestPresenceFor shows the presence of a user only to those they may chat
+// with, unless they hide it.
+func TestPresenceFor(t *testing.T) {
+	db := wstest.UseDB(t, "../../migrations")
+	for id, nickname := range map[int]string{31: "viewer", 32: "friend", 33: "hidden", 34: "blocker", 35: "stranger"} {
+		wstest.Login(t, db, id, nickname)
+		UserPresence.Connect(id, false)
+		t.Cleanup(func() { UserPresence.Disconnect(id, false) })
+	}
+	seed := []string{
+		`INSERT INTO followers (follower_id, following_id, status) VALUES (31, 32, 'accepted'), (31, 33, 'accepted'), (31, 34, 'accepted')`,
+		`UPDATE users SET show_presence = 0 WHERE id = 33`,
+		`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (34, 31)`,
+	}
+	for _, query := range seed {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for userID, want := range map[int]string{32: PresenceOnline, 33: PresenceOffline, 34: PresenceOffline, 35: PresenceOffline} {
+		presence, err := PresenceFor(db, 31, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if presence.Status != want || (want == PresenceOffline && presence.LastSeen != nil) {
+			t.Errorf("presence of %d = %+v, want %s", userID, presence, want)
+		}
+	}
+	if presence, err := PresenceFor(db, 33, 33); err != nil || presence.Status != PresenceOnline {
+		t.Errorf("own hidden presence = %+v, %v, want online", presence, err)
+	}
+}
+
+func TestEventLimiter(t *testing.T) {
+	limiter := NewEventLimiter(time.Hour)
+	if !limiter.Allow("typing:2") || limiter.Allow("typing:2") {
+		t.Error("a repeated typing event went through within the interval")
+	}
+	if !limiter.Allow("typing:3") {
+		t.Error("a typing event to somebody else was held back")
+	}
+}
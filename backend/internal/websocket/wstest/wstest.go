@@ -0,0 +1,115 @@
+// Package wstest runs the real-time hubs in tests: it starts them, churns
+// connections through them and dials their sockets over httptest, against a
+// throwaway database.
+package wstest
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"social-network/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+// Hub is what the chat and group chat hubs have in common: Run serves the
+// connections until Stop.
+type Hub interface {
+	Run()
+	Stop()
+}
+
+// Start runs hub until the test ends, then stops it and waits for Run to
+// return.
+func Start(t testing.TB, hub Hub) {
+	t.Helper()
+	stopped := make(chan struct{})
+	go func() {
+		hub.Run()
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		hub.Stop()
+		<-stopped
+	})
+}
+
+// Churn runs step for every round on workers goroutines at once and waits
+// for them. Run the tests using it with -race.
+func Churn(workers, rounds int, step func(worker, round int)) {
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				step(worker, round)
+			}
+		}(worker)
+	}
+	wg.Wait()
+}
+
+// UseDB gives config.GetDB, which opens ./data/social-network.db, a fresh
+// database with the migrations applied, by working in a temporary directory
+// until the test ends. Tests using it must not run in parallel.
+func UseDB(t testing.TB, migrations string) *sql.DB {
+	t.Helper()
+	migrations, err := filepath.Abs(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	db := config.GetDB()
+	t.Cleanup(func() { db.Close() })
+	if err := config.ApplyMigrations(db, migrations); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// Login adds a user with a session and returns the header carrying its
+// cookie.
+func Login(t testing.TB, db *sql.DB, userID int, nickname string) http.Header {
+	t.Helper()
+	_, err := db.Exec(`INSERT INTO users (id, nickname, email, password, age, gender, first_name, last_name, date_of_birth)
+		VALUES (?, ?, ?, '-', 20, '', ?, 'L', '2000-01-01')`, userID, nickname, nickname+"@x.io", nickname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := fmt.Sprintf("session-%d", userID)
+	if _, err := db.Exec(`INSERT INTO sessions (sessionUUID, username, userID) VALUES (?, ?, ?)`, session, nickname, userID); err != nil {
+		t.Fatal(err)
+	}
+	return http.Header{"Cookie": {"session=" + session}}
+}
+
+// Dial opens the socket at path of server. It is safe to call from any
+// goroutine.
+func Dial(server *httptest.Server, path string, header http.Header) (*websocket.Conn, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + path
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil && resp != nil {
+		return nil, fmt.Errorf("dial %s: %v (%s)", path, err, resp.Status)
+	}
+	return conn, err
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"social-network/internal/config"
 	"social-network/internal/handlers"
+	"social-network/internal/pubsub"
 	"social-network/internal/repositories"
 	"social-network/internal/websocket"
 
@@ -22,6 +29,7 @@ func main() {
 	chatRepo := repositories.NewChatRepository(db)
 
 	handlers.InitHandlers(userRepo, groupRepo, chatRepo)
+	userRepo.PromoteAdmins(os.Getenv("SITE_ADMINS"))
 
 	r := mux.NewRouter()
 
@@ -35,8 +43,26 @@ func main() {
 
 	r.HandleFunc("/api/comments", handlers.GetCommentsForPostHandler).Methods("GET")
 	r.HandleFunc("/api/comments", handlers.CreateCommentHandler).Methods("POST")
+	r.HandleFunc("/api/comments", handlers.UpdateCommentHandler).Methods("PUT")
+	r.HandleFunc("/api/comments", handlers.DeleteCommentHandler).Methods("DELETE")
 
 	r.HandleFunc("/api/like", handlers.LikePost).Methods("POST")
+	r.HandleFunc("/api/reactions", handlers.ReactHandler).Methods("POST")
+	r.HandleFunc("/api/reactions", handlers.GetReactionsHandler).Methods("GET")
+	r.HandleFunc("/api/reactions/types", handlers.GetReactionTypesHandler).Methods("GET")
+
+	r.HandleFunc("/api/polls", handlers.CreatePollHandler).Methods("POST")
+	r.HandleFunc("/api/polls", handlers.GetPollHandler).Methods("GET")
+	r.HandleFunc("/api/polls/vote", handlers.VotePollHandler).Methods("POST")
+	r.HandleFunc("/api/polls/close", handlers.ClosePollHandler).Methods("POST")
+
+	r.HandleFunc("/api/reports", handlers.ReportHandler).Methods("POST")
+	r.HandleFunc("/api/moderation/reports", handlers.GetModerationQueueHandler).Methods("GET")
+	r.HandleFunc("/api/moderation/actions", handlers.ModerationActionHandler).Methods("POST")
+	r.HandleFunc("/api/moderation/audit", handlers.GetModerationAuditHandler).Methods("GET")
+	r.HandleFunc("/api/admin/role", handlers.SetUserRoleHandler).Methods("POST")
+	r.HandleFunc("/api/admin/retention", handlers.GetMaxRetentionHandler).Methods("GET")
+	r.HandleFunc("/api/admin/retention", handlers.SetMaxRetentionHandler).Methods("POST")
 
 	r.PathPrefix("/uploads/").Handler(http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
 	r.PathPrefix("/group_uploads/").Handler(http.StripPrefix("/group_uploads/", http.FileServer(http.Dir("group_uploads"))))
@@ -45,35 +71,84 @@ func main() {
 	r.HandleFunc("/api/user-data", handlers.GetUserData).Methods("GET")
 	r.HandleFunc("/api/myself", handlers.CurrentUser).Methods("GET")
 	r.HandleFunc("/api/private", handlers.UpdatePrivacy).Methods("POST")
+	r.HandleFunc("/api/profile-privacy", handlers.UpdateProfilePrivacy).Methods("POST")
 	r.HandleFunc("/api/discover-people", handlers.GetAllUsers).Methods("GET")
+	r.HandleFunc("/api/follow-suggestions", handlers.GetFollowSuggestionsHandler).Methods("GET")
+	r.HandleFunc("/api/follow-suggestions/dismiss", handlers.DismissSuggestionHandler).Methods("POST")
 	r.HandleFunc("/api/follow", handlers.FollowUser).Methods("POST")
 	r.HandleFunc("/api/unfollow", handlers.UnfollowUser).Methods("POST")
 	r.HandleFunc("/api/followers", handlers.GetFollowers).Methods("GET")
+	r.HandleFunc("/api/followers/remove", handlers.RemoveFollower).Methods("POST")
 	r.HandleFunc("/api/following", handlers.GetFollowing).Methods("GET")
 	r.HandleFunc("/api/follow-counts", handlers.GetFollowCounts).Methods("GET")
 	r.HandleFunc("/api/follow-status", handlers.GetFollowStatus).Methods("GET")
+	r.HandleFunc("/api/block", handlers.BlockUserHandler).Methods("POST")
+	r.HandleFunc("/api/unblock", handlers.UnblockUserHandler).Methods("POST")
+	r.HandleFunc("/api/blocked", handlers.GetBlockedUsersHandler).Methods("GET")
+	r.HandleFunc("/api/mute", handlers.MuteUserHandler).Methods("POST")
+	r.HandleFunc("/api/unmute", handlers.UnmuteUserHandler).Methods("POST")
+	r.HandleFunc("/api/muted", handlers.GetMutedUsersHandler).Methods("GET")
 
 	r.HandleFunc("/api/notifications", handlers.GetNotificationsHandler).Methods("GET")
 	r.HandleFunc("/ws/notifications", handlers.WebSocketNotificationHandler)
 	r.HandleFunc("/api/mark-notification-read", handlers.MarkNotificationsAsReadHandler).Methods("POST")
 	r.HandleFunc("/api/clear-notifications", handlers.ClearNotifications).Methods("POST")
 
-	hub := handlers.NewHub()
+	// ✅ Real-time traffic goes through the pub/sub, shared by every instance
+	// when PUBSUB_URL points them at the same server (redis://host:port)
+	bus, err := pubsub.Open(os.Getenv("PUBSUB_URL"))
+	if err != nil {
+		log.Fatal("❌ Failed to open the pub/sub:", err)
+	}
+	defer bus.Close()
+	if err := websocket.NotificationManager.UsePubSub(bus); err != nil {
+		log.Fatal("❌ Failed to subscribe to notifications:", err)
+	}
+	if err := websocket.UserPresence.UsePubSub(bus); err != nil {
+		log.Fatal("❌ Failed to share presence:", err)
+	}
+	if err := websocket.UserConnections.UsePubSub(bus); err != nil {
+		log.Fatal("❌ Failed to subscribe to disconnections:", err)
+	}
+
+	hub, err := handlers.NewHub(bus)
+	if err != nil {
+		log.Fatal("❌ Failed to start the chat hub:", err)
+	}
 	go hub.Run()
 	setupWebSocketRoutes(r, hub)
+	r.HandleFunc("/api/chat/read", func(w http.ResponseWriter, r *http.Request) {
+		handlers.MarkChatReadHandler(hub, w, r)
+	}).Methods("POST")
+	r.HandleFunc("/api/chat/requests/respond", func(w http.ResponseWriter, r *http.Request) {
+		handlers.RespondMessageRequestHandler(hub, w, r)
+	}).Methods("POST")
+	r.HandleFunc("/api/chat/retention", handlers.GetChatRetentionHandler).Methods("GET")
+	r.HandleFunc("/api/chat/retention", func(w http.ResponseWriter, r *http.Request) {
+		handlers.SetChatRetentionHandler(hub, w, r)
+	}).Methods("POST")
 
 	r.HandleFunc("/api/chat/recent", handlers.GetRecentChats).Methods("GET")
+	r.HandleFunc("/api/chat/requests", handlers.GetMessageRequestsHandler).Methods("GET")
+	r.HandleFunc("/api/chat/presence", handlers.GetChatPresenceHandler).Methods("GET")
+	r.HandleFunc("/api/chat/attachments", handlers.UploadChatAttachmentHandler).Methods("POST")
+	r.HandleFunc("/api/chat/attachment", handlers.DownloadChatAttachmentHandler).Methods("GET")
+	r.HandleFunc("/api/chat/presence-settings", handlers.UpdatePresenceSettingsHandler).Methods("POST")
 	r.HandleFunc("/api/chat/users", handlers.GetAvailableChatUsers).Methods("GET")
 	r.HandleFunc("/api/chat/history", handlers.GetChatHistoryHandler).Methods("GET")
+	r.HandleFunc("/api/chat/search", handlers.SearchChatsHandler).Methods("GET")
 
 	r.HandleFunc("/api/follow-requests", handlers.GetFollowRequests).Methods("GET")
 	r.HandleFunc("/api/update-follow-request", handlers.UpdateFollowRequest).Methods("POST")
+	r.HandleFunc("/api/follow-requests/bulk", handlers.BulkUpdateFollowRequests).Methods("POST")
 
 	r.HandleFunc("/api/groups", handlers.GetGroupDetailsHandler).Methods("GET")
 	r.HandleFunc("/api/groups/posts", handlers.CreateGroupPostHandler).Methods("POST")
 	r.HandleFunc("/api/groups/posts", handlers.GetGroupPostsHandler).Methods("GET")
 	r.HandleFunc("/api/groups/comments", handlers.GetGroupPostCommentsHandler).Methods("GET")
 	r.HandleFunc("/api/groups/comments", handlers.AddGroupPostCommentHandler).Methods("POST")
+	r.HandleFunc("/api/groups/comments", handlers.UpdateGroupPostCommentHandler).Methods("PUT")
+	r.HandleFunc("/api/groups/comments", handlers.DeleteGroupPostCommentHandler).Methods("DELETE")
 	r.HandleFunc("/api/groups/like", handlers.LikeGroupPostHandler).Methods("POST")
 	r.HandleFunc("/api/groups/leave", handlers.LeaveGroupHandler).Methods("POST")
 	r.HandleFunc("/api/groups-created-by-me", handlers.GetUserCreatedGroupsHandler).Methods("GET")
@@ -99,25 +174,94 @@ func main() {
 	r.HandleFunc("/api/groups/events/rsvp/count", handlers.GetRSVPCountHandler).Methods("GET")
 	r.HandleFunc("/api/groups/events", handlers.GetGroupEventsHandler).Methods("GET")
 
-	r.HandleFunc("/api/group/chat/history", handlers.GetGroupChatHistoryHandler).Methods("GET")
 	r.HandleFunc("/api/selected-users", handlers.GetSelectedUsersHandler).Methods("GET")
 	r.HandleFunc("/api/update-selected-users", handlers.UpdateSelectedUsersHandler).Methods("POST")
 
-	groupHub := websocket.NewGroupHub()
+	groupHub, err := websocket.NewGroupHub(bus)
+	if err != nil {
+		log.Fatal("❌ Failed to start the group chat hub:", err)
+	}
 	go groupHub.Run() // ✅ Run the WebSocket hub in a goroutine
 
 	setupWebSocketRoutesG(r, groupHub)
+	r.HandleFunc("/api/group/chat/history", handlers.GetGroupChatHistoryHandler).Methods("GET")
+	r.HandleFunc("/api/group/chat/read", func(w http.ResponseWriter, r *http.Request) {
+		handlers.MarkGroupChatReadHandler(groupHub, w, r)
+	}).Methods("POST")
+	r.HandleFunc("/api/group/chat/retention", handlers.GetGroupChatRetentionHandler).Methods("GET")
+	r.HandleFunc("/api/group/chat/retention", func(w http.ResponseWriter, r *http.Request) {
+		handlers.SetGroupChatRetentionHandler(groupHub, w, r)
+	}).Methods("POST")
+	r.HandleFunc("/api/group/chat/channels", handlers.GetGroupChannelsHandler).Methods("GET")
+	r.HandleFunc("/api/group/chat/channels", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CreateGroupChannelHandler(groupHub, w, r)
+	}).Methods("POST")
+	r.HandleFunc("/api/group/chat/channels/archive", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ArchiveGroupChannelHandler(groupHub, w, r)
+	}).Methods("POST")
+	r.HandleFunc("/api/group/chat/channels/members", handlers.GetGroupChannelMembersHandler).Methods("GET")
+	r.HandleFunc("/api/group/chat/channels/members", func(w http.ResponseWriter, r *http.Request) {
+		handlers.UpdateGroupChannelMembersHandler(groupHub, w, r)
+	}).Methods("POST", "DELETE")
+
+	// ✅ One socket per tab, the hubs above are its channels
+	gateway := websocket.NewGateway()
+	gateway.Mount("chat", hub, true)
+	gateway.Mount("notifications", websocket.NotificationManager, true)
+	gateway.Mount("group", groupHub, false)
+	r.HandleFunc("/ws", gateway.ServeWs)
 
 	corsOptions := han.CORS(
-		han.AllowedOrigins([]string{"http://localhost:5173"}), // Allow Vue.js frontend
+		han.AllowedOrigins([]string{config.AllowedOrigin}), // Allow Vue.js frontend
 		han.AllowedMethods([]string{"GET", "POST", "OPTIONS", "PUT", "DELETE"}),
 		han.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		han.ExposedHeaders([]string{"X-Total-Count", "X-Has-More"}),
 		han.AllowCredentials(), // ✅ This is MANDATORY for cookies/sessions
 	)
 	r.PathPrefix("/").Handler(http.StripPrefix("/", http.FileServer(http.Dir("./frontend/src/components"))))
 
+	// the background jobs stop, and are waited for, on shutdown
+	var jobs sync.WaitGroup
+	quitJobs := make(chan struct{})
+	runJob := func(job func(quit <-chan struct{})) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(quitJobs)
+		}()
+	}
+	runJob(func(quit <-chan struct{}) { handlers.RunPollCloser(30*time.Second, quit) })
+	runJob(func(quit <-chan struct{}) { handlers.RunMessageReaper(time.Minute, quit) })
+
+	server := &http.Server{Addr: ":8080", Handler: corsOptions(r)}
+	// ListenAndServe returns as soon as Shutdown starts, main waits for done
+	// so that the deferred closes of the bus and the database come last
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		log.Println("⚠️ Shutting down")
+		// the hubs close the sockets, which the server does not track
+		hub.Stop()
+		groupHub.Stop()
+		websocket.UserPresence.Stop()
+		close(quitJobs)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("❌ Failed to drain the server:", err)
+		}
+		jobs.Wait()
+	}()
+
 	log.Println("✅ Server running on :8080")
-	http.ListenAndServe(":8080", corsOptions(r))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal("❌ Server failed:", err)
+	}
+	<-done
+	log.Println("✅ Server stopped")
 }
 
 func setupWebSocketRoutes(r *mux.Router, hub *handlers.Hub) {
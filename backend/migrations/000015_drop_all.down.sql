@@ -15,6 +15,29 @@ DROP TABLE IF EXISTS sessions;
 DROP TABLE IF EXISTS group_invitations ;
 DROP TABLE IF EXISTS group_comments ;
 DROP TABLE IF EXISTS posts_visibility ;
+DROP TABLE IF EXISTS group_likes;
+DROP TABLE IF EXISTS reactions;
+DROP TABLE IF EXISTS poll_votes;
+DROP TABLE IF EXISTS poll_options;
+DROP TABLE IF EXISTS polls;
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS moderation_actions;
+DROP TABLE IF EXISTS user_blocks;
+DROP TABLE IF EXISTS user_mutes;
+DROP TABLE IF EXISTS suggestion_dismissals;
+DROP TABLE IF EXISTS conversation_reads;
+DROP TABLE IF EXISTS group_chat_reads;
+DROP TABLE IF EXISTS chat_attachments;
+DROP TABLE IF EXISTS message_requests;
+DROP TABLE IF EXISTS messages_fts;
+DROP TABLE IF EXISTS group_messages_fts;
+DROP TABLE IF EXISTS group_chat_channels;
+DROP TABLE IF EXISTS group_chat_channel_members;
+DROP TABLE IF EXISTS group_chat_channel_reads;
+DROP TABLE IF EXISTS conversation_retention;
+DROP TABLE IF EXISTS group_chat_retention;
+DROP TABLE IF EXISTS site_settings;
+DROP TABLE IF EXISTS schema_migrations;
 
 
 -- 1/u create_users_table (28.0547ms)
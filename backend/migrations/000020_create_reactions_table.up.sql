@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS reactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    target_type TEXT NOT NULL CHECK(target_type IN ('post', 'group_post', 'comment', 'group_comment', 'message', 'group_message')),
+    target_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    reaction TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(target_type, target_id, user_id), -- one reaction per user per target
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_target ON reactions(target_type, target_id);
+
+-- move the old binary likes/dislikes over, then drop the old tables
+INSERT OR IGNORE INTO reactions (target_type, target_id, user_id, reaction)
+SELECT 'post', post_id, user_id, CASE WHEN is_like THEN 'like' ELSE 'dislike' END
+FROM likes WHERE post_id IS NOT NULL AND is_like IS NOT NULL;
+
+INSERT OR IGNORE INTO reactions (target_type, target_id, user_id, reaction)
+SELECT 'group_post', post_id, member_id, CASE WHEN is_like THEN 'like' ELSE 'dislike' END
+FROM group_likes WHERE post_id IS NOT NULL AND is_like IS NOT NULL;
+
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS group_likes;
@@ -0,0 +1,42 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK(role IN ('user', 'moderator', 'admin'));
+ALTER TABLE users ADD COLUMN suspended_until DATETIME DEFAULT NULL;
+
+-- content hidden by a moderator stays in the database but is left out of every listing
+ALTER TABLE posts ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE group_posts ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE group_comments ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE group_messages ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reporter_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL CHECK(target_type IN ('user', 'post', 'comment', 'group_post', 'group_comment', 'message', 'group_message')),
+    target_id INTEGER NOT NULL,
+    target_user_id INTEGER NOT NULL, -- author of the reported content, or the reported user
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL CHECK(status IN ('open', 'resolved', 'dismissed')) DEFAULT 'open',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    resolved_by INTEGER DEFAULT NULL,
+    resolved_at DATETIME DEFAULT NULL,
+    UNIQUE(reporter_id, target_type, target_id), -- one open report per reporter and target
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_status ON reports(status, created_at);
+
+-- audit trail of every moderation action, kept even if the target is deleted
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    moderator_id INTEGER NOT NULL,
+    action TEXT NOT NULL CHECK(action IN ('hide', 'delete', 'warn', 'suspend', 'dismiss', 'role')),
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    target_user_id INTEGER DEFAULT NULL,
+    report_id INTEGER DEFAULT NULL,
+    note TEXT DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (moderator_id) REFERENCES users(id)
+);
@@ -0,0 +1,11 @@
+-- replies point at their parent comment, top-level comments keep parent_id NULL
+ALTER TABLE comments ADD COLUMN parent_id INTEGER DEFAULT NULL REFERENCES comments(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN created_at DATETIME DEFAULT NULL;
+ALTER TABLE comments ADD COLUMN edited_at DATETIME DEFAULT NULL;
+
+ALTER TABLE group_comments ADD COLUMN parent_id INTEGER DEFAULT NULL REFERENCES group_comments(id) ON DELETE CASCADE;
+ALTER TABLE group_comments ADD COLUMN created_at DATETIME DEFAULT NULL;
+ALTER TABLE group_comments ADD COLUMN edited_at DATETIME DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_comments_post ON comments(post_id, parent_id);
+CREATE INDEX IF NOT EXISTS idx_group_comments_post ON group_comments(g_post_id, parent_id);
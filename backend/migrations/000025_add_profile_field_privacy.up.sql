@@ -0,0 +1,5 @@
+-- who may see each profile field: 'public', 'followers' or 'only_me'
+ALTER TABLE users ADD COLUMN email_visibility TEXT NOT NULL DEFAULT 'followers' CHECK(email_visibility IN ('public', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN birthdate_visibility TEXT NOT NULL DEFAULT 'followers' CHECK(birthdate_visibility IN ('public', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN gender_visibility TEXT NOT NULL DEFAULT 'public' CHECK(gender_visibility IN ('public', 'followers', 'only_me'));
+ALTER TABLE users ADD COLUMN name_visibility TEXT NOT NULL DEFAULT 'public' CHECK(name_visibility IN ('public', 'followers', 'only_me'));
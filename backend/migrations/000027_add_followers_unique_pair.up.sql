@@ -0,0 +1,11 @@
+-- keep one row per follower/following pair, preferring an accepted follow
+DELETE FROM followers WHERE id NOT IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (
+            PARTITION BY follower_id, following_id ORDER BY status = 'accepted' DESC, id ASC
+        ) AS rn
+        FROM followers
+    ) WHERE rn = 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_followers_pair ON followers(follower_id, following_id);
@@ -0,0 +1,23 @@
+-- last message of a conversation each user has read, for unread counts and read receipts
+CREATE TABLE IF NOT EXISTS conversation_reads (
+    user_id INTEGER NOT NULL,
+    peer_id INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, peer_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (peer_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_chat_reads (
+    user_id INTEGER NOT NULL,
+    group_id INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, group_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_receiver ON messages(receiver_id, sender_id, id);
+CREATE INDEX IF NOT EXISTS idx_group_messages_group ON group_messages(group_id, id);
@@ -0,0 +1,2 @@
+-- when off, nobody sees whether the user is online, away or when they were last seen
+ALTER TABLE users ADD COLUMN show_presence BOOLEAN NOT NULL DEFAULT 1;
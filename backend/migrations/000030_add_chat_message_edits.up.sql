@@ -0,0 +1,7 @@
+ALTER TABLE messages ADD COLUMN edited_at DATETIME;
+ALTER TABLE messages ADD COLUMN deleted_at DATETIME;
+ALTER TABLE messages ADD COLUMN reply_to_id INTEGER REFERENCES messages(id) ON DELETE SET NULL;
+
+ALTER TABLE group_messages ADD COLUMN edited_at DATETIME;
+ALTER TABLE group_messages ADD COLUMN deleted_at DATETIME;
+ALTER TABLE group_messages ADD COLUMN reply_to_id INTEGER REFERENCES group_messages(id) ON DELETE SET NULL;
@@ -0,0 +1,11 @@
+-- client_id is generated by the sending client so a retried send is stored once
+ALTER TABLE messages ADD COLUMN client_id TEXT;
+ALTER TABLE messages ADD COLUMN delivered_at DATETIME;
+ALTER TABLE group_messages ADD COLUMN client_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_client_id ON messages(sender_id, client_id) WHERE client_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_messages_client_id ON group_messages(sender_id, client_id) WHERE client_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_messages_undelivered ON messages(receiver_id, id) WHERE delivered_at IS NULL;
+
+-- messages from before delivery tracking are not replayed
+UPDATE messages SET delivered_at = sent_at;
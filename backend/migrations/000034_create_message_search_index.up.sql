@@ -0,0 +1,36 @@
+-- full-text indexes over the chat histories. They are external content
+-- tables: only the index is stored, the text is read from the messages
+-- themselves, and the triggers keep the index in step with sends, edits,
+-- unsends and deletes.
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts4(content="messages", content, tokenize=unicode61);
+CREATE VIRTUAL TABLE IF NOT EXISTS group_messages_fts USING fts4(content="group_messages", content, tokenize=unicode61);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+    INSERT INTO messages_fts (docid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_before_update BEFORE UPDATE OF content ON messages BEGIN
+    DELETE FROM messages_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_after_update AFTER UPDATE OF content ON messages BEGIN
+    INSERT INTO messages_fts (docid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete BEFORE DELETE ON messages BEGIN
+    DELETE FROM messages_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_insert AFTER INSERT ON group_messages BEGIN
+    INSERT INTO group_messages_fts (docid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_before_update BEFORE UPDATE OF content ON group_messages BEGIN
+    DELETE FROM group_messages_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_after_update AFTER UPDATE OF content ON group_messages BEGIN
+    INSERT INTO group_messages_fts (docid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS group_messages_fts_delete BEFORE DELETE ON group_messages BEGIN
+    DELETE FROM group_messages_fts WHERE docid = old.id;
+END;
+
+-- index the history sent before search existed
+INSERT INTO messages_fts (messages_fts) VALUES ('rebuild');
+INSERT INTO group_messages_fts (group_messages_fts) VALUES ('rebuild');
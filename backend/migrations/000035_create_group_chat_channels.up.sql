@@ -0,0 +1,58 @@
+-- topic channels of a group chat, created and archived by the group's admin;
+-- every group has a default channel, #general, that cannot be archived
+CREATE TABLE IF NOT EXISTS group_chat_channels (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    group_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    private BOOLEAN NOT NULL DEFAULT 0, -- only its members and the group's admin can see it
+    is_default BOOLEAN NOT NULL DEFAULT 0,
+    creator_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    archived_at DATETIME, -- read only once set
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+    FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_chat_channels_name ON group_chat_channels(group_id, name);
+
+CREATE TABLE IF NOT EXISTS group_chat_channel_members (
+    channel_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (channel_id, user_id),
+    FOREIGN KEY (channel_id) REFERENCES group_chat_channels(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- last message of a channel each user has read, replacing group_chat_reads
+CREATE TABLE IF NOT EXISTS group_chat_channel_reads (
+    user_id INTEGER NOT NULL,
+    channel_id INTEGER NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    read_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, channel_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (channel_id) REFERENCES group_chat_channels(id) ON DELETE CASCADE
+);
+
+ALTER TABLE group_messages ADD COLUMN channel_id INTEGER REFERENCES group_chat_channels(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_group_messages_channel ON group_messages(channel_id, id);
+
+CREATE TRIGGER IF NOT EXISTS groups_default_channel AFTER INSERT ON groups BEGIN
+    INSERT INTO group_chat_channels (group_id, name, is_default, creator_id) VALUES (new.id, 'general', 1, new.creator_id);
+END;
+
+-- the existing chat of every group becomes its #general
+INSERT INTO group_chat_channels (group_id, name, is_default, creator_id)
+SELECT id, 'general', 1, creator_id FROM groups;
+
+UPDATE group_messages SET channel_id = (
+    SELECT c.id FROM group_chat_channels c WHERE c.group_id = group_messages.group_id AND c.is_default = 1
+);
+
+INSERT INTO group_chat_channel_reads (user_id, channel_id, last_read_id, read_at)
+SELECT r.user_id, c.id, r.last_read_id, r.read_at
+FROM group_chat_reads r
+JOIN group_chat_channels c ON c.group_id = r.group_id AND c.is_default = 1;
+
+DROP TABLE IF EXISTS group_chat_reads;
@@ -0,0 +1,39 @@
+-- disappearing messages: how long a message lives after it is sent, in
+-- seconds, 0 for as long as the conversation exists
+CREATE TABLE IF NOT EXISTS conversation_retention (
+    user_id INTEGER NOT NULL, -- the lower id of the pair
+    peer_id INTEGER NOT NULL,
+    lifetime INTEGER NOT NULL DEFAULT 0,
+    set_by INTEGER NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, peer_id),
+    CHECK (user_id < peer_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (peer_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_chat_retention (
+    group_id INTEGER PRIMARY KEY,
+    lifetime INTEGER NOT NULL DEFAULT 0,
+    set_by INTEGER NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+-- settings of the whole site changed by its admins, e.g. max_message_lifetime
+CREATE TABLE IF NOT EXISTS site_settings (
+    name TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- expires_at is fixed when the message is sent, system messages announce
+-- timer changes and cannot be edited or unsent
+ALTER TABLE messages ADD COLUMN expires_at DATETIME;
+ALTER TABLE messages ADD COLUMN system BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE group_messages ADD COLUMN expires_at DATETIME;
+ALTER TABLE group_messages ADD COLUMN system BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_messages_expires ON messages(expires_at) WHERE expires_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_group_messages_expires ON group_messages(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,4 @@
+-- a client id is unique among a sender's messages of one channel, as the
+-- retried send is looked up in its channel
+DROP INDEX IF EXISTS idx_group_messages_client_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_messages_client_id ON group_messages(sender_id, channel_id, client_id) WHERE client_id IS NOT NULL;